@@ -0,0 +1,94 @@
+package booksing
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Author is the name booksing uses for a writer whose books come with several spellings of their name
+type Author struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Name      string `gorm:"uniqueIndex"`
+	Aliases   []AuthorAlias
+}
+
+// AuthorAlias is another spelling of the name of an Author, books by Alias are stored under the name of the Author
+type AuthorAlias struct {
+	ID       uint `gorm:"primaryKey"`
+	AuthorID uint `gorm:"index"`
+	Alias    string
+	// Key is AuthorKey of Alias, an alias matches every spelling with the same key
+	Key string `gorm:"uniqueIndex"`
+}
+
+// AuthorKey returns what different spellings of the same name have in common, so "Tolkien, J. R. R." and
+// "J.R.R. Tolkien" get the same key
+func AuthorKey(name string) string {
+	name = strings.ToLower(NormalizeSearch(Fix(name, false, true)))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// AuthorAliases is the name to use for each author key
+type AuthorAliases map[string]string
+
+// NewAuthorAliases returns the aliases of authors, the names of the authors themselves are included so other spellings
+// of them are matched as well
+func NewAuthorAliases(authors []Author) AuthorAliases {
+	aliases := make(AuthorAliases)
+	for _, a := range authors {
+		aliases[AuthorKey(a.Name)] = a.Name
+		for _, alias := range a.Aliases {
+			aliases[alias.Key] = a.Name
+		}
+	}
+	return aliases
+}
+
+// Resolve returns the name of the author that name is a spelling of, or name itself when it is nobody's alias
+func (a AuthorAliases) Resolve(name string) string {
+	if canonical, ok := a[AuthorKey(name)]; ok {
+		return canonical
+	}
+	return name
+}
+
+// AuthorSpellings returns the authors with more than one spelling among names, most books first. Every group has the
+// spelling with the most books first, it is the likely name to merge the others into.
+func AuthorSpellings(names []FacetCount) [][]FacetCount {
+	byKey := make(map[string][]FacetCount)
+	for _, n := range names {
+		key := AuthorKey(n.Value)
+		byKey[key] = append(byKey[key], n)
+	}
+
+	var groups [][]FacetCount
+	total := make(map[string]int64)
+	for _, g := range byKey {
+		if len(g) < 2 {
+			continue
+		}
+		sort.SliceStable(g, func(i, j int) bool {
+			return g[i].Count > g[j].Count
+		})
+		for _, n := range g {
+			total[g[0].Value] += n.Count
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		ti, tj := total[groups[i][0].Value], total[groups[j][0].Value]
+		if ti != tj {
+			return ti > tj
+		}
+		return groups[i][0].Value < groups[j][0].Value
+	})
+	return groups
+}
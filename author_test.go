@@ -0,0 +1,58 @@
+package booksing
+
+import "testing"
+
+func TestAuthorKey(t *testing.T) {
+	for _, names := range [][]string{
+		{"J.R.R. Tolkien", "Tolkien, J. R. R.", "J R R Tolkien", "j.r.r.tolkien"},
+		{"Samuel Bjørk", "Samuel Bjork", "Bjørk, Samuel"},
+		{"J.M.A. Biesheuvel", "J M A Biesheuvel", "Biesheuvel, J.M.A."},
+	} {
+		want := AuthorKey(names[0])
+		for _, n := range names[1:] {
+			if got := AuthorKey(n); got != want {
+				t.Errorf("AuthorKey(%q) = %q, want %q as for %q", n, got, want, names[0])
+			}
+		}
+	}
+	if AuthorKey("C.S. Lewis") == AuthorKey("C.S. Forester") {
+		t.Errorf("AuthorKey() is the same for different authors")
+	}
+}
+
+func TestAuthorAliases(t *testing.T) {
+	aliases := NewAuthorAliases([]Author{
+		{Name: "J.R.R. Tolkien", Aliases: []AuthorAlias{
+			{Alias: "John Ronald Reuel Tolkien", Key: AuthorKey("John Ronald Reuel Tolkien")},
+		}},
+	})
+	for name, want := range map[string]string{
+		"John Ronald Reuel Tolkien": "J.R.R. Tolkien",
+		"J R R Tolkien":             "J.R.R. Tolkien",
+		"J.R.R. Tolkien":            "J.R.R. Tolkien",
+		"Christopher Tolkien":       "Christopher Tolkien",
+	} {
+		if got := aliases.Resolve(name); got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := AuthorAliases(nil).Resolve("J R R Tolkien"); got != "J R R Tolkien" {
+		t.Errorf("Resolve() without aliases = %q, want the name itself", got)
+	}
+}
+
+func TestAuthorSpellings(t *testing.T) {
+	groups := AuthorSpellings([]FacetCount{
+		{Value: "J M A Biesheuvel", Count: 1},
+		{Value: "J.M.A. Biesheuvel", Count: 3},
+		{Value: "Samuel Bjork", Count: 2},
+		{Value: "Samuel Bjørk", Count: 5},
+		{Value: "Charles Dickens", Count: 9},
+	})
+	if len(groups) != 2 {
+		t.Fatalf("AuthorSpellings() = %v, want the two authors with several spellings", groups)
+	}
+	if groups[0][0].Value != "Samuel Bjørk" || groups[1][0].Value != "J.M.A. Biesheuvel" || len(groups[1]) != 2 {
+		t.Errorf("AuthorSpellings() = %v, want the author with most books first and their most used spelling first", groups)
+	}
+}
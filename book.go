@@ -6,6 +6,8 @@ import (
 	"os"
 	"regexp"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"strings"
 
@@ -30,14 +32,15 @@ const (
 // Book represents a book record in the database, regular "book" data with extra metadata
 type Book struct {
 	gorm.Model
-	Hash        string `gorm:"uniqueIndex"`
+	// Hash is shared by all editions and files of the same work, the ID identifies a single book
+	Hash        string `gorm:"index"`
 	Title       string
 	Author      string `gorm:"index"`
 	Language    string `gorm:"index"`
 	Description string
 	Added       time.Time `gorm:"index"`
-	Path        string
-	Size        int64 `gorm:"index"`
+	Path        string    `gorm:"uniqueIndex:idx_books_path,where:path != ''"`
+	Size        int64     `gorm:"index"`
 	HasCover    bool
 	CoverPath   string
 	Publisher   string
@@ -45,6 +48,18 @@ type Book struct {
 	Series      string `gorm:"index"`
 	PublishDate time.Time
 	SeriesIndex float64
+	Checksum    string `gorm:"index"`
+	// HashVersion is the version of HashBook that computed Hash
+	HashVersion int
+	// WorkID groups the editions of a work across languages and formats, it is 0 until the book is grouped
+	WorkID uint `gorm:"index"`
+	// LanguageSource says whether the language was declared by the book or detected from its text
+	LanguageSource string
+	// Tags are the names of the tags of the book, one per line, as search indexes them. BookTag is what links the book
+	// to its tags.
+	Tags string
+	// UploadedBy is the user that uploaded the book through the web ui
+	UploadedBy string
 }
 
 type BookInput struct {
@@ -57,13 +72,17 @@ type BookInput struct {
 
 func (b *BookInput) ToBook() Book {
 	var book Book
-	book.Author = Fix(b.Author, true, true)
-	book.Title = Fix(b.Title, true, false)
 	book.Language = FixLang(b.Language)
+	if book.Language != "" {
+		book.LanguageSource = LanguageDeclared
+	}
+	book.Author = NameCase(Fix(b.Author, false, true), book.Language)
+	book.Title = TitleCase(Fix(b.Title, false, false), book.Language)
 	book.Description = b.Description
 	book.Path = b.Path
 
 	book.Hash = HashBook(book.Author, book.Title)
+	book.HashVersion = HashVersion
 
 	return book
 
@@ -73,8 +92,18 @@ type FileLocation struct {
 	Path string
 }
 
+// ImportOptions are how books are read from their files
+type ImportOptions struct {
+	// FilenamePatterns read the name of a file to complete what its epub lacks
+	FilenamePatterns []FilenamePattern
+	// AuthorAliases has the name authors are stored under
+	AuthorAliases AuthorAliases
+	// Capitalize are the fields from CapitalizeFields that are title cased in the rules of the language of the book
+	Capitalize []string
+}
+
 // NewBookFromFile creates a book object from a file
-func NewBookFromFile(bookpath string, baseDir string) (bk *Book, err error) {
+func NewBookFromFile(bookpath string, baseDir string, opts ImportOptions) (bk *Book, err error) {
 	epub, cover, err := epub.ParseFile(bookpath)
 	if err != nil {
 		fmt.Println(cover)
@@ -92,6 +121,10 @@ func NewBookFromFile(bookpath string, baseDir string) (bk *Book, err error) {
 		Series:      epub.Series,
 		PublishDate: epub.PublishDate,
 		SeriesIndex: epub.SeriesIndex,
+		Path:        bookpath,
+	}
+	if m, ok := ParseFilename(bookpath, opts.FilenamePatterns); ok {
+		book.ApplyFilename(m)
 	}
 
 	f, err := os.Open(bookpath)
@@ -107,13 +140,22 @@ func NewBookFromFile(bookpath string, baseDir string) (bk *Book, err error) {
 	book.Added = fi.ModTime()
 	book.Size = fi.Size()
 
-	book.Title = Fix(book.Title, true, false)
-	book.Author = Fix(book.Author, true, true)
+	book.Title = Fix(book.Title, false, false)
+	book.Author = Fix(book.Author, false, true)
 	book.Language = FixLang(book.Language)
+	book.detectLanguage(epub.Sample)
+	book.Capitalize(opts.Capitalize...)
+	book.Author = opts.AuthorAliases.Resolve(book.Author)
 	book.Description = sanitize.HTML(book.Description)
+	book.SetTags(ParseSubjects(epub.Subjects))
 
 	book.Hash = HashBook(book.Author, book.Title)
-	book.Path = bookpath
+	book.HashVersion = HashVersion
+
+	book.Checksum, err = PartialMD5(bookpath)
+	if err != nil {
+		return nil, err
+	}
 
 	if book.HasCover {
 		book.CoverPath = strings.Replace(bookpath, ".epub", ".jpg", 1)
@@ -149,84 +191,26 @@ func GetBookPath(title, author string) string {
 	return formatted
 }
 
-func FixLang(s string) string {
-	s = strings.ToLower(s)
-
-	switch s {
-	case "nld":
-		s = "nl"
-	case "dutch":
-		s = "nl"
-	case "nederlands":
-		s = "nl"
-	case "nederland":
-		s = "nl"
-	case "nl-nl":
-		s = "nl"
-	case "nl_nl":
-		s = "nl"
-	case "dut":
-		s = "nl"
-
-	case "deutsch":
-		s = "de"
-	case "deutsche":
-		s = "de"
-	case "duits":
-		s = "de"
-	case "german":
-		s = "de"
-	case "ger":
-		s = "de"
-	case "de-de":
-		s = "de"
-	case "de_de":
-		s = "de"
-
-	case "english":
-		s = "en"
-	case "engels":
-		s = "en"
-	case "eng":
-		s = "en"
-	case "uk":
-		s = "en"
-	case "en-us":
-		s = "en"
-	case "en-gb":
-		s = "en"
-	case "en-en":
-		s = "en"
-	case "en_us":
-		s = "en"
-	case "en_gb":
-		s = "en"
-	case "en_en":
-		s = "en"
-	case "us":
-		s = "en"
-	}
-	return s
-}
-
+// Fix cleans up a title or, with correctOrder, the name of an author. Names written last name first are turned around
+// and their initials are written as J.R.R., whether they came as J. R. R. or J R R.
 func Fix(s string, capitalize, correctOrder bool) string {
 	if s == "" {
 		return "Unknown"
 	}
 	if capitalize {
-		s = strings.Title(strings.ToLower(s))
-		s = strings.Replace(s, "'S", "'s", -1)
+		s = TitleCase(s, "")
 	}
-	if correctOrder && strings.Contains(s, ",") {
-		sParts := strings.Split(s, ",")
-		if len(sParts) == 2 {
-			s = strings.TrimSpace(sParts[1]) + " " + strings.TrimSpace(sParts[0])
-		}
+	if correctOrder {
+		s = firstNameFirst(s)
 	}
 
 	s = yearRemove.ReplaceAllString(s, "")
 	s = drukRemove.ReplaceAllString(s, "")
-	s = strings.Replace(s, ".", " ", -1)
+	if correctOrder {
+		s = joinInitials(s)
+	} else {
+		s = strings.Replace(s, ".", " ", -1)
+	}
 	s = strings.Replace(s, "  ", " ", -1)
 	s = strings.TrimSpace(s)
 
@@ -242,3 +226,64 @@ func Fix(s string, capitalize, correctOrder bool) string {
 		return in
 	}, s)
 }
+
+// nameSuffixes follow the name of a person, also when it is written last name first
+var nameSuffixes = map[string]bool{"jr": true, "sr": true, "ii": true, "iii": true, "iv": true}
+
+// authorSeparator separates the authors of a book that has several
+var authorSeparator = regexp.MustCompile(`\s*(?:&|;)\s*`)
+
+// firstNameFirst turns around names written last name first, like "Tolkien, J.R.R." and "King, Stephen, Jr.". Several
+// authors separated by & or ; are turned around one by one.
+func firstNameFirst(s string) string {
+	authors := authorSeparator.Split(s, -1)
+	for i, a := range authors {
+		parts := strings.Split(a, ",")
+		for j := range parts {
+			parts[j] = strings.TrimSpace(parts[j])
+		}
+		switch {
+		case len(parts) == 2:
+			authors[i] = parts[1] + " " + parts[0]
+		case len(parts) == 3 && nameSuffixes[strings.ToLower(strings.TrimSuffix(parts[2], "."))]:
+			authors[i] = parts[1] + " " + parts[0] + " " + parts[2]
+		}
+	}
+	return strings.Join(authors, " & ")
+}
+
+// initial matches a single letter followed by a dot at the start of a word, like the J of J.R.R.Tolkien
+var initial = regexp.MustCompile(`^(\pL)\.(.*)$`)
+
+// joinInitials writes the initials in a name without spaces and with a dot after every letter, words that are not
+// initials, like Th. and Jr., are left alone
+func joinInitials(s string) string {
+	var words []string
+	initials := ""
+	for _, w := range strings.Fields(s) {
+		for w != "" {
+			m := initial.FindStringSubmatch(w)
+			if m == nil {
+				break
+			}
+			initials += m[1] + "."
+			w = m[2]
+		}
+		if w == "" {
+			continue
+		}
+		if utf8.RuneCountInString(w) == 1 && unicode.IsLetter([]rune(w)[0]) {
+			initials += w + "."
+			continue
+		}
+		if initials != "" {
+			words = append(words, initials)
+			initials = ""
+		}
+		words = append(words, w)
+	}
+	if initials != "" {
+		words = append(words, initials)
+	}
+	return strings.Join(words, " ")
+}
@@ -49,6 +49,87 @@ func Test_fix(t *testing.T) {
 			},
 			want: "1984",
 		},
+		{
+			name: "initials with dots",
+			args: args{
+				s:            "J.M.A. Biesheuvel",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "J.M.A. Biesheuvel",
+		},
+		{
+			name: "initials with spaces",
+			args: args{
+				s:            "Tolkien, J. R. R.",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "J.R.R. Tolkien",
+		},
+		{
+			name: "initials without dots",
+			args: args{
+				s:            "J R R Tolkien",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "J.R.R. Tolkien",
+		},
+		{
+			name: "initials against the last name",
+			args: args{
+				s:            "j.r.r.tolkien",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "J.R.R. Tolkien",
+		},
+		{
+			name: "abbreviated first name",
+			args: args{
+				s:            "Th. Hardy",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "Th. Hardy",
+		},
+		{
+			name: "last name first with a suffix",
+			args: args{
+				s:            "King, Stephen, Jr.",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "Stephen King Jr.",
+		},
+		{
+			name: "several authors last name first",
+			args: args{
+				s:            "Preston, Douglas & Child, Lincoln",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "Douglas Preston & Lincoln Child",
+		},
+		{
+			name: "several commas without a suffix",
+			args: args{
+				s:            "Brown, Dan, Clancy, Tom",
+				capitalize:   true,
+				correctOrder: true,
+			},
+			want: "Brown, Dan, Clancy, Tom",
+		},
+		{
+			name: "title with dots",
+			args: args{
+				s:            "mr. mercedes",
+				capitalize:   true,
+				correctOrder: false,
+			},
+			want: "Mr Mercedes",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
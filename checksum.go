@@ -0,0 +1,39 @@
+package booksing
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// PartialMD5 calculates the document checksum the way KOReader does for its progress sync.
+// Instead of hashing the entire file it hashes 1KiB samples at exponentially growing offsets.
+func PartialMD5(bookpath string) (string, error) {
+	f, err := os.Open(bookpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	const step, size = 1024, 1024
+	h := md5.New()
+	buf := make([]byte, size)
+
+	for i := -1; i <= 10; i++ {
+		var offset int64
+		if i >= 0 {
+			offset = int64(step) << (2 * i)
+		}
+		n, err := f.ReadAt(buf, offset)
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				return "", err
+			}
+			break
+		}
+		h.Write(buf[:n])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
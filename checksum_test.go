@@ -0,0 +1,49 @@
+package booksing
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartialMD5(t *testing.T) {
+	dir := t.TempDir()
+
+	small := []byte("a book that is smaller than a single sample")
+	smallPath := filepath.Join(dir, "small.epub")
+	if err := os.WriteFile(smallPath, small, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(small)
+	got, err := PartialMD5(smallPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("PartialMD5() = %v, want %v", got, want)
+	}
+
+	// samples are taken at 0, 1K, 4K, 16K, 64K, ...
+	large := make([]byte, 20*1024)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	largePath := filepath.Join(dir, "large.epub")
+	if err := os.WriteFile(largePath, large, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := md5.New()
+	h.Write(large[0:1024])
+	h.Write(large[1024:2048])
+	h.Write(large[4096:5120])
+	h.Write(large[16384:17408])
+	got, err = PartialMD5(largePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Errorf("PartialMD5() = %v, want %v", got, want)
+	}
+}
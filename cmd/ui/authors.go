@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing"
+	"github.com/sirupsen/logrus"
+)
+
+// showAuthors shows the authors with their aliases, and the names of books that look like spellings of the same author
+func (app *booksingApp) showAuthors(c *gin.Context) {
+	authors, err := app.db.GetAuthors()
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	counts, err := app.db.GetAuthorCounts()
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	c.HTML(200, "authors.html", V{
+		IsAdmin:    c.GetBool("isAdmin"),
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+		Authors:    authors,
+		Spellings:  booksing.AuthorSpellings(counts),
+	})
+}
+
+// mergeAuthors makes the names in the form aliases of the author in name and moves their books to it, names come
+// from the spellings that were picked and from the aliases field with one name per line
+func (app *booksingApp) mergeAuthors(c *gin.Context) {
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		c.HTML(400, "error.html", V{
+			Error: errors.New("no author to merge into"),
+		})
+		return
+	}
+	var names []string
+	for _, n := range append(c.PostFormArray("names"), strings.Split(c.PostForm("aliases"), "\n")...) {
+		if n = strings.TrimSpace(n); n != "" && n != name {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		c.HTML(400, "error.html", V{
+			Error: fmt.Errorf("no names to merge into %s", name),
+		})
+		return
+	}
+
+	err := app.db.MergeAuthors(name, names)
+	if err != nil {
+		app.logger.WithError(err).Error("could not merge authors")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	moved, err := app.moveBooks(name, names)
+	if err != nil {
+		app.logger.WithError(err).Error("could not move books to merged author")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	app.logger.WithFields(logrus.Fields{
+		"author":  name,
+		"aliases": names,
+		"books":   moved,
+	}).Info("merged authors")
+	c.Redirect(302, "/admin/authors")
+}
+
+// moveBooks stores the books of names under name, their hashes follow the new name
+func (app *booksingApp) moveBooks(name string, names []string) (int, error) {
+	books, err := app.db.GetBooksByAuthor(names...)
+	if err != nil {
+		return 0, err
+	}
+	for i := range books {
+		err = books[i].SetField("author", name)
+		if err != nil {
+			return i, err
+		}
+		err = app.db.UpdateBook(&books[i], "author")
+		if err != nil {
+			return i, err
+		}
+	}
+	if len(books) == 0 {
+		return 0, nil
+	}
+	app.recentCache = nil
+	return len(books), app.db.UpdateCompletionIndex()
+}
+
+// deleteAuthorAlias removes an alias, books that were moved because of it keep their new author
+func (app *booksingApp) deleteAuthorAlias(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.HTML(400, "error.html", V{
+			Error: fmt.Errorf("invalid alias %q", c.Param("id")),
+		})
+		return
+	}
+	err = app.db.DeleteAuthorAlias(uint(id))
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	c.Redirect(302, "/admin/authors")
+}
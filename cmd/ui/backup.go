@@ -0,0 +1,425 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing/sqlite"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	backupPrefix = "booksing-"
+	// backupDB is the name of the database inside a bundle
+	backupDB = "booksing.db"
+	// backupEnv holds the configuration in a bundle, as environment variables
+	backupEnv = "booksing.env"
+	// backupCovers is the directory of the covers inside a bundle
+	backupCovers = "covers/"
+)
+
+// backupLock makes sure the schedule and the admin page never write a backup at the same time
+var backupLock sync.Mutex
+
+// backupFile is a single backup in the backup dir
+type backupFile struct {
+	Name    string
+	Size    int64
+	Created time.Time
+}
+
+// backup writes a copy of the database to the backup dir, with bundle it also contains the covers and the configuration.
+// Older backups are removed afterwards so only BackupKeep of them remain.
+func (app *booksingApp) backup(bundle bool) (string, error) {
+	backupLock.Lock()
+	defer backupLock.Unlock()
+	s := app.settings()
+
+	err := os.MkdirAll(s.cfg.BackupDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	name := backupName(s.cfg.BackupDir, time.Now().In(s.timezone))
+	dbPath := filepath.Join(s.cfg.BackupDir, name+".db")
+	err = app.db.Backup(dbPath)
+	if err != nil {
+		return "", err
+	}
+
+	path := dbPath
+	if bundle {
+		path = filepath.Join(s.cfg.BackupDir, name+".tar.gz")
+		err = app.writeBundle(path, dbPath)
+		os.Remove(dbPath)
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+	}
+
+	err = app.pruneBackups()
+	if err != nil {
+		app.logger.WithError(err).Warning("could not remove old backups")
+	}
+	return path, nil
+}
+
+// writeBundle writes a gzipped tarball to path with the database at dbPath, all covers and the configuration
+func (app *booksingApp) writeBundle(path, dbPath string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = addFile(tw, backupDB, dbPath)
+	if err != nil {
+		return err
+	}
+
+	env := app.settings().cfg.environment()
+	err = tw.WriteHeader(&tar.Header{
+		Name:    backupEnv,
+		Mode:    0600,
+		Size:    int64(len(env)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(tw, env)
+	if err != nil {
+		return err
+	}
+
+	bookDir := app.settings().cfg.BookDir
+	err = filepath.WalkDir(bookDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".jpg") {
+			return nil
+		}
+		rel, err := filepath.Rel(bookDir, p)
+		if err != nil {
+			return err
+		}
+		return addFile(tw, backupCovers+filepath.ToSlash(rel), p)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// environment returns the configuration as the environment variables that set it, without the database password and api keys
+func (cfg configuration) environment() string {
+	if u, err := url.Parse(cfg.DatabaseURL); err == nil {
+		cfg.DatabaseURL = u.Redacted()
+	}
+	if cfg.GoogleBooksKey != "" {
+		cfg.GoogleBooksKey = "xxxxx"
+	}
+
+	var b strings.Builder
+	v := reflect.ValueOf(cfg)
+	for i := 0; i < v.NumField(); i++ {
+		value := v.Field(i).Interface()
+		if s, ok := value.([]string); ok {
+			value = strings.Join(s, ",")
+		}
+		fmt.Fprintf(&b, "BOOKSING_%s=%v\n", strings.ToUpper(v.Type().Field(i).Name), value)
+	}
+	return b.String()
+}
+
+// backupName returns the name of a backup made at t without extension. The name has the milliseconds, and a backup
+// that is made in the same millisecond as another gets the next free one, so names stay unique and sort by age.
+func backupName(dir string, t time.Time) string {
+	for {
+		name := backupPrefix + t.Format("20060102-150405.000")
+		_, dbErr := os.Lstat(filepath.Join(dir, name+".db"))
+		_, bundleErr := os.Lstat(filepath.Join(dir, name+".tar.gz"))
+		if os.IsNotExist(dbErr) && os.IsNotExist(bundleErr) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// listBackups returns the backups in the backup dir, newest first
+func (app *booksingApp) listBackups() ([]backupFile, error) {
+	entries, err := os.ReadDir(app.settings().cfg.BackupDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, e := range entries {
+		if e.IsDir() || !isBackup(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backupFile{
+			Name:    e.Name(),
+			Size:    info.Size(),
+			Created: info.ModTime(),
+		})
+	}
+	// the names hold the moment of the backup, so they sort by age
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+func isBackup(name string) bool {
+	return strings.HasPrefix(name, backupPrefix) && (strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".tar.gz"))
+}
+
+// pruneBackups removes all but the newest BackupKeep backups, 0 keeps all of them
+func (app *booksingApp) pruneBackups() error {
+	cfg := app.settings().cfg
+	if cfg.BackupKeep <= 0 {
+		return nil
+	}
+	backups, err := app.listBackups()
+	if err != nil {
+		return err
+	}
+	for i := cfg.BackupKeep; i < len(backups); i++ {
+		err = os.Remove(filepath.Join(cfg.BackupDir, backups[i].Name))
+		if err != nil {
+			return err
+		}
+		app.logger.WithField("file", backups[i].Name).Info("removed old backup")
+	}
+	return nil
+}
+
+// backupLoop makes a backup every BackupInterval until ctx is canceled
+func (app *booksingApp) backupLoop(ctx context.Context) {
+	ticker := time.NewTicker(app.settings().cfg.BackupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		path, err := app.backup(app.settings().cfg.BackupCovers)
+		if err != nil {
+			app.logger.WithError(err).Error("scheduled backup failed")
+			continue
+		}
+		app.logger.WithFields(logrus.Fields{
+			"file": path,
+			"took": time.Since(start).String(),
+		}).Info("database backed up")
+	}
+}
+
+// restore replaces the database with the backup at path, which is either a database or a bundle, and returns where
+// the replaced database is kept, also when restoring the covers of a bundle fails after that. Covers in a bundle are
+// restored next to their books, existing covers are kept.
+func (app *booksingApp) restore(path string) (string, error) {
+	if app.settings().cfg.DatabaseURL != "" {
+		return "", errors.New("booksing does not restore a postgres database, use pg_restore instead")
+	}
+	if !strings.HasSuffix(path, ".tar.gz") {
+		return sqlite.Restore(app.settings().cfg.DatabaseDir, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	tr := tar.NewReader(gz)
+
+	tmp, err := os.MkdirTemp("", "booksing-restore")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	// the database comes first in a bundle, so a backup that can not be restored leaves the covers alone
+	restored := false
+	kept := ""
+	covers := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return kept, err
+		}
+		switch {
+		case hdr.Name == backupDB:
+			dbPath := filepath.Join(tmp, backupDB)
+			err = extractFile(tr, dbPath)
+			if err == nil {
+				kept, err = sqlite.Restore(app.settings().cfg.DatabaseDir, dbPath)
+			}
+			restored = err == nil
+		case strings.HasPrefix(hdr.Name, backupCovers) && restored:
+			// joining with a slash first drops any path traversal from the name
+			rel := filepath.FromSlash(filepath.Join("/", strings.TrimPrefix(hdr.Name, backupCovers)))
+			err = extractFile(tr, filepath.Join(app.settings().cfg.BookDir, rel))
+			if err == nil {
+				covers++
+			}
+			if os.IsExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return kept, err
+		}
+	}
+	if !restored {
+		return "", fmt.Errorf("%s does not contain %s", path, backupDB)
+	}
+	app.logger.WithField("covers", covers).Info("restored covers")
+	return kept, nil
+}
+
+// extractFile writes r to a new file at path
+func extractFile(r io.Reader, path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func (app *booksingApp) showBackups(c *gin.Context) {
+	backups, err := app.listBackups()
+	if err != nil {
+		app.logger.WithError(err).Error("could not list backups")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		c.Abort()
+		return
+	}
+
+	c.HTML(200, "backups.html", V{
+		IsAdmin:    c.GetBool("isAdmin"),
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+		Backups:    backups,
+	})
+}
+
+func (app *booksingApp) createBackup(c *gin.Context) {
+	start := time.Now()
+	path, err := app.backup(c.PostForm("bundle") == "true")
+	if err != nil {
+		app.logger.WithError(err).Error("backup failed")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		c.Abort()
+		return
+	}
+	app.logger.WithFields(logrus.Fields{
+		"file": path,
+		"took": time.Since(start).String(),
+	}).Info("database backed up")
+
+	c.Redirect(302, "/admin/backups")
+}
+
+func (app *booksingApp) downloadBackup(c *gin.Context) {
+	name := c.Param("name")
+	backups, err := app.listBackups()
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		c.Abort()
+		return
+	}
+	// only names from the listing are served, so nothing outside the backup dir can be requested
+	for _, b := range backups {
+		if b.Name == name {
+			c.FileAttachment(filepath.Join(app.settings().cfg.BackupDir, b.Name), b.Name)
+			return
+		}
+	}
+	c.HTML(404, "error.html", V{
+		Error: fmt.Errorf("backup %s does not exist", name),
+	})
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -15,7 +17,6 @@ import (
 	"github.com/gnur/booksing"
 	zglob "github.com/mattn/go-zglob"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -27,10 +28,25 @@ var (
 	locker = stateUnlocked
 )
 
-func (app *booksingApp) refreshLoop() {
+// refreshLoop imports new files every minute, or right away when triggerRefresh asks for it, until ctx is canceled
+func (app *booksingApp) refreshLoop(ctx context.Context) {
+	app.backfillChecksums()
 	for {
-		app.refresh()
-		time.Sleep(time.Minute)
+		app.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.refreshNow:
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// triggerRefresh makes the refresh loop import right away instead of at its next minute
+func (app *booksingApp) triggerRefresh() {
+	select {
+	case app.refreshNow <- struct{}{}:
+	default:
 	}
 }
 
@@ -56,17 +72,27 @@ func (app *booksingApp) cover(c *gin.Context) {
 
 func (app *booksingApp) downloadBook(c *gin.Context) {
 
-	hash := c.Query("hash")
+	id := c.Query("id")
 	file := c.Query("file")
+	if id == "" {
+		id = c.Query("hash")
+	}
 
-	book, err := app.db.GetBook(hash)
+	book, legacy, err := app.findBook(id)
 	if err != nil {
 		app.logger.WithFields(logrus.Fields{
-			"err":  err,
-			"hash": hash,
+			"err": err,
+			"id":  id,
 		}).Error("could not find book")
 		return
 	}
+	if legacy {
+		q := c.Request.URL.Query()
+		q.Del("hash")
+		q.Set("id", strconv.FormatUint(uint64(book.ID), 10))
+		c.Redirect(301, "/download?"+q.Encode())
+		return
+	}
 	user := c.MustGet("id")
 	username := user.(*booksing.User).Name
 
@@ -74,7 +100,7 @@ func (app *booksingApp) downloadBook(c *gin.Context) {
 	dl := booksing.Download{
 		User:      username,
 		IP:        ip,
-		Book:      book.Hash,
+		BookID:    book.ID,
 		Timestamp: time.Now(),
 	}
 	err = app.db.AddDownload(dl)
@@ -85,7 +111,8 @@ func (app *booksingApp) downloadBook(c *gin.Context) {
 	_, err = app.slev.NewEvent("booksing", "booksing.download", gin.H{
 		"user": username,
 		"ip":   ip,
-		"hash": hash,
+		"id":   book.ID,
+		"hash": book.Hash,
 	})
 	if err != nil {
 		app.logger.WithField("err", err).Error("unable to store slev event")
@@ -104,6 +131,26 @@ func (app *booksingApp) downloadBook(c *gin.Context) {
 	}
 }
 
+// findBook returns the book with the id in s. Before books had an id urls held the hash of a book, for those
+// the first book of the work is returned with legacy set, also when the hash has changed since.
+func (app *booksingApp) findBook(s string) (b *booksing.Book, legacy bool, err error) {
+	if id, err := strconv.ParseUint(s, 10, 0); err == nil {
+		b, err := app.db.GetBook(uint(id))
+		if !errors.Is(err, booksing.ErrNotFound) {
+			return b, false, err
+		}
+	}
+
+	b, err = app.db.GetBookByHash(s)
+	if errors.Is(err, booksing.ErrNotFound) {
+		current, aliasErr := app.db.ResolveHash(s)
+		if aliasErr == nil {
+			b, err = app.db.GetBookByHash(current)
+		}
+	}
+	return b, err == nil, err
+}
+
 func (app *booksingApp) updateUser(c *gin.Context) {
 	id := c.Param("username")
 	dbUser, err := app.db.GetUser(id)
@@ -138,7 +185,8 @@ func (app *booksingApp) updateUser(c *gin.Context) {
 	c.Redirect(302, c.Request.Referer())
 }
 
-func (app *booksingApp) refresh() {
+// refresh imports the files in the import dir that were not imported before, until they are done or ctx is canceled
+func (app *booksingApp) refresh(ctx context.Context) {
 	if !atomic.CompareAndSwapUint32(&locker, stateUnlocked, stateLocked) {
 		app.logger.Warning("not refreshing because it is already running")
 		return
@@ -154,97 +202,120 @@ func (app *booksingApp) refresh() {
 		app.logger.WithField("err", err).Error("glob of all books failed")
 		return
 	}
+	matches = app.newFiles(matches)
 
 	if len(matches) == 0 {
 		app.logger.Debug("Not adding any books because nothing is new")
 		return
 	}
-	var books []booksing.Book
-	counter := 0
+
+	opts := app.settings().importOptions
+	opts.AuthorAliases, err = app.db.GetAuthorAliases()
+	if err != nil {
+		app.logger.WithError(err).Error("could not load author aliases, authors are stored as they are spelled")
+	}
+	uploads := app.pendingUploads()
+
+	job := &booksing.ImportJob{Started: time.Now().In(app.settings().timezone), Found: len(matches)}
+	err = app.db.SaveImportJob(job)
+	if err != nil {
+		app.logger.WithError(err).Error("could not store import job, its outcome is only logged")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	app.imports.start(job, cancel)
+	defer func() {
+		app.finishImport(ctx.Err() != nil)
+	}()
 
 	app.logger.WithFields(logrus.Fields{
 		"total":   len(matches),
 		"bookdir": app.importDir,
 	}).Info("located books on filesystem, processing per batchsize")
-	ctx := context.TODO()
-	toProcess := len(matches)
-	bookQ := make(chan *booksing.Book)
-	sem := semaphore.NewWeighted(int64(runtime.GOMAXPROCS(0)))
-
-	for _, filename := range matches {
-		app.logger.WithField("f", filename).Debug("parsing book")
-
-		go func(f string) {
-			if err := sem.Acquire(ctx, 1); err != nil {
-				app.logger.WithError(err).Error("failed to acquire semaphore")
-			}
-			defer sem.Release(1)
 
-			book, err := booksing.NewBookFromFile(f, app.bookDir)
+	im := importer{
+		workers:   runtime.GOMAXPROCS(0),
+		batchSize: 50,
+		parse: func(path string) (*booksing.Book, error) {
+			book, err := booksing.NewBookFromFile(path, app.bookDir, opts)
 			if err != nil {
-				app.logger.WithError(err).Error("Failed to parse book")
-				app.moveBookToFailed(f)
+				app.logger.WithError(err).WithField("path", path).Error("Failed to parse book")
 			}
-
-			bookQ <- book
-		}(filename)
-
-	}
-	processed := 0
-	for book := range bookQ {
-		processed++
-		if book == nil {
-			if processed == toProcess {
-				close(bookQ)
+			return book, err
+		},
+		filter: app.filterBook,
+		organize: func(b *booksing.Book) {
+			if u, ok := uploads[b.Path]; ok {
+				b.UploadedBy = u.Uploader
 			}
-			continue
-		}
-		if !app.keepBook(book) {
-			app.moveBookToFailed(book.Path)
-			if processed == toProcess {
-				close(bookQ)
-			}
-			continue
-		}
-		books = append(books, *book)
-		counter++
-		if len(books) == 50 || processed == toProcess {
-			err = app.db.AddBooks(books)
+		},
+		persist: func(books []booksing.Book) ([]booksing.Book, error) {
+			added, err := app.db.AddBooks(books)
 			if err != nil {
-				app.logger.WithFields(logrus.Fields{
-					"err": err,
-				}).Warning("bulk insert failed")
+				app.logger.WithError(err).Warning("bulk insert failed")
 			}
-			books = []booksing.Book{}
-		}
-		app.logger.WithField("counter", counter).Debug("Found some books")
-		if processed == toProcess {
-			close(bookQ)
-		}
-
+			return added, err
+		},
+		outcome: func(path string, o booksing.ImportOutcome, message string, took time.Duration, book uint) {
+			app.importOutcome(uploads, path, o, message, took, book)
+		},
+		parsed:  app.imports.parsed,
+		discard: app.moveBookToFailed,
+		flush:   app.flushImport,
 	}
-	if len(books) > 0 {
-		app.logger.Error("This should absolutely not happen")
-		err = app.db.AddBooks(books)
+	im.run(ctx, matches)
+	if ctx.Err() != nil {
+		app.logger.Info("import was stopped, the files that are left are imported next time")
+	}
+
+	if len(uploads) > 0 {
+		err = app.db.FinishUploads()
 		if err != nil {
-			app.logger.WithFields(logrus.Fields{
-				"reason": "bulk insert failed",
-				"err":    err,
-			}).Info("bulk insert failed")
+			app.logger.WithError(err).Error("could not store the results of uploads")
 		}
 	}
 
 	app.logger.Info("Done with refresh")
 	app.recentCache = nil
 
+	err = app.db.GroupWorks()
+	if err != nil {
+		app.logger.WithError(err).Error("could not group editions into works")
+	}
+	err = app.db.UpdateSpellingIndex()
+	if err != nil {
+		app.logger.WithError(err).Error("could not update spelling suggestions")
+	}
+	err = app.db.UpdateCompletionIndex()
+	if err != nil {
+		app.logger.WithError(err).Error("could not update search completions")
+	}
+
 	//move none epub files to failed dir
 
 	//remove empty directories
 
 }
 
+// filterBook returns why the import does not keep b and the book it is a copy of, an empty outcome keeps it
+func (app *booksingApp) filterBook(b *booksing.Book) (booksing.ImportOutcome, string, uint) {
+	if !app.keepBook(b) {
+		return booksing.ImportRejected, "the book is too large or not in an accepted language", 0
+	}
+	// a copy of a file that is already stored elsewhere is not another edition
+	if dup, err := app.db.GetBookByChecksum(b.Checksum); err == nil && dup.Path != b.Path {
+		app.logger.WithFields(logrus.Fields{
+			"path":     b.Path,
+			"original": dup.Path,
+		}).Debug("skipping a copy of a stored book")
+		return booksing.ImportDuplicate, "a copy of " + dup.Title + " by " + dup.Author, dup.ID
+	}
+	return "", "", 0
+}
+
 func (app *booksingApp) moveBookToFailed(bookpath string) {
-	err := os.MkdirAll(app.cfg.FailDir, 0755)
+	failDir := app.settings().cfg.FailDir
+	err := os.MkdirAll(failDir, 0755)
 	if err != nil {
 		app.logger.WithError(err).Error("unable to create fail dir")
 		return
@@ -259,11 +330,11 @@ func (app *booksingApp) moveBookToFailed(bookpath string) {
 
 	for _, f := range files {
 		filename := path.Base(f)
-		newBookPath := path.Join(app.cfg.FailDir, filename)
+		newBookPath := path.Join(failDir, filename)
 		err = os.Rename(bookpath, newBookPath)
 		if err != nil {
 			app.logger.WithFields(logrus.Fields{
-				"faildir": app.cfg.FailDir,
+				"faildir": failDir,
 				"book":    bookpath,
 			}).WithError(err).Error("unable to move book to faildir")
 		}
@@ -281,7 +352,7 @@ func (app *booksingApp) addUser(c *gin.Context) {
 		return
 	}
 
-	u.Created = time.Now().In(app.timezone)
+	u.Created = time.Now().In(app.settings().timezone)
 	err := app.db.SaveUser(&u)
 	if err != nil {
 		app.logger.WithField("err", err).Error("Could not update user")
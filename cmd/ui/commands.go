@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gnur/booksing/metadata"
+	"github.com/sirupsen/logrus"
+)
+
+// command is a maintenance task that can be run instead of the server
+type command struct {
+	help string
+	// offline commands run without opening the database
+	offline bool
+	// unmigrated commands get the database without applying the pending migrations first
+	unmigrated bool
+	run        func(app *booksingApp, args []string) error
+}
+
+// commands are the maintenance tasks by name, like `booksing rebuild-index`
+var commands = map[string]command{
+	"backup": {
+		help: "write a backup of the database to the backup dir, -bundle adds the covers and the configuration",
+		run: func(app *booksingApp, args []string) error {
+			flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+			bundle := flags.Bool("bundle", app.settings().cfg.BackupCovers, "include the covers and the configuration")
+			err := flags.Parse(args)
+			if err != nil {
+				return err
+			}
+
+			start := time.Now()
+			path, err := app.backup(*bundle)
+			if err != nil {
+				return err
+			}
+			app.logger.WithFields(logrus.Fields{
+				"file": path,
+				"took": time.Since(start).String(),
+			}).Info("database backed up")
+			return nil
+		},
+	},
+	"enrich": {
+		help: "look up the books that miss an author, title, description or isbn in the metadata providers",
+		run: func(app *booksingApp, args []string) error {
+			flags := flag.NewFlagSet("enrich", flag.ContinueOnError)
+			limit := flags.Int("limit", 0, "look up at most this many books, 0 looks up all of them")
+			delay := flags.Duration("delay", time.Second, "wait this long between books, to be gentle on the catalogs")
+			err := flags.Parse(args)
+			if err != nil {
+				return err
+			}
+			if len(app.settings().providers) == 0 {
+				return errors.New("no metadata providers are configured, set BOOKSING_METADATAPROVIDERS")
+			}
+
+			books, err := app.db.GetIncompleteBooks()
+			if err != nil {
+				return err
+			}
+			if *limit > 0 && len(books) > *limit {
+				books = books[:*limit]
+			}
+			start := time.Now()
+			var filled, proposals, missing int
+			for i := range books {
+				if i > 0 {
+					time.Sleep(*delay)
+				}
+				f, p, err := app.enrich(context.Background(), &books[i])
+				if errors.Is(err, metadata.ErrNotFound) {
+					missing++
+					continue
+				}
+				if err != nil {
+					app.logger.WithError(err).WithField("id", books[i].ID).Warning("could not look up metadata")
+					continue
+				}
+				if len(f) > 0 {
+					filled++
+				}
+				proposals += p
+			}
+			app.logger.WithFields(logrus.Fields{
+				"books":     len(books),
+				"filled":    filled,
+				"proposals": proposals,
+				"not found": missing,
+				"took":      time.Since(start).String(),
+			}).Info("books enriched")
+			return nil
+		},
+	},
+	"migrate": {
+		help:       "apply the pending schema migrations and list all of them, -dry-run only lists them",
+		unmigrated: true,
+		run: func(app *booksingApp, args []string) error {
+			flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+			dryRun := flags.Bool("dry-run", false, "list the migrations without applying any")
+			err := flags.Parse(args)
+			if err != nil {
+				return err
+			}
+
+			if !*dryRun {
+				start := time.Now()
+				err = app.db.Migrate()
+				if err != nil {
+					return err
+				}
+				app.logger.WithField("took", time.Since(start).String()).Info("database migrated")
+			}
+
+			statuses, err := app.db.Migrations()
+			if err != nil {
+				return err
+			}
+			for _, s := range statuses {
+				applied := "pending"
+				if !s.Applied.IsZero() {
+					applied = "applied " + s.Applied.In(app.settings().timezone).Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("%04d %-20s %s\n", s.Version, s.Name, applied)
+			}
+			return nil
+		},
+	},
+	"rebuild-index": {
+		help: "repopulate the full text search index and the suggestions from the books table",
+		run: func(app *booksingApp, args []string) error {
+			start := time.Now()
+			err := app.db.RebuildSearchIndex()
+			if err != nil {
+				return err
+			}
+			app.logger.WithField("took", time.Since(start).String()).Info("search index rebuilt")
+			return nil
+		},
+	},
+	"rehash": {
+		help: "recompute the hash of every book, merge books that turn out to be the same and keep the old hashes as aliases",
+		run: func(app *booksingApp, args []string) error {
+			start := time.Now()
+			res, err := app.db.Rehash()
+			if err != nil {
+				return err
+			}
+			app.logger.WithFields(logrus.Fields{
+				"rehashed": res.Rehashed,
+				"merged":   res.Merged,
+				"took":     time.Since(start).String(),
+			}).Info("books rehashed")
+			return nil
+		},
+	},
+	"tag": {
+		help: "give the books without tags the tags of the subjects in their files",
+		run: func(app *booksingApp, args []string) error {
+			start := time.Now()
+			tagged, err := app.tagBooks()
+			if err != nil {
+				return err
+			}
+			app.logger.WithFields(logrus.Fields{
+				"tagged": tagged,
+				"took":   time.Since(start).String(),
+			}).Info("books tagged")
+			return nil
+		},
+	},
+	"restore": {
+		help:    "replace the database with a backup or bundle, booksing has to be stopped first",
+		offline: true,
+		run: func(app *booksingApp, args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: booksing restore <backup file>")
+			}
+			kept, err := app.restore(args[0])
+			if err != nil && kept != "" {
+				return fmt.Errorf("%w, the replaced database is kept as %s", err, kept)
+			}
+			if err != nil {
+				return err
+			}
+			app.logger.WithFields(logrus.Fields{
+				"file": args[0],
+				"kept": kept,
+			}).Info("database restored")
+			return nil
+		},
+	},
+}
+
+// findCommand returns the maintenance command called name, or prints the usage when there is none
+func findCommand(name string) (command, error) {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Println("usage: booksing [command]")
+		fmt.Println()
+		fmt.Println("without a command booksing starts the server, available commands:")
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %-16s %s\n", name, commands[name].help)
+		}
+		return cmd, fmt.Errorf("unknown command %q", name)
+	}
+	return cmd, nil
+}
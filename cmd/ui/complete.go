@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+const completionLimit = 5
+
+// complete suggests authors, series and titles for a partially typed search,
+// as an html fragment for the search box or as json for other clients
+func (app *booksingApp) complete(c *gin.Context) {
+	completions, err := app.db.Complete(c.Query("q"), completionLimit)
+	if err != nil {
+		app.logger.WithError(err).Error("could not complete search")
+		c.JSON(500, gin.H{
+			"text": "could not complete search",
+		})
+		return
+	}
+
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(200, completions)
+		return
+	}
+	c.HTML(200, "completions", completions)
+}
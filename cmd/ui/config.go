@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/metadata"
+	"github.com/kelseyhightower/envconfig"
+	log "github.com/sirupsen/logrus"
+)
+
+// configFileVar names a file with more configuration, it is read again on every reload
+const configFileVar = "BOOKSING_CONFIGFILE"
+
+type configuration struct {
+	AcceptedLanguages []string      `default:""`
+	AdminUser         string        `default:"unknown"`
+	AllowAllusers     bool          `default:"true"`
+	BackupCovers      bool          `default:"false"`
+	BackupDir         string        `default:"./backups/"`
+	BackupInterval    time.Duration `default:"0"`
+	BackupKeep        int           `default:"7"`
+	BindAddress       string        `default:":7132"`
+	BookDir           string        `default:"./books/"`
+	Capitalize        []string      `default:"title,author"`
+	EventsPort        string        `default:":8821"`
+	DatabaseDir       string        `default:"./db/"`
+	DatabaseURL       string        `default:""`
+	FailDir           string        `default:"./failed"`
+	FilenamePatterns  []string      `default:"series,author-first,title-first,underscore"`
+	GoogleBooksKey    string        `default:""`
+	ImportDir         string        `default:"./import"`
+	LogLevel          string        `default:"info"`
+	MaxSize           int64         `default:"0"`
+	MetadataFill      bool          `default:"true"`
+	MetadataProviders []string      `default:""`
+	TemplateDir       string        `default:""`
+	Timezone          string        `default:"Europe/Amsterdam"`
+	UserHeader        string        `default:""`
+}
+
+// restartFields are the settings that booksing only takes on when it starts, a reload keeps their value
+var restartFields = []string{"BackupInterval", "BindAddress", "BookDir", "DatabaseDir", "DatabaseURL", "EventsPort", "ImportDir"}
+
+// settings are the configuration and what is made of it. They are replaced as a whole on a reload, so read them
+// through app.settings() and never change them.
+type settings struct {
+	cfg       configuration
+	timezone  *time.Location
+	logLevel  log.Level
+	templates *template.Template
+	// providers are the external catalogs books are looked up in, in the order they are asked
+	providers []metadata.Provider
+	// importOptions are how imported files are read, the author aliases are loaded for every import
+	importOptions booksing.ImportOptions
+	// loaded is when the settings were read
+	loaded time.Time
+}
+
+// configLoader reads the settings from the environment and the config file. The variables in the config file win from
+// the environment booksing was started with, a variable that is removed from the file gets its old value back.
+type configLoader struct {
+	started  map[string]string
+	fromFile map[string]string
+}
+
+func newConfigLoader() *configLoader {
+	l := &configLoader{started: make(map[string]string)}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		l.started[k] = v
+	}
+	return l
+}
+
+// file returns the path of the config file, empty when there is none
+func (l *configLoader) file() string {
+	return l.started[configFileVar]
+}
+
+// load reads the settings, a configuration that is rejected leaves the environment as it was
+func (l *configLoader) load() (*settings, error) {
+	if l.file() == "" {
+		return parseSettings()
+	}
+	vars, err := readConfigFile(l.file())
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+	undo := l.setFileVars(vars)
+	s, err := parseSettings()
+	if err != nil {
+		undo()
+		return nil, err
+	}
+	return s, nil
+}
+
+// setFileVars sets the variables of the config file in the environment and returns a func that sets them back
+func (l *configLoader) setFileVars(vars map[string]string) func() {
+	before := make(map[string]*string)
+	set := func(k string, v *string) {
+		if _, ok := before[k]; !ok {
+			if old, ok := os.LookupEnv(k); ok {
+				before[k] = &old
+			} else {
+				before[k] = nil
+			}
+		}
+		if v != nil {
+			os.Setenv(k, *v)
+		} else {
+			os.Unsetenv(k)
+		}
+	}
+
+	for k := range l.fromFile {
+		if _, ok := vars[k]; ok {
+			continue
+		}
+		if v, ok := l.started[k]; ok {
+			set(k, &v)
+		} else {
+			set(k, nil)
+		}
+	}
+	for k, v := range vars {
+		v := v
+		set(k, &v)
+	}
+	fromFile := l.fromFile
+	l.fromFile = vars
+
+	return func() {
+		for k, v := range before {
+			if v != nil {
+				os.Setenv(k, *v)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+		l.fromFile = fromFile
+	}
+}
+
+// parseSettings reads the settings from the environment
+func parseSettings() (*settings, error) {
+	s := settings{loaded: time.Now(), logLevel: log.InfoLevel}
+	err := envconfig.Process("booksing", &s.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse full config from environment: %w", err)
+	}
+	cfg := &s.cfg
+
+	// books are kept when their normalized language is accepted, so nld and dutch work as well as nl
+	for i, lang := range cfg.AcceptedLanguages {
+		cfg.AcceptedLanguages[i] = booksing.FixLang(lang)
+	}
+
+	if level, err := log.ParseLevel(cfg.LogLevel); err == nil {
+		s.logLevel = level
+	}
+
+	s.timezone, err = time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("could not load timezone: %w", err)
+	}
+
+	s.providers, err = metadataProviders(*cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata providers: %w", err)
+	}
+
+	s.importOptions.FilenamePatterns, err = booksing.ParseFilenamePatterns(cfg.FilenamePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename patterns: %w", err)
+	}
+	for _, field := range cfg.Capitalize {
+		if field != "" && !contains(booksing.CapitalizeFields, field) {
+			return nil, fmt.Errorf("%s can not be capitalized, use any of %s", field, strings.Join(booksing.CapitalizeFields, ","))
+		}
+	}
+	s.importOptions.Capitalize = cfg.Capitalize
+
+	s.templates, err = parseTemplates(cfg.TemplateDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read templates: %w", err)
+	}
+
+	return &s, nil
+}
+
+// keepRestartFields sets the restart fields of s to their value in old and returns the variables of the ones that
+// changed
+func (s *settings) keepRestartFields(old configuration) []string {
+	var changed []string
+	cfg := reflect.ValueOf(&s.cfg).Elem()
+	was := reflect.ValueOf(old)
+	for _, name := range restartFields {
+		if !reflect.DeepEqual(cfg.FieldByName(name).Interface(), was.FieldByName(name).Interface()) {
+			changed = append(changed, "BOOKSING_"+strings.ToUpper(name))
+		}
+		cfg.FieldByName(name).Set(was.FieldByName(name))
+	}
+	return changed
+}
+
+// readConfigFile reads lines of KEY=value like an environment file of systemd or docker. Empty lines and lines
+// starting with # are skipped and quotes around a value are removed.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(text, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s:%d is not KEY=value", path, line)
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		vars[k] = v
+	}
+	return vars, scanner.Err()
+}
+
+// parseTemplates reads the templates that are built in and then the ones in dir, a template in dir replaces the
+// built in template with the same name
+func parseTemplates(dir string) (*template.Template, error) {
+	tpl, err := template.New("").Funcs(templateFunctions).ParseFS(templateFiles, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return tpl, nil
+	}
+	return tpl.ParseFS(os.DirFS(dir), "*.html")
+}
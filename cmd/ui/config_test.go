@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestConfigLoader(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "booksing.env")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the loader sets the variables of the file, they are restored when the test ends
+	for _, k := range []string{"BOOKSING_LOGLEVEL", "BOOKSING_BOOKDIR"} {
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+	t.Setenv("BOOKSING_TIMEZONE", "UTC")
+	t.Setenv("BOOKSING_MAXSIZE", "10")
+	t.Setenv(configFileVar, file)
+
+	write("# booksing\nBOOKSING_MAXSIZE=20\n\nBOOKSING_LOGLEVEL='debug'\nBOOKSING_BOOKDIR=\"/books\"\n")
+	l := newConfigLoader()
+	first, err := l.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if first.cfg.MaxSize != 20 || first.logLevel != log.DebugLevel || first.cfg.BookDir != "/books" {
+		t.Errorf("load() = %d, %s, %s, want the values of the config file", first.cfg.MaxSize, first.logLevel, first.cfg.BookDir)
+	}
+
+	write("BOOKSING_BOOKDIR=/other\n")
+	second, err := l.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if second.cfg.MaxSize != 10 || second.logLevel != log.InfoLevel {
+		t.Errorf("load() = %d, %s, want the environment back for the variables removed from the file", second.cfg.MaxSize, second.logLevel)
+	}
+	restart := second.keepRestartFields(first.cfg)
+	if !reflect.DeepEqual(restart, []string{"BOOKSING_BOOKDIR"}) || second.cfg.BookDir != "/books" {
+		t.Errorf("keepRestartFields() = %v with book dir %s, want BOOKSING_BOOKDIR kept at /books", restart, second.cfg.BookDir)
+	}
+
+	write("BOOKSING_MAXSIZE\n")
+	if _, err := l.load(); err == nil {
+		t.Errorf("load() of a line without a value succeeded, want an error")
+	}
+	write("BOOKSING_TIMEZONE=Nowhere/Atlantis\nBOOKSING_MAXSIZE=30\n")
+	if _, err := l.load(); err == nil {
+		t.Errorf("load() of an unknown timezone succeeded, want an error")
+	}
+	// a rejected file changes nothing, the variables of the file that was loaded last are still set
+	if tz, size, dir := os.Getenv("BOOKSING_TIMEZONE"), os.Getenv("BOOKSING_MAXSIZE"), os.Getenv("BOOKSING_BOOKDIR"); tz != "UTC" || size != "10" || dir != "/other" {
+		t.Errorf("environment after a rejected load = %s, %s, %s, want UTC, 10 and /other", tz, size, dir)
+	}
+	write("BOOKSING_LOGLEVEL=warn\n")
+	third, err := l.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if third.cfg.BookDir != "./books/" || third.logLevel != log.WarnLevel {
+		t.Errorf("load() = %s, %s, want the variables of the file loaded last removed", third.cfg.BookDir, third.logLevel)
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{define "error.html"}}custom {{.Q}}{{end}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := parseTemplates(dir)
+	if err != nil {
+		t.Fatalf("parseTemplates() error = %v", err)
+	}
+	var b strings.Builder
+	if err := tpl.ExecuteTemplate(&b, "error.html", V{Q: "search"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != "custom search" {
+		t.Errorf("error.html = %q, want the template from the template dir", got)
+	}
+	if tpl.Lookup("search.html") == nil {
+		t.Errorf("the built in templates are gone")
+	}
+}
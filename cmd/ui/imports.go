@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing"
+	"github.com/sirupsen/logrus"
+)
+
+// shownImports is how many import jobs the imports page lists
+const shownImports = 50
+
+// importTracker follows the running import job, refresh reports to it and the imports page and /status read it
+type importTracker struct {
+	mu  sync.Mutex
+	job *booksing.ImportJob
+	// files are the outcomes that are not stored yet
+	files []booksing.ImportFile
+	// cancel stops the running job
+	cancel context.CancelFunc
+}
+
+func (t *importTracker) start(job *booksing.ImportJob, cancel context.CancelFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.job = job
+	t.files = nil
+	t.cancel = cancel
+}
+
+// stop cancels the running job, it reports whether a job was running
+func (t *importTracker) stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job == nil {
+		return false
+	}
+	t.cancel()
+	return true
+}
+
+// parsed counts a file that could be read
+func (t *importTracker) parsed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job != nil {
+		t.job.Parsed++
+	}
+}
+
+// outcome records what the import made of the file at path
+func (t *importTracker) outcome(path string, o booksing.ImportOutcome, message string, took time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job == nil {
+		return
+	}
+	t.job.Count(o)
+	t.files = append(t.files, booksing.ImportFile{
+		ImportJobID: t.job.ID,
+		Path:        path,
+		Outcome:     o,
+		Message:     message,
+		Took:        took,
+	})
+}
+
+// running returns a copy of the running job, or nil when no import runs
+func (t *importTracker) running() *booksing.ImportJob {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job == nil {
+		return nil
+	}
+	j := *t.job
+	return &j
+}
+
+// flush returns a copy of the running job with the outcomes since the last flush, it is nil when no import runs
+func (t *importTracker) flush() (*booksing.ImportJob, []booksing.ImportFile) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job == nil {
+		return nil, nil
+	}
+	j, files := *t.job, t.files
+	t.files = nil
+	return &j, files
+}
+
+// finish marks the running job as finished, or as stopped before it was done, and returns it with the outcomes of
+// its files that were not flushed
+func (t *importTracker) finish(stopped bool) (*booksing.ImportJob, []booksing.ImportFile) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	j, files := t.job, t.files
+	t.job, t.files, t.cancel = nil, nil, nil
+	if j != nil {
+		j.Finished = time.Now().In(j.Started.Location())
+		j.Stopped = stopped
+	}
+	return j, files
+}
+
+// newFiles returns the files in matches that were not imported before
+func (app *booksingApp) newFiles(matches []string) []string {
+	imported, err := app.db.GetImportedPaths()
+	if err != nil {
+		app.logger.WithError(err).Error("could not load the imported files, every file is imported again")
+		return matches
+	}
+	var files []string
+	for _, m := range matches {
+		if !imported[m] {
+			files = append(files, m)
+		}
+	}
+	return files
+}
+
+// importOutcome records what the import made of the file at path, for the import job and for the upload of the file
+func (app *booksingApp) importOutcome(uploads map[string]booksing.Upload, path string, o booksing.ImportOutcome, message string, took time.Duration, book uint) {
+	app.imports.outcome(path, o, message, took)
+	// added uploads get their book when the whole import is done, skipped uploads stay pending for the next import
+	if o != booksing.ImportAdded && o != booksing.ImportSkipped {
+		app.uploadResult(uploads, path, booksing.UploadStatus(o), message, book)
+	}
+}
+
+// flushImport stores the counters of the running import job and the outcomes since the last flush, so an import that
+// is cut short keeps what it did
+func (app *booksingApp) flushImport() {
+	job, files := app.imports.flush()
+	if job != nil {
+		app.storeImport(job, files)
+	}
+}
+
+// finishImport stores the running import job with the outcomes of its files
+func (app *booksingApp) finishImport(stopped bool) {
+	job, files := app.imports.finish(stopped)
+	if job == nil {
+		return
+	}
+	app.logger.WithFields(logrus.Fields{
+		"stopped":   job.Stopped,
+		"found":     job.Found,
+		"parsed":    job.Parsed,
+		"added":     job.Added,
+		"duplicate": job.Duplicate,
+		"rejected":  job.Rejected,
+		"failed":    job.Failed,
+		"skipped":   job.Skipped,
+		"took":      job.Took().String(),
+	}).Info("import finished")
+	app.storeImport(job, files)
+}
+
+func (app *booksingApp) storeImport(job *booksing.ImportJob, files []booksing.ImportFile) {
+	if job.ID == 0 {
+		return
+	}
+	err := app.db.AddImportFiles(files)
+	if err != nil {
+		app.logger.WithError(err).Error("could not store the outcomes of imported files")
+	}
+	err = app.db.SaveImportJob(job)
+	if err != nil {
+		app.logger.WithError(err).Error("could not store import job")
+	}
+}
+
+// stopUnfinishedImports marks the import jobs that were running when booksing died as stopped
+func (app *booksingApp) stopUnfinishedImports() {
+	n, err := app.db.StopUnfinishedImports()
+	if err != nil {
+		app.logger.WithError(err).Error("could not mark unfinished imports as stopped")
+		return
+	}
+	if n > 0 {
+		app.logger.WithField("jobs", n).Info("marked imports that did not finish as stopped")
+	}
+}
+
+// importStatus returns the running import job, or the last one when none runs, as /status and the imports page
+// show it. It is nil when nothing was ever imported.
+func (app *booksingApp) importStatus() gin.H {
+	job, running := app.imports.running(), true
+	if job == nil {
+		running = false
+		jobs, err := app.db.GetImportJobs(1)
+		if err != nil || len(jobs) == 0 {
+			return nil
+		}
+		job = &jobs[0]
+	}
+	status := gin.H{
+		"id":        job.ID,
+		"running":   running,
+		"started":   job.Started,
+		"found":     job.Found,
+		"parsed":    job.Parsed,
+		"added":     job.Added,
+		"duplicate": job.Duplicate,
+		"rejected":  job.Rejected,
+		"failed":    job.Failed,
+		"skipped":   job.Skipped,
+		"done":      job.Done(),
+		"took":      job.Took().Round(time.Second).String(),
+		"stopped":   job.Stopped,
+	}
+	if running {
+		status["remaining"] = job.Remaining().Round(time.Second).String()
+	} else if !job.Finished.IsZero() {
+		status["finished"] = job.Finished
+	}
+	return status
+}
+
+// showImports lists the latest import jobs, the running job is updated live through importEvents
+func (app *booksingApp) showImports(c *gin.Context) {
+	jobs, err := app.db.GetImportJobs(shownImports)
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	c.HTML(200, "imports.html", V{
+		IsAdmin:    true,
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+		ImportJobs: jobs,
+		ImportJob:  app.imports.running(),
+	})
+}
+
+// showImport shows an import job with the outcome of every file it found
+func (app *booksingApp) showImport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.HTML(400, "error.html", V{
+			Error: fmt.Errorf("invalid import %q", c.Param("id")),
+		})
+		return
+	}
+	job, files, err := app.db.GetImportJob(uint(id))
+	if errors.Is(err, booksing.ErrNotFound) {
+		c.HTML(404, "error.html", V{
+			Error: fmt.Errorf("there is no import %d", id),
+		})
+		return
+	}
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	if running := app.imports.running(); running != nil && running.ID == job.ID {
+		job = running
+	}
+
+	c.HTML(200, "import.html", V{
+		IsAdmin:     true,
+		TotalBooks:  app.db.GetBookCount(),
+		Indexing:    app.state == "indexing",
+		ImportJob:   job,
+		ImportFiles: files,
+	})
+}
+
+// importEvents streams the progress of the import as server-sent events, every second until the client leaves
+func (app *booksingApp) importEvents(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.SSEvent("progress", app.importStatus())
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-app.stopping:
+			// the stream would hold up the shutdown until it times out
+			return false
+		case <-ticker.C:
+			c.SSEvent("progress", app.importStatus())
+			return true
+		}
+	})
+}
+
+// stopImport cancels the running import, the books that were read already are still stored
+func (app *booksingApp) stopImport(c *gin.Context) {
+	if app.imports.stop() {
+		app.logger.Info("import stopped by an admin")
+	}
+	c.Redirect(302, "/admin/imports")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gnur/booksing"
+)
+
+func TestImportTracker(t *testing.T) {
+	var tracker importTracker
+	if tracker.running() != nil {
+		t.Fatalf("running() before an import = %+v, want nil", tracker.running())
+	}
+	tracker.outcome("/import/lost.epub", booksing.ImportAdded, "", 0)
+
+	if tracker.stop() {
+		t.Errorf("stop() without an import = true, want false")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.start(&booksing.ImportJob{ID: 7, Started: time.Now(), Found: 100}, cancel)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%10 == 0 {
+				tracker.outcome("/import/broken.epub", booksing.ImportFailed, "not a zip", time.Millisecond)
+				return
+			}
+			tracker.parsed()
+			tracker.outcome("/import/book.epub", booksing.ImportAdded, "", time.Millisecond)
+		}(i)
+	}
+	wg.Wait()
+
+	running := tracker.running()
+	if running == nil || running.Parsed != 90 || running.Added != 90 || running.Failed != 10 {
+		t.Fatalf("running() = %+v, want 90 books read and added and 10 failed", running)
+	}
+	running.Added = 0
+	if tracker.running().Added != 90 {
+		t.Errorf("running() returned the job itself, want a copy")
+	}
+
+	flushed, files := tracker.flush()
+	if flushed == nil || flushed.ID != 7 || flushed.Added != 90 || len(files) != 100 || files[0].ImportJobID != 7 {
+		t.Fatalf("flush() = %+v with %d files, want the running job with the outcomes of its 100 files", flushed, len(files))
+	}
+	if _, files := tracker.flush(); len(files) != 0 {
+		t.Errorf("flush() a second time returned %d files, want none", len(files))
+	}
+	tracker.outcome("/import/last.epub", booksing.ImportAdded, "", time.Millisecond)
+
+	if !tracker.stop() || ctx.Err() == nil {
+		t.Errorf("stop() did not cancel the running import")
+	}
+	job, files := tracker.finish(true)
+	if job == nil || job.Finished.IsZero() || !job.Stopped || job.Added != 91 || len(files) != 1 {
+		t.Errorf("finish() = %+v with %d files, want the finished job with the outcome of the file after the flush", job, len(files))
+	}
+	if tracker.running() != nil {
+		t.Errorf("running() after finish() = %+v, want nil", tracker.running())
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing"
+	"github.com/sirupsen/logrus"
+)
+
+// error codes as used by the reference KOReader sync server
+const (
+	koErrUnknown      = 2000
+	koErrUnauthorized = 2001
+	koErrUserExists   = 2002
+	koErrInvalidField = 2003
+	koErrNoDocument   = 2004
+)
+
+type koreaderProgress struct {
+	Document   string  `json:"document"`
+	Progress   string  `json:"progress"`
+	Percentage float64 `json:"percentage"`
+	Device     string  `json:"device"`
+	DeviceID   string  `json:"device_id"`
+	Timestamp  int64   `json:"timestamp,omitempty"`
+}
+
+func koreaderError(c *gin.Context, status, code int, msg string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"code":    code,
+		"message": msg,
+	})
+}
+
+// KOReaderAuthMiddleware authenticates requests with the x-auth-user and x-auth-key headers KOReader sends
+func (app *booksingApp) KOReaderAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.GetHeader("x-auth-user")
+		key := c.GetHeader("x-auth-key")
+
+		user, err := app.db.GetUser(username)
+		if err != nil && err != booksing.ErrNotFound {
+			app.logger.WithError(err).Error("could not get user")
+			koreaderError(c, 500, koErrUnknown, "Unknown server error.")
+			return
+		}
+		if err == booksing.ErrNotFound || !user.IsAllowed || !user.CheckSyncKey(key) {
+			koreaderError(c, 401, koErrUnauthorized, "Unauthorized")
+			return
+		}
+
+		c.Set("id", &user)
+	}
+}
+
+func (app *booksingApp) koreaderCreateUser(c *gin.Context) {
+	// accounts are tied to the (proxy authenticated) booksing users, so they can only be set up from the web interface
+	koreaderError(c, 402, koErrUserExists, "Register by setting a sync password on the reading page of booksing.")
+}
+
+func (app *booksingApp) koreaderAuthorize(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"authorized": "OK",
+	})
+}
+
+func (app *booksingApp) koreaderHealthcheck(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"state": "OK",
+	})
+}
+
+func (app *booksingApp) koreaderUpdateProgress(c *gin.Context) {
+	var in koreaderProgress
+	if err := c.ShouldBindJSON(&in); err != nil {
+		koreaderError(c, 403, koErrInvalidField, "Invalid request")
+		return
+	}
+	if in.Document == "" {
+		koreaderError(c, 403, koErrNoDocument, "Field 'document' not provided.")
+		return
+	}
+	if in.Progress == "" || in.Device == "" {
+		koreaderError(c, 403, koErrInvalidField, "Invalid request")
+		return
+	}
+
+	user := c.MustGet("id").(*booksing.User)
+	p := booksing.Progress{
+		User:       user.Name,
+		Document:   in.Document,
+		Progress:   in.Progress,
+		Percentage: in.Percentage,
+		Device:     in.Device,
+		DeviceID:   in.DeviceID,
+		Timestamp:  time.Now().In(app.settings().timezone),
+	}
+
+	book, err := app.db.GetBookByChecksum(in.Document)
+	if err == nil {
+		p.BookID = book.ID
+	} else if err != booksing.ErrNotFound {
+		app.logger.WithError(err).Error("could not look up book by checksum")
+	}
+
+	err = app.db.SaveProgress(&p)
+	if err != nil {
+		app.logger.WithFields(logrus.Fields{
+			"user":     user.Name,
+			"document": in.Document,
+		}).WithError(err).Error("could not store progress")
+		koreaderError(c, 500, koErrUnknown, "Unknown server error.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"document":  p.Document,
+		"timestamp": p.Timestamp.Unix(),
+	})
+}
+
+func (app *booksingApp) koreaderGetProgress(c *gin.Context) {
+	user := c.MustGet("id").(*booksing.User)
+
+	p, err := app.db.GetProgress(user.Name, c.Param("document"))
+	if err == booksing.ErrNotFound {
+		c.JSON(200, gin.H{})
+		return
+	}
+	if err != nil {
+		app.logger.WithError(err).Error("could not get progress")
+		koreaderError(c, 500, koErrUnknown, "Unknown server error.")
+		return
+	}
+
+	c.JSON(200, koreaderProgress{
+		Document:   p.Document,
+		Progress:   p.Progress,
+		Percentage: p.Percentage,
+		Device:     p.Device,
+		DeviceID:   p.DeviceID,
+		Timestamp:  p.Timestamp.Unix(),
+	})
+}
+
+func (app *booksingApp) setSyncPassword(c *gin.Context) {
+	password := c.PostForm("password")
+	if password == "" {
+		c.HTML(400, "error.html", V{
+			Error: errors.New("A sync password is required"),
+		})
+		return
+	}
+
+	// KOReader never sends the password itself, only the md5 of it
+	sum := md5.Sum([]byte(password))
+	user := c.MustGet("id").(*booksing.User)
+	err := user.SetSyncKey(hex.EncodeToString(sum[:]))
+	if err == nil {
+		err = app.db.SaveUser(user)
+	}
+	if err != nil {
+		app.logger.WithError(err).Error("could not store sync key")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	c.Redirect(302, "/reading")
+}
+
+// backfillChecksums calculates the KOReader document checksum of books that were imported before it existed
+func (app *booksingApp) backfillChecksums() {
+	books, err := app.db.GetBooksWithoutChecksum()
+	if err != nil {
+		app.logger.WithError(err).Error("could not get books without checksum")
+		return
+	}
+	if len(books) == 0 {
+		return
+	}
+	app.logger.WithField("total", len(books)).Info("calculating missing checksums")
+
+	for _, b := range books {
+		sum, err := booksing.PartialMD5(b.Path)
+		if err != nil {
+			app.logger.WithField("path", b.Path).WithError(err).Warning("could not calculate checksum")
+			continue
+		}
+		err = app.db.SetChecksum(b.ID, sum)
+		if err != nil {
+			app.logger.WithField("id", b.ID).WithError(err).Error("could not store checksum")
+		}
+	}
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"embed"
+	"errors"
 	"fmt"
-	"html/template"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/postgres"
+	"github.com/gnur/booksing/query"
 	"github.com/gnur/booksing/sqlite"
 	"github.com/gnur/slev"
 
-	"github.com/kelseyhightower/envconfig"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -24,6 +31,9 @@ var staticFiles embed.FS
 //go:embed templates
 var templateFiles embed.FS
 
+// shutdownTimeout is how long running requests get to finish when booksing stops
+const shutdownTimeout = 10 * time.Second
+
 // V is the holder struct for all possible template values
 type V struct {
 	Results    int64
@@ -41,57 +51,109 @@ type V struct {
 	Limit      int64
 	Offset     int64
 	Indexing   bool
-}
-
-type configuration struct {
-	AcceptedLanguages []string `default:""`
-	AdminUser         string   `default:"unknown"`
-	AllowAllusers     bool     `default:"true"`
-	BindAddress       string   `default:":7132"`
-	BookDir           string   `default:"./books/"`
-	EventsPort        string   `default:":8821"`
-	DatabaseDir       string   `default:"./db/"`
-	FailDir           string   `default:"./failed"`
-	ImportDir         string   `default:"./import"`
-	LogLevel          string   `default:"info"`
-	MaxSize           int64    `default:"0"`
-	Timezone          string   `default:"Europe/Amsterdam"`
-	UserHeader        string   `default:""`
+	Progress   *booksing.Progress
+	Reading    []readingEntry
+	SyncURL    string
+	Status     string
+	State      *booksing.ReadingState
+	Statuses   []booksing.ReadingStatus
+	Summary    *readingSummary
+	QueryError *query.Error
+	Params     url.Values
+	Facets     *booksing.Facets
+	// Suggestions are shown when a search found nothing
+	Suggestions []booksing.Suggestion
+	// Cursor is the page being shown and Next the page after it when paging with cursors
+	Cursor string
+	Next   string
+	// Backups are the backups in the backup dir, newest first
+	Backups []backupFile
+	// Editions are the editions of the works that are shown, by work
+	Editions map[uint][]booksing.Book
+	// Catalogs is set when books can be looked up in external catalogs, Proposals are the changes they propose
+	Catalogs  bool
+	Proposals []proposalGroup
+	// Authors are the authors with aliases, Spellings the names of books that look like the same author
+	Authors   []booksing.Author
+	Spellings [][]booksing.FacetCount
+	// Tags are the tags of the tag cloud
+	Tags []cloudTag
+	// Uploads are the latest files uploaded through the web ui, files larger than MaxSize are refused
+	Uploads []booksing.Upload
+	MaxSize int64
+	// ImportJobs are the latest import jobs, ImportJob the running or shown one with the outcomes of its ImportFiles
+	ImportJobs  []booksing.ImportJob
+	ImportJob   *booksing.ImportJob
+	ImportFiles []booksing.ImportFile
+	// CSRF is the token of the forms that need one. ConfigFile and TemplateDir are read again on a reload, Loaded is
+	// when that last happened and Restart are the changed settings that wait for a restart.
+	CSRF        string
+	ConfigFile  string
+	TemplateDir string
+	Loaded      time.Time
+	Reloaded    bool
+	Restart     []string
 }
 
 func main() {
 	log.SetOutput(os.Stdout)
 
-	var cfg configuration
-	err := envconfig.Process("booksing", &cfg)
+	loader := newConfigLoader()
+	current, err := loader.load()
 	if err != nil {
-		log.WithField("err", err).Fatal("Could not parse full config from environment")
+		log.WithError(err).Fatal("invalid configuration")
 	}
-
-	logLevel, err := log.ParseLevel(cfg.LogLevel)
-	if err == nil {
-		log.SetLevel(logLevel)
+	log.SetLevel(current.logLevel)
+	cfg := current.cfg
+
+	var cmd *command
+	if len(os.Args) > 1 {
+		c, err := findCommand(os.Args[1])
+		if err != nil {
+			log.WithError(err).Fatal("command failed")
+		}
+		cmd = &c
 	}
 
-	var db database
-	log.WithField("dbpath", cfg.DatabaseDir).Debug("using this file")
-	db, err = sqlite.New(cfg.DatabaseDir)
+	var db booksing.Database
+	if cmd == nil || !cmd.offline {
+		if cfg.DatabaseURL != "" {
+			log.Debug("using postgres")
+			db, err = postgres.Open(cfg.DatabaseURL)
+		} else {
+			log.WithField("dbpath", cfg.DatabaseDir).Debug("using this file")
+			db, err = sqlite.Open(cfg.DatabaseDir)
+		}
 
-	if err != nil {
-		log.WithField("err", err).Fatal("could not create fileDB")
-	}
-	defer db.Close()
+		if err != nil {
+			log.WithField("err", err).Fatal("could not create fileDB")
+		}
+		defer db.Close()
 
-	tz, err := time.LoadLocation(cfg.Timezone)
-	if err != nil {
-		log.WithField("err", err).Fatal("could not load timezone")
+		if cmd == nil || !cmd.unmigrated {
+			err = db.Migrate()
+			if err != nil {
+				log.WithError(err).Fatal("could not migrate the database")
+			}
+		}
 	}
 
-	tpl := template.New("")
-	tpl.Funcs(templateFunctions)
-	tpl, err = tpl.ParseFS(templateFiles, "templates/*.html")
-	if err != nil {
-		log.WithField("err", err).Fatal("could not read templates")
+	if cmd != nil {
+		app := booksingApp{
+			db:      db,
+			bookDir: cfg.BookDir,
+			logger:  log.WithField("app", "booksing"),
+			loader:  loader,
+		}
+		app.current.Store(current)
+		err = cmd.run(&app, os.Args[2:])
+		if err != nil {
+			// Fatal exits without closing the database, offline commands have none
+			if db != nil {
+				db.Close()
+			}
+			log.WithError(err).Fatal("command failed")
+		}
 		return
 	}
 
@@ -101,25 +163,63 @@ func main() {
 		return
 	}
 
+	csrfKey := make([]byte, 32)
+	_, err = rand.Read(csrfKey)
+	if err != nil {
+		log.WithError(err).Fatal("could not create a csrf key")
+	}
+
 	app := booksingApp{
-		db:        db,
-		slev:      sl,
-		bookDir:   cfg.BookDir,
-		importDir: cfg.ImportDir,
-		timezone:  tz,
-		adminUser: cfg.AdminUser,
-		logger:    log.WithField("app", "booksing"),
-		cfg:       cfg,
+		db:         db,
+		slev:       sl,
+		bookDir:    cfg.BookDir,
+		importDir:  cfg.ImportDir,
+		logger:     log.WithField("app", "booksing"),
+		loader:     loader,
+		csrfKey:    csrfKey,
+		refreshNow: make(chan struct{}, 1),
 	}
+	app.current.Store(current)
+	app.stopUnfinishedImports()
 
+	// ctx is canceled when booksing is asked to stop, which stops a running import
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	app.stopping = ctx.Done()
+
+	// the database is closed after the loops are done with it
+	var loops sync.WaitGroup
 	if cfg.ImportDir != "" {
-		go app.refreshLoop()
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			app.refreshLoop(ctx)
+		}()
+	}
+	if cfg.BackupInterval > 0 {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			app.backupLoop(ctx)
+		}()
 	}
+	defer loops.Wait()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_, err := app.reload()
+			if err != nil {
+				app.logger.WithError(err).Error("could not reload")
+			}
+		}
+	}()
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(Logger(app.logger), gin.Recovery())
-	r.SetHTMLTemplate(tpl)
+	r.HTMLRender = htmlRender{app: &app}
 
 	static := r.Group("/", func(c *gin.Context) {
 		c.Header("Cache-Control", "public, max-age=86400, immutable")
@@ -127,14 +227,11 @@ func main() {
 
 	static.StaticFS("/static", http.FS(staticFiles))
 
-	r.GET("/kill", func(c *gin.Context) {
-		app.logger.Fatal("Killing so I get restarted anew")
-	})
-
 	r.GET("/status", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status": app.state,
 			"total":  app.db.GetBookCount(),
+			"import": app.importStatus(),
 		})
 	})
 
@@ -142,10 +239,31 @@ func main() {
 	auth.Use(app.BearerTokenMiddleware())
 	{
 		auth.GET("/", app.search)
-		auth.GET("/detail/:hash", app.detailPage)
+		auth.GET("/browse", app.browse)
+		auth.GET("/complete", app.complete)
+		auth.GET("/detail/:id", app.detailPage)
+		auth.GET("/tags", app.showTags)
+		auth.GET("/upload", app.showUploads)
+		auth.POST("/upload", app.upload)
 		auth.GET("/download", app.downloadBook)
 		auth.GET("/cover", app.cover)
+		auth.GET("/reading", app.showReading)
+		auth.POST("/reading/sync", app.setSyncPassword)
+		auth.POST("/reading/import", app.importDownloads)
+		auth.POST("/reading/state/:id", app.updateReadingState)
+		auth.GET("/reading/year", app.showYear)
+		auth.GET("/reading/year/:year", app.showYear)
+	}
 
+	// KOReader progress sync, authenticated with its own credentials
+	r.GET("/healthcheck", app.koreaderHealthcheck)
+	r.POST("/users/create", app.koreaderCreateUser)
+	kosync := r.Group("/")
+	kosync.Use(app.KOReaderAuthMiddleware())
+	{
+		kosync.GET("/users/auth", app.koreaderAuthorize)
+		kosync.PUT("/syncs/progress", app.koreaderUpdateProgress)
+		kosync.GET("/syncs/progress/:document", app.koreaderGetProgress)
 	}
 
 	admin := r.Group("/admin")
@@ -153,9 +271,28 @@ func main() {
 	{
 		admin.GET("/users", app.showUsers)
 		admin.GET("/downloads", app.showDownloads)
-		admin.POST("/delete/:hash", app.deleteBook)
+		admin.POST("/delete/:id", app.deleteBook)
+		admin.POST("/link/:id", app.linkWork)
+		admin.POST("/unlink/:id", app.unlinkWork)
 		admin.POST("user/:username", app.updateUser)
 		admin.POST("/adduser", app.addUser)
+		admin.GET("/backups", app.showBackups)
+		admin.POST("/backups", app.createBackup)
+		admin.GET("/backups/:name", app.downloadBackup)
+		admin.GET("/metadata", app.showProposals)
+		admin.POST("/metadata/:id", app.lookupMetadata)
+		admin.POST("/proposals/:id", app.decideProposal)
+		admin.GET("/authors", app.showAuthors)
+		admin.POST("/authors", app.mergeAuthors)
+		admin.POST("/aliases/:id", app.deleteAuthorAlias)
+		admin.POST("/tags", app.renameTag)
+		admin.GET("/imports", app.showImports)
+		admin.GET("/imports/events", app.importEvents)
+		admin.POST("/imports/stop", app.stopImport)
+		admin.GET("/imports/:id", app.showImport)
+		admin.POST("/booktags/:id", app.setBookTags)
+		admin.GET("/reload", app.showReload)
+		admin.POST("/reload", app.checkCSRF(), app.reloadConfig)
 	}
 
 	port := os.Getenv("PORT")
@@ -165,12 +302,38 @@ func main() {
 	} else {
 		port = fmt.Sprintf(":%s", port)
 	}
-	log.WithField("port", port).Info("booksing is now running")
 
-	err = r.Run(port)
-	if err != nil {
+	srv := &http.Server{
+		Addr:    port,
+		Handler: r,
+	}
+	// Shutdown waits for the running requests and makes ListenAndServe return right away
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		// a second signal stops booksing right away instead of waiting for the requests
+		stop()
+		log.Info("stopping booksing")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			log.WithError(err).Warning("requests were still running when booksing stopped")
+		}
+	}()
+
+	log.WithField("port", port).Info("booksing is now running")
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		stop()
+		<-shutdown
+		loops.Wait()
+		// Fatal exits without the deferred calls
+		db.Close()
 		log.WithField("err", err).Fatal("unable to start running")
 	}
+	<-shutdown
 }
 
 func (app *booksingApp) keepBook(b *booksing.Book) bool {
@@ -178,12 +341,13 @@ func (app *booksingApp) keepBook(b *booksing.Book) bool {
 		return false
 	}
 
-	if app.cfg.MaxSize > 0 && b.Size > app.cfg.MaxSize {
+	cfg := app.settings().cfg
+	if cfg.MaxSize > 0 && b.Size > cfg.MaxSize {
 		return false
 	}
 
-	if len(app.cfg.AcceptedLanguages) > 0 {
-		return contains(app.cfg.AcceptedLanguages, b.Language)
+	if len(cfg.AcceptedLanguages) > 0 {
+		return contains(cfg.AcceptedLanguages, b.Language)
 	}
 
 	return true
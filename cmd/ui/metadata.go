@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/metadata"
+	"github.com/sirupsen/logrus"
+)
+
+// metadataProviders returns the catalogs named in MetadataProviders, in the order they are asked
+func metadataProviders(cfg configuration) ([]metadata.Provider, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	// books are looked up once in a while, a day is plenty to not ask the same thing twice in a run
+	cache := metadata.NewMemoryCache(24 * time.Hour)
+
+	var providers []metadata.Provider
+	for _, name := range cfg.MetadataProviders {
+		switch name {
+		case "openlibrary":
+			providers = append(providers, metadata.NewOpenLibrary(client, cache))
+		case "googlebooks":
+			providers = append(providers, metadata.NewGoogleBooks(client, cache, cfg.GoogleBooksKey))
+		default:
+			return nil, fmt.Errorf("unknown metadata provider %q, use openlibrary or googlebooks", name)
+		}
+	}
+	return providers, nil
+}
+
+// enrich looks up b in the catalogs. With MetadataFill what b misses is filled in and stored, every other
+// difference is stored as a proposal for an admin.
+func (app *booksingApp) enrich(ctx context.Context, b *booksing.Book) (filled []string, proposals int, err error) {
+	s := app.settings()
+	if len(s.providers) == 0 {
+		return nil, 0, errors.New("no metadata providers are configured, set BOOKSING_METADATAPROVIDERS")
+	}
+	m, err := metadata.Lookup(ctx, s.providers, *b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filled, ps := metadata.Diff(b, m, s.cfg.MetadataFill)
+	if len(filled) > 0 {
+		err = app.db.UpdateBook(b, filled...)
+		if err != nil {
+			return nil, 0, err
+		}
+		app.recentCache = nil
+	}
+	if len(ps) > 0 {
+		err = app.db.SaveProposals(ps)
+		if err != nil {
+			return filled, 0, err
+		}
+	}
+	app.logger.WithFields(logrus.Fields{
+		"id":        b.ID,
+		"source":    m.Source,
+		"filled":    filled,
+		"proposals": len(ps),
+	}).Info("looked up metadata")
+	return filled, len(ps), nil
+}
+
+func (app *booksingApp) showProposals(c *gin.Context) {
+	proposals, err := app.db.GetProposals()
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	var groups []proposalGroup
+	for _, p := range proposals {
+		if len(groups) > 0 && groups[len(groups)-1].Book.ID == p.Book {
+			groups[len(groups)-1].Proposals = append(groups[len(groups)-1].Proposals, p)
+			continue
+		}
+		b, err := app.db.GetBook(p.Book)
+		if errors.Is(err, booksing.ErrNotFound) {
+			// the book was deleted since
+			err = app.db.DeleteProposal(p.ID)
+			if err != nil {
+				app.logger.WithError(err).Warning("could not remove proposal")
+			}
+			continue
+		}
+		if err != nil {
+			c.HTML(500, "error.html", V{
+				Error: err,
+			})
+			return
+		}
+		groups = append(groups, proposalGroup{Book: b, Proposals: []booksing.Proposal{p}})
+	}
+
+	c.HTML(200, "metadata.html", V{
+		IsAdmin:    c.GetBool("isAdmin"),
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+		Catalogs:   len(app.settings().providers) > 0,
+		Proposals:  groups,
+	})
+}
+
+// lookupMetadata looks up a single book in the catalogs
+func (app *booksingApp) lookupMetadata(c *gin.Context) {
+	b, _, err := app.findBook(c.Param("id"))
+	if err != nil {
+		c.HTML(404, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	_, proposals, err := app.enrich(c.Request.Context(), b)
+	if errors.Is(err, metadata.ErrNotFound) {
+		c.HTML(404, "error.html", V{
+			Error: fmt.Errorf("%s by %s was not found in any catalog", b.Title, b.Author),
+		})
+		return
+	}
+	if err != nil {
+		app.logger.WithError(err).Error("could not look up metadata")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	if proposals > 0 {
+		c.Redirect(302, "/admin/metadata")
+		return
+	}
+	c.Redirect(302, fmt.Sprintf("/detail/%d", b.ID))
+}
+
+// decideProposal applies a proposal when the form has approve=true and rejects it otherwise, both remove the proposal
+func (app *booksingApp) decideProposal(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.HTML(400, "error.html", V{
+			Error: fmt.Errorf("invalid proposal %q", c.Param("id")),
+		})
+		return
+	}
+	p, err := app.db.GetProposal(uint(id))
+	if err != nil {
+		c.HTML(404, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	if c.PostForm("approve") == "true" {
+		err = app.applyProposal(p)
+		if err != nil {
+			app.logger.WithError(err).Error("could not apply proposal")
+			c.HTML(500, "error.html", V{
+				Error: err,
+			})
+			return
+		}
+	}
+	err = app.db.DeleteProposal(p.ID)
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	c.Redirect(302, "/admin/metadata")
+}
+
+func (app *booksingApp) applyProposal(p *booksing.Proposal) error {
+	b, err := app.db.GetBook(p.Book)
+	if err != nil {
+		return err
+	}
+	err = b.SetField(p.Field, p.Proposed)
+	if err != nil {
+		return err
+	}
+	err = app.db.UpdateBook(b, p.Field)
+	if err != nil {
+		return err
+	}
+	app.recentCache = nil
+	app.logger.WithFields(logrus.Fields{
+		"id":    b.ID,
+		"field": p.Field,
+		"value": p.Proposed,
+	}).Info("applied metadata proposal")
+	return nil
+}
@@ -57,7 +57,8 @@ func Logger(log *logrus.Entry) gin.HandlerFunc {
 
 func (app *booksingApp) BearerTokenMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username := c.GetHeader(app.cfg.UserHeader)
+		cfg := app.settings().cfg
+		username := c.GetHeader(cfg.UserHeader)
 		if username == "" {
 			username = "unknown"
 		}
@@ -66,8 +67,8 @@ func (app *booksingApp) BearerTokenMiddleware() gin.HandlerFunc {
 		if err == booksing.ErrNotFound {
 			user = booksing.User{
 				Name:      username,
-				IsAdmin:   username == app.adminUser,
-				IsAllowed: username == app.adminUser || app.cfg.AllowAllusers,
+				IsAdmin:   username == cfg.AdminUser,
+				IsAllowed: username == cfg.AdminUser || cfg.AllowAllusers,
 				Created:   time.Now(),
 				LastSeen:  time.Now(),
 			}
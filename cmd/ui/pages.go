@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -11,42 +12,93 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/query"
 	zglob "github.com/mattn/go-zglob"
 	"github.com/sirupsen/logrus"
 )
 
 func (app *booksingApp) search(c *gin.Context) {
 	start := time.Now()
-	var offset int64
-	var limit int64
-	var err error
-	offset = 0
-	limit = 20
 	q := c.Query("q")
-	off := c.Query("o")
-	if off != "" {
-		offset, err = strconv.ParseInt(off, 10, 64)
-		if err != nil {
-			offset = 0
+	offset, limit := pageParams(c)
+
+	// everything that shapes the results is kept in the url so paging and facet links can build on it
+	params := url.Values{}
+	for _, k := range []string{"q", "status", "sort", "lang", "series", "publisher", "cover", "added"} {
+		if v := c.Query(k); v != "" {
+			params.Set(k, v)
 		}
 	}
-	lim := c.Query("l")
-	if lim != "" {
-		limit, err = strconv.ParseInt(lim, 10, 64)
-		if err != nil {
-			limit = 20
+	// a language picked as fra or français filters on the fr the books are stored with
+	if lang := booksing.FixLang(params.Get("lang")); lang != "" {
+		params.Set("lang", lang)
+	}
+
+	sq := booksing.SearchQuery{
+		Query:     q,
+		Limit:     limit,
+		Offset:    offset,
+		After:     c.Query("after"),
+		Sort:      params.Get("sort"),
+		Language:  params.Get("lang"),
+		Series:    params.Get("series"),
+		Publisher: params.Get("publisher"),
+		HasCover:  params.Get("cover") == "yes",
+
+		CollapseEditions: true,
+	}
+	for _, w := range booksing.AddedWindows {
+		if params.Get("added") == w.Name {
+			sq.AddedSince = time.Now().Add(-w.Duration)
 		}
 	}
+	status := params.Get("status")
+	if status != "" {
+		sq.User = c.MustGet("id").(*booksing.User).Name
+		sq.Status = booksing.ReadingStatus(status)
+		if status == "finished-this-year" {
+			sq.Status = booksing.StatusFinished
+			tz := app.settings().timezone
+			sq.FinishedSince = time.Date(time.Now().In(tz).Year(), 1, 1, 0, 0, 0, 0, tz)
+		}
+	}
+	// only the first page of the front page is cached, it is by far the most requested one
+	unfiltered := len(params) == 0 && offset == 0 && limit == defaultLimit && sq.After == ""
 
 	var books *booksing.SearchResult
+	var err error
 
-	if q == "" && app.recentCache != nil {
+	if unfiltered && app.recentCache != nil {
 		//return books from cache
 		books = app.recentCache
 		app.logger.Warning("Serving from cache")
 
 	} else {
-		books, err = app.db.GetBooks(q, limit, offset)
+		books, err = app.db.GetBooks(sq)
+		var qe *query.Error
+		if errors.As(err, &qe) {
+			template := "search.html"
+			if c.Request.Header.Get("HX-Request") == "true" {
+				template = "searchresults"
+			}
+			c.HTML(200, template, V{
+				QueryError: qe,
+				Q:          q,
+				Status:     status,
+				Params:     params,
+				IsAdmin:    c.GetBool("isAdmin"),
+				TotalBooks: app.db.GetBookCount(),
+				Indexing:   app.state == "indexing",
+			})
+			return
+		}
+		if err == booksing.ErrInvalidCursor {
+			c.HTML(400, "error.html", V{
+				Error: err,
+				Q:     q,
+			})
+			return
+		}
 		if err != nil {
 			c.HTML(500, "error.html", V{
 				Error: err,
@@ -54,7 +106,7 @@ func (app *booksingApp) search(c *gin.Context) {
 			})
 			return
 		}
-		if q == "" {
+		if unfiltered {
 			app.recentCache = books
 		}
 	}
@@ -67,14 +119,77 @@ func (app *booksingApp) search(c *gin.Context) {
 		template = "searchresults"
 	}
 
+	c.HTML(200, template, V{
+		Limit:       limit,
+		Offset:      offset,
+		Results:     books.Total,
+		TimeTaken:   latency,
+		Books:       books.Items,
+		Error:       err,
+		Q:           q,
+		Status:      status,
+		Params:      params,
+		Facets:      books.Facets,
+		Suggestions: books.Suggestions,
+		Editions:    books.Editions,
+		IsAdmin:     c.GetBool("isAdmin"),
+		TotalBooks:  app.db.GetBookCount(),
+		Indexing:    app.state == "indexing",
+	})
+}
+
+const (
+	defaultLimit = 20
+	maxLimit     = 200
+)
+
+// pageParams returns the offset and limit requested with the o and l query parameters
+func pageParams(c *gin.Context) (offset, limit int64) {
+	offset, err := strconv.ParseInt(c.Query("o"), 10, 64)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	limit, err = strconv.ParseInt(c.Query("l"), 10, 64)
+	if err != nil || limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	return offset, limit
+}
+
+// browse pages through the entire library, newest books first
+func (app *booksingApp) browse(c *gin.Context) {
+	_, limit := pageParams(c)
+	after := c.Query("after")
+
+	books, err := app.db.GetBooks(booksing.SearchQuery{
+		Limit: limit,
+		After: after,
+		Sort:  "added",
+	})
+	if err == booksing.ErrInvalidCursor {
+		c.HTML(400, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	if err != nil {
+		app.logger.WithError(err).Error("could not browse books")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	template := "browse.html"
+	if c.Request.Header.Get("HX-Request") == "true" {
+		template = "browseresults"
+	}
 	c.HTML(200, template, V{
 		Limit:      limit,
-		Offset:     offset,
 		Results:    books.Total,
-		TimeTaken:  latency,
 		Books:      books.Items,
-		Error:      err,
-		Q:          q,
+		Next:       books.Next,
+		Cursor:     after,
 		IsAdmin:    c.GetBool("isAdmin"),
 		TotalBooks: app.db.GetBookCount(),
 		Indexing:   app.state == "indexing",
@@ -104,9 +219,7 @@ func (app *booksingApp) showUsers(c *gin.Context) {
 }
 
 func (app *booksingApp) deleteBook(c *gin.Context) {
-	hash := c.Param("hash")
-
-	book, err := app.db.GetBook(hash)
+	book, _, err := app.findBook(c.Param("id"))
 	if err != nil {
 		c.HTML(404, "error.html", V{
 			Error: errors.New("Book not found"),
@@ -117,7 +230,7 @@ func (app *booksingApp) deleteBook(c *gin.Context) {
 	err = os.Remove(book.Path)
 	if err != nil {
 		app.logger.WithFields(logrus.Fields{
-			"hash": hash,
+			"id":   book.ID,
 			"err":  err,
 			"path": book.Path,
 		}).Error("Could not delete book from filesystem")
@@ -127,19 +240,21 @@ func (app *booksingApp) deleteBook(c *gin.Context) {
 		return
 	}
 
-	err = app.db.DeleteBook(hash)
+	err = app.db.DeleteBook(book.ID)
 	if err != nil {
 		app.logger.WithFields(logrus.Fields{
-			"hash": hash,
-			"err":  err,
+			"id":  book.ID,
+			"err": err,
 		}).Error("Could not delete book from database")
 		c.HTML(500, "error.html", V{
 			Error: fmt.Errorf("Unable to delete book from database: %w", err),
 		})
 		return
 	}
+	app.recentCache = nil
 	app.logger.WithFields(logrus.Fields{
-		"hash": hash,
+		"id":   book.ID,
+		"path": book.Path,
 	}).Info("book was deleted")
 	c.Redirect(302, c.Request.Referer())
 }
@@ -166,15 +281,23 @@ func (app *booksingApp) showDownloads(c *gin.Context) {
 }
 
 func (app *booksingApp) detailPage(c *gin.Context) {
-	hash := c.Param("hash")
-
-	b, err := app.db.GetBook(hash)
+	b, legacy, err := app.findBook(c.Param("id"))
+	if errors.Is(err, booksing.ErrNotFound) {
+		c.HTML(404, "error.html", V{
+			Error: fmt.Errorf("there is no book %s", c.Param("id")),
+		})
+		return
+	}
 	if err != nil {
 		c.HTML(500, "error.html", V{
 			Error: err,
 		})
 		return
 	}
+	if legacy {
+		c.Redirect(301, fmt.Sprintf("/detail/%d", b.ID))
+		return
+	}
 
 	globPath := strings.Replace(b.Path, ".epub", ".*", 1)
 	app.logger.WithField("path", globPath).Debug("Searching here for other formats")
@@ -188,6 +311,31 @@ func (app *booksingApp) detailPage(c *gin.Context) {
 
 	b.CoverPath = strings.TrimPrefix(b.CoverPath, app.bookDir)
 
+	username := c.MustGet("id").(*booksing.User).Name
+	progress, err := app.db.GetBookProgress(username, b.ID)
+	if err == booksing.ErrNotFound {
+		progress = nil
+	} else if err != nil {
+		app.logger.WithError(err).Error("could not get progress")
+		progress = nil
+	}
+
+	state, err := app.db.GetReadingState(username, b.ID)
+	if err == booksing.ErrNotFound {
+		state = nil
+	} else if err != nil {
+		app.logger.WithError(err).Error("could not get reading state")
+		state = nil
+	}
+
+	editions := make(map[uint][]booksing.Book)
+	if b.WorkID != 0 {
+		editions[b.WorkID], err = app.db.GetEditions(b.WorkID)
+		if err != nil {
+			app.logger.WithError(err).Error("could not get editions")
+		}
+	}
+
 	template := "detail.html"
 	if c.Request.Header.Get("HX-Request") == "true" {
 		template = "bookdetail"
@@ -197,9 +345,53 @@ func (app *booksingApp) detailPage(c *gin.Context) {
 		Results:    0,
 		Book:       b,
 		ExtraPaths: books,
+		Progress:   progress,
+		State:      state,
+		Statuses:   booksing.ReadingStatuses,
+		Editions:   editions,
+		Catalogs:   len(app.settings().providers) > 0,
 		IsAdmin:    c.GetBool("isAdmin"),
 		TotalBooks: app.db.GetBookCount(),
 		Indexing:   app.state == "indexing",
 	})
 
 }
+
+func (app *booksingApp) showReading(c *gin.Context) {
+	user := c.MustGet("id").(*booksing.User)
+
+	progress, err := app.db.GetRecentProgress(user.Name, 50)
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	var reading []readingEntry
+	for _, p := range progress {
+		b, err := app.db.GetBook(p.BookID)
+		if err != nil {
+			app.logger.WithField("id", p.BookID).WithError(err).Warning("could not get book for progress")
+			continue
+		}
+		reading = append(reading, readingEntry{
+			Progress: p,
+			Book:     b,
+		})
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	c.HTML(200, "reading.html", V{
+		Reading:    reading,
+		Username:   user.Name,
+		SyncURL:    fmt.Sprintf("%s://%s", scheme, c.Request.Host),
+		IsAdmin:    c.GetBool("isAdmin"),
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gnur/booksing"
+)
+
+// parsedFile is a file that the import read
+type parsedFile struct {
+	path string
+	book *booksing.Book
+	took time.Duration
+}
+
+// importer imports files as a pipeline of stages that are connected by bounded channels: discover sends the files,
+// parse reads them with a fixed number of workers, filter drops the books that are not kept, organize prepares the
+// books for storage and persist stores them in batches. Canceling the context stops parsing, the files that were not
+// read yet are skipped and the books that were read already are still stored.
+type importer struct {
+	// workers is how many files are parsed at once, batchSize how many books are stored at once
+	workers   int
+	batchSize int
+
+	parse func(path string) (*booksing.Book, error)
+	// filter returns why a book is not kept and the book it is a copy of, an empty outcome keeps the book
+	filter   func(b *booksing.Book) (booksing.ImportOutcome, string, uint)
+	organize func(b *booksing.Book)
+	// persist stores books and returns the ones it stored, a book with a path that is stored already is skipped
+	persist func(books []booksing.Book) ([]booksing.Book, error)
+
+	// outcome records what the import made of a file, parsed counts a file that could be read and discard takes a
+	// file that can not be imported out of the import dir
+	outcome func(path string, o booksing.ImportOutcome, message string, took time.Duration, book uint)
+	parsed  func()
+	discard func(path string)
+	// flush saves the outcomes so far, it is called after every batch
+	flush func()
+}
+
+// run imports files and returns when every file has an outcome
+func (im *importer) run(ctx context.Context, files []string) {
+	paths := im.discover(files)
+	parsed := im.parseFiles(ctx, paths)
+	kept := im.filterBooks(parsed)
+	organized := im.organizeBooks(kept)
+	im.persistBooks(organized)
+}
+
+// discover sends every file, after a cancel the parse workers skip them without reading them
+func (im *importer) discover(files []string) <-chan string {
+	out := make(chan string, im.workers)
+	go func() {
+		defer close(out)
+		for _, f := range files {
+			out <- f
+		}
+	}()
+	return out
+}
+
+func (im *importer) parseFiles(ctx context.Context, paths <-chan string) <-chan parsedFile {
+	out := make(chan parsedFile, im.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < im.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				if ctx.Err() != nil {
+					im.outcome(p, booksing.ImportSkipped, "the import was stopped before the file was read", 0, 0)
+					continue
+				}
+				start := time.Now()
+				book, err := im.parse(p)
+				took := time.Since(start)
+				if err != nil {
+					im.discard(p)
+					im.outcome(p, booksing.ImportFailed, "the book could not be read: "+err.Error(), took, 0)
+					continue
+				}
+				im.parsed()
+				// the later stages never stop reading, so this does not block for good after a cancel
+				out <- parsedFile{path: p, book: book, took: took}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// filterBooks keeps the books that filter keeps. The database only knows the books of earlier batches, so a copy of a
+// book that is imported in the same run is recognized by the checksums this stage has seen.
+func (im *importer) filterBooks(in <-chan parsedFile) <-chan parsedFile {
+	out := make(chan parsedFile, im.batchSize)
+	go func() {
+		defer close(out)
+		seen := make(map[string]string)
+		for f := range in {
+			o, message, book := im.filter(f.book)
+			if o == "" {
+				first, ok := seen[f.book.Checksum]
+				if !ok || f.book.Checksum == "" {
+					seen[f.book.Checksum] = f.path
+					out <- f
+					continue
+				}
+				o, message = booksing.ImportDuplicate, "a copy of "+filepath.Base(first)+" that is imported as well"
+			}
+			if o == booksing.ImportRejected {
+				im.discard(f.path)
+			}
+			im.outcome(f.path, o, message, f.took, book)
+		}
+	}()
+	return out
+}
+
+func (im *importer) organizeBooks(in <-chan parsedFile) <-chan parsedFile {
+	out := make(chan parsedFile, im.batchSize)
+	go func() {
+		defer close(out)
+		for f := range in {
+			im.organize(f.book)
+			out <- f
+		}
+	}()
+	return out
+}
+
+func (im *importer) persistBooks(in <-chan parsedFile) {
+	var batch []parsedFile
+	store := func() {
+		if len(batch) == 0 {
+			return
+		}
+		books := make([]booksing.Book, 0, len(batch))
+		for _, f := range batch {
+			books = append(books, *f.book)
+		}
+		added, err := im.persist(books)
+		if err != nil {
+			for _, f := range batch {
+				im.outcome(f.path, booksing.ImportFailed, "the book could not be stored: "+err.Error(), f.took, 0)
+			}
+			batch = nil
+			im.flush()
+			return
+		}
+		ids := make(map[string]uint)
+		for _, b := range added {
+			ids[b.Path] = b.ID
+		}
+		for _, f := range batch {
+			if id, ok := ids[f.path]; ok {
+				im.outcome(f.path, booksing.ImportAdded, "", f.took, id)
+			} else {
+				im.outcome(f.path, booksing.ImportDuplicate, "a book with this path is stored already", f.took, 0)
+			}
+		}
+		batch = nil
+		im.flush()
+	}
+
+	for f := range in {
+		batch = append(batch, f)
+		if len(batch) == im.batchSize {
+			store()
+		}
+	}
+	store()
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gnur/booksing"
+)
+
+// fakeImport is an importer with a fake parser that records what happened to every file
+type fakeImport struct {
+	importer
+
+	mu         sync.Mutex
+	outcomes   map[string]booksing.ImportOutcome
+	stored     []string
+	discarded  []string
+	flushes    int
+	parsing    int
+	mostAtOnce int
+}
+
+func newFakeImport(workers, batchSize int, parse func(path string) (*booksing.Book, error)) *fakeImport {
+	f := &fakeImport{outcomes: make(map[string]booksing.ImportOutcome)}
+	f.importer = importer{
+		workers:   workers,
+		batchSize: batchSize,
+		parse: func(path string) (*booksing.Book, error) {
+			f.mu.Lock()
+			f.parsing++
+			if f.parsing > f.mostAtOnce {
+				f.mostAtOnce = f.parsing
+			}
+			f.mu.Unlock()
+			defer func() {
+				f.mu.Lock()
+				f.parsing--
+				f.mu.Unlock()
+			}()
+			return parse(path)
+		},
+		filter: func(b *booksing.Book) (booksing.ImportOutcome, string, uint) {
+			switch {
+			case strings.HasPrefix(b.Path, "large"):
+				return booksing.ImportRejected, "too large", 0
+			case strings.HasPrefix(b.Path, "copy"):
+				return booksing.ImportDuplicate, "a copy", 42
+			}
+			return "", "", 0
+		},
+		organize: func(b *booksing.Book) {
+			b.UploadedBy = "organized"
+		},
+		persist: func(books []booksing.Book) ([]booksing.Book, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			for _, b := range books {
+				if b.UploadedBy != "organized" {
+					return nil, fmt.Errorf("%s was not organized", b.Path)
+				}
+				if strings.HasPrefix(b.Path, "unstorable") {
+					return nil, errors.New("disk full")
+				}
+			}
+			var added []booksing.Book
+			for _, b := range books {
+				// a file that was stored by an earlier import is skipped
+				if strings.HasPrefix(b.Path, "stored") {
+					continue
+				}
+				f.stored = append(f.stored, b.Path)
+				b.ID = uint(len(f.stored))
+				added = append(added, b)
+			}
+			return added, nil
+		},
+		outcome: func(path string, o booksing.ImportOutcome, message string, took time.Duration, book uint) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if _, ok := f.outcomes[path]; ok {
+				panic("two outcomes for " + path)
+			}
+			f.outcomes[path] = o
+		},
+		parsed: func() {},
+		discard: func(path string) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.discarded = append(f.discarded, path)
+		},
+		flush: func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.flushes++
+		},
+	}
+	return f
+}
+
+func parseBook(path string) (*booksing.Book, error) {
+	if strings.HasPrefix(path, "broken") {
+		return nil, errors.New("not a zip")
+	}
+	// twins are copies of the same file
+	sum, _, _ := strings.Cut(path, "-")
+	if sum != "twin" {
+		sum = path
+	}
+	return &booksing.Book{Path: path, Title: path, Checksum: sum}, nil
+}
+
+func TestImporter(t *testing.T) {
+	var files []string
+	want := make(map[string]booksing.ImportOutcome)
+	for i := 0; i < 100; i++ {
+		prefix, o := "book", booksing.ImportAdded
+		switch i % 10 {
+		case 1:
+			prefix, o = "broken", booksing.ImportFailed
+		case 2:
+			prefix, o = "large", booksing.ImportRejected
+		case 3:
+			prefix, o = "copy", booksing.ImportDuplicate
+		}
+		f := fmt.Sprintf("%s-%d.epub", prefix, i)
+		files = append(files, f)
+		want[f] = o
+	}
+
+	im := newFakeImport(3, 7, parseBook)
+	im.run(context.Background(), files)
+
+	for f, o := range want {
+		if im.outcomes[f] != o {
+			t.Errorf("outcome of %s = %q, want %q", f, im.outcomes[f], o)
+		}
+	}
+	if len(im.outcomes) != len(files) {
+		t.Errorf("%d files got an outcome, want all %d", len(im.outcomes), len(files))
+	}
+	if len(im.stored) != 70 {
+		t.Errorf("%d books were stored, want 70", len(im.stored))
+	}
+	sort.Strings(im.discarded)
+	if len(im.discarded) != 20 || !strings.HasPrefix(im.discarded[0], "broken") || !strings.HasPrefix(im.discarded[19], "large") {
+		t.Errorf("discarded %v, want the broken and the large files", im.discarded)
+	}
+	if im.mostAtOnce > 3 {
+		t.Errorf("%d files were parsed at once, want at most 3 workers", im.mostAtOnce)
+	}
+	// 70 books in batches of 7
+	if im.flushes != 10 {
+		t.Errorf("outcomes were flushed %d times, want after each of the 10 batches", im.flushes)
+	}
+}
+
+func TestImporterDuplicates(t *testing.T) {
+	im := newFakeImport(2, 3, parseBook)
+	im.run(context.Background(), []string{"twin-1.epub", "book-1.epub", "twin-2.epub", "stored-1.epub", "twin-3.epub"})
+
+	// the twins are in different batches, only the first one that is filtered is stored
+	var twins []string
+	for _, f := range []string{"twin-1.epub", "twin-2.epub", "twin-3.epub"} {
+		if im.outcomes[f] == booksing.ImportAdded {
+			twins = append(twins, f)
+		} else if im.outcomes[f] != booksing.ImportDuplicate {
+			t.Errorf("outcome of %s = %q, want %q or %q", f, im.outcomes[f], booksing.ImportAdded, booksing.ImportDuplicate)
+		}
+	}
+	if len(twins) != 1 {
+		t.Errorf("added twins %v, want exactly one", twins)
+	}
+	if im.outcomes["book-1.epub"] != booksing.ImportAdded {
+		t.Errorf("outcome of book-1.epub = %q, want %q", im.outcomes["book-1.epub"], booksing.ImportAdded)
+	}
+	// a book the database skips is not reported as added
+	if im.outcomes["stored-1.epub"] != booksing.ImportDuplicate {
+		t.Errorf("outcome of stored-1.epub = %q, want %q", im.outcomes["stored-1.epub"], booksing.ImportDuplicate)
+	}
+	if len(im.stored) != 2 {
+		t.Errorf("stored %v, want one twin and book-1.epub", im.stored)
+	}
+}
+
+func TestImporterPersistError(t *testing.T) {
+	im := newFakeImport(2, 2, parseBook)
+	im.run(context.Background(), []string{"book-1.epub", "unstorable.epub"})
+
+	// a batch is stored as a whole, a book that can not be stored fails the books it was stored with
+	for _, f := range []string{"book-1.epub", "unstorable.epub"} {
+		if im.outcomes[f] != booksing.ImportFailed {
+			t.Errorf("outcome of %s = %q, want %q", f, im.outcomes[f], booksing.ImportFailed)
+		}
+	}
+	if len(im.stored) != 0 {
+		t.Errorf("stored %v, want nothing", im.stored)
+	}
+}
+
+func TestImporterCancel(t *testing.T) {
+	var files []string
+	for i := 0; i < 1000; i++ {
+		files = append(files, fmt.Sprintf("book-%d.epub", i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var parsed int
+	var mu sync.Mutex
+	im := newFakeImport(4, 10, func(path string) (*booksing.Book, error) {
+		mu.Lock()
+		parsed++
+		if parsed == 25 {
+			cancel()
+		}
+		mu.Unlock()
+		return parseBook(path)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		im.run(ctx, files)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run() did not return after the import was canceled")
+	}
+
+	// the workers finish the file they are reading, nothing more
+	if parsed < 25 || parsed > 25+4 {
+		t.Errorf("%d files were parsed, want the import to stop after 25", parsed)
+	}
+	if len(im.stored) != parsed {
+		t.Errorf("%d books stored of %d parsed files, want every book that was read to be stored", len(im.stored), parsed)
+	}
+	// the files that were not read are skipped, so every file has an outcome
+	skipped := 0
+	for _, o := range im.outcomes {
+		if o == booksing.ImportSkipped {
+			skipped++
+		}
+	}
+	if len(im.outcomes) != len(files) || skipped != len(files)-parsed {
+		t.Errorf("%d outcomes of which %d skipped, want an outcome for all %d files and the %d that were not read skipped", len(im.outcomes), skipped, len(files), len(files)-parsed)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing"
+	"github.com/sirupsen/logrus"
+)
+
+type readingStateForm struct {
+	Status   string `form:"status"`
+	Rating   int    `form:"rating"`
+	Note     string `form:"note"`
+	Finished string `form:"finished"`
+}
+
+func (app *booksingApp) updateReadingState(c *gin.Context) {
+	username := c.MustGet("id").(*booksing.User).Name
+	book, _, err := app.findBook(c.Param("id"))
+	if err != nil {
+		c.HTML(404, "error.html", V{
+			Error: errors.New("Book not found"),
+		})
+		return
+	}
+
+	var f readingStateForm
+	if err := c.ShouldBind(&f); err != nil {
+		app.logger.WithField("err", err).Warning("could not get values from post")
+		c.HTML(400, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	if f.Status == "" {
+		err := app.db.DeleteReadingState(username, book.ID)
+		if err != nil {
+			app.logger.WithError(err).Error("could not delete reading state")
+			c.HTML(500, "error.html", V{
+				Error: err,
+			})
+			return
+		}
+		c.Redirect(302, c.Request.Referer())
+		return
+	}
+
+	status := booksing.ReadingStatus(f.Status)
+	if !status.Valid() {
+		c.HTML(400, "error.html", V{
+			Error: fmt.Errorf("Unknown reading status %q", f.Status),
+		})
+		return
+	}
+	if f.Rating < 0 || f.Rating > 5 {
+		c.HTML(400, "error.html", V{
+			Error: errors.New("Rating should be between 1 and 5"),
+		})
+		return
+	}
+
+	state, err := app.db.GetReadingState(username, book.ID)
+	if err == booksing.ErrNotFound {
+		state = &booksing.ReadingState{
+			User:   username,
+			BookID: book.ID,
+		}
+	} else if err != nil {
+		app.logger.WithError(err).Error("could not get reading state")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	tz := app.settings().timezone
+	now := time.Now().In(tz)
+	state.Status = status
+	state.Rating = f.Rating
+	state.Note = f.Note
+	if status == booksing.StatusReading && state.Started.IsZero() {
+		state.Started = now
+	}
+	if status == booksing.StatusFinished {
+		if f.Finished != "" {
+			finished, err := time.ParseInLocation("2006-01-02", f.Finished, tz)
+			if err != nil {
+				c.HTML(400, "error.html", V{
+					Error: fmt.Errorf("Invalid finished date: %w", err),
+				})
+				return
+			}
+			state.Finished = finished
+		} else if state.Finished.IsZero() {
+			state.Finished = now
+		}
+	} else {
+		state.Finished = time.Time{}
+	}
+
+	err = app.db.SaveReadingState(state)
+	if err != nil {
+		app.logger.WithFields(logrus.Fields{
+			"user": username,
+			"id":   book.ID,
+		}).WithError(err).Error("could not save reading state")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	c.Redirect(302, c.Request.Referer())
+}
+
+func (app *booksingApp) importDownloads(c *gin.Context) {
+	username := c.MustGet("id").(*booksing.User).Name
+
+	imported, err := app.db.ImportDownloads(username)
+	if err != nil {
+		app.logger.WithError(err).Error("could not import downloads")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	app.logger.WithFields(logrus.Fields{
+		"user":     username,
+		"imported": imported,
+	}).Info("imported reading states from downloads")
+
+	c.Redirect(302, "/?status=reading")
+}
+
+func (app *booksingApp) showYear(c *gin.Context) {
+	username := c.MustGet("id").(*booksing.User).Name
+
+	tz := app.settings().timezone
+	year := time.Now().In(tz).Year()
+	if y := c.Param("year"); y != "" {
+		var err error
+		year, err = strconv.Atoi(y)
+		if err != nil {
+			c.HTML(400, "error.html", V{
+				Error: fmt.Errorf("Invalid year: %w", err),
+			})
+			return
+		}
+	}
+
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, tz)
+	states, err := app.db.GetFinished(username, from, from.AddDate(1, 0, 0))
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	summary := readingSummary{
+		Year: year,
+	}
+	var rated, ratingTotal int
+	for _, s := range states {
+		b, err := app.db.GetBook(s.BookID)
+		if err != nil {
+			app.logger.WithField("id", s.BookID).WithError(err).Warning("could not get finished book")
+			continue
+		}
+		summary.Finished = append(summary.Finished, finishedEntry{
+			State: s,
+			Book:  b,
+		})
+		summary.PerMonth[s.Finished.In(tz).Month()-1]++
+		if s.Rating > 0 {
+			rated++
+			ratingTotal += s.Rating
+		}
+	}
+	if rated > 0 {
+		summary.AverageRating = float64(ratingTotal) / float64(rated)
+	}
+
+	c.HTML(200, "year.html", V{
+		Summary:    &summary,
+		IsAdmin:    c.GetBool("isAdmin"),
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+	})
+}
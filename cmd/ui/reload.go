@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/gnur/booksing"
+	log "github.com/sirupsen/logrus"
+)
+
+// settings returns the settings booksing runs with now
+func (app *booksingApp) settings() *settings {
+	return app.current.Load()
+}
+
+// reload reads the configuration and the templates again, requests that are running finish with the settings they
+// started with. Restart fields keep their value, the variables of the ones that changed are returned.
+func (app *booksingApp) reload() ([]string, error) {
+	app.reloading.Lock()
+	defer app.reloading.Unlock()
+
+	s, err := app.loader.load()
+	if err != nil {
+		return nil, err
+	}
+	restart := s.keepRestartFields(app.settings().cfg)
+	log.SetLevel(s.logLevel)
+	app.current.Store(s)
+
+	l := app.logger.WithField("file", app.loader.file())
+	if len(restart) > 0 {
+		l = l.WithField("restart", strings.Join(restart, ","))
+	}
+	l.Info("reloaded the configuration and templates")
+	return restart, nil
+}
+
+// htmlRender renders the templates of the settings at the time of the request
+type htmlRender struct {
+	app *booksingApp
+}
+
+func (r htmlRender) Instance(name string, data any) render.Render {
+	return render.HTML{
+		Template: r.app.settings().templates,
+		Name:     name,
+		Data:     data,
+	}
+}
+
+// csrfToken is the token a form of user sends along, a form on another site can not know it
+func (app *booksingApp) csrfToken(user string) string {
+	mac := hmac.New(sha256.New, app.csrfKey)
+	mac.Write([]byte(user))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF refuses forms that do not have the token of the user that sends them
+func (app *booksingApp) checkCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("id").(*booksing.User)
+		if !hmac.Equal([]byte(c.PostForm("csrf")), []byte(app.csrfToken(user.Name))) {
+			c.HTML(403, "error.html", V{
+				Error: errors.New("this form was not sent from booksing, reload the page and try again"),
+			})
+			c.Abort()
+		}
+	}
+}
+
+// showReload shows where the configuration is read from and a button to read it again
+func (app *booksingApp) showReload(c *gin.Context) {
+	c.HTML(200, "reload.html", app.reloadPage(c))
+}
+
+// reloadConfig reads the configuration and templates again without restarting booksing
+func (app *booksingApp) reloadConfig(c *gin.Context) {
+	restart, err := app.reload()
+	if err != nil {
+		app.logger.WithError(err).Error("could not reload")
+		page := app.reloadPage(c)
+		page.Error = err
+		c.HTML(400, "reload.html", page)
+		return
+	}
+	page := app.reloadPage(c)
+	page.Reloaded = true
+	page.Restart = restart
+	c.HTML(200, "reload.html", page)
+}
+
+func (app *booksingApp) reloadPage(c *gin.Context) V {
+	user := c.MustGet("id").(*booksing.User)
+	s := app.settings()
+	return V{
+		IsAdmin:     true,
+		TotalBooks:  app.db.GetBookCount(),
+		Indexing:    app.state == "indexing",
+		CSRF:        app.csrfToken(user.Name),
+		ConfigFile:  app.loader.file(),
+		TemplateDir: s.cfg.TemplateDir,
+		Loaded:      s.loaded,
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/epub"
+	"github.com/sirupsen/logrus"
+)
+
+// cloudTag is a tag in the tag cloud, Size is its font size in rem and grows with the number of books
+type cloudTag struct {
+	booksing.FacetCount
+	Size float64
+}
+
+// tagCloud sizes tags between 0.8 and 2 rem, on a log scale so a few very common tags do not dwarf all others
+func tagCloud(tags []booksing.FacetCount) []cloudTag {
+	var most int64 = 1
+	for _, t := range tags {
+		if t.Count > most {
+			most = t.Count
+		}
+	}
+	cloud := make([]cloudTag, 0, len(tags))
+	for _, t := range tags {
+		size := 0.8
+		if most > 1 {
+			size += 1.2 * math.Log(float64(t.Count)) / math.Log(float64(most))
+		}
+		cloud = append(cloud, cloudTag{FacetCount: t, Size: math.Round(size*100) / 100})
+	}
+	return cloud
+}
+
+// showTags shows every tag sized by its number of books, admins can rename and merge them
+func (app *booksingApp) showTags(c *gin.Context) {
+	tags, err := app.db.GetTags()
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	c.HTML(200, "tags.html", V{
+		IsAdmin:    c.GetBool("isAdmin"),
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+		Tags:       tagCloud(tags),
+	})
+}
+
+// renameTag gives a tag another name, when a tag with that name exists the two are merged
+func (app *booksingApp) renameTag(c *gin.Context) {
+	from := booksing.TagName(c.PostForm("from"))
+	to := booksing.TagName(c.PostForm("to"))
+	if from == "" || to == "" {
+		c.HTML(400, "error.html", V{
+			Error: errors.New("a tag needs a name"),
+		})
+		return
+	}
+
+	err := app.db.RenameTag(from, to)
+	if errors.Is(err, booksing.ErrNotFound) {
+		c.HTML(404, "error.html", V{
+			Error: fmt.Errorf("there is no tag %q", from),
+		})
+		return
+	}
+	if err != nil {
+		app.logger.WithError(err).Error("could not rename tag")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	app.logger.WithFields(logrus.Fields{
+		"from": from,
+		"to":   to,
+	}).Info("renamed tag")
+	app.recentCache = nil
+	c.Redirect(302, "/tags")
+}
+
+// setBookTags replaces the tags of a book by the tags in the form, separated by commas or new lines
+func (app *booksingApp) setBookTags(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.HTML(400, "error.html", V{
+			Error: fmt.Errorf("invalid book %q", c.Param("id")),
+		})
+		return
+	}
+	names := strings.FieldsFunc(c.PostForm("tags"), func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+
+	err = app.db.SetBookTags(uint(id), names)
+	if err != nil {
+		app.logger.WithError(err).Error("could not set tags")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	app.recentCache = nil
+	c.Redirect(302, fmt.Sprintf("/detail/%d", id))
+}
+
+// tagBooks gives the books without tags the tags of the subjects in their files, it returns how many were tagged
+func (app *booksingApp) tagBooks() (int, error) {
+	books, err := app.db.GetUntaggedBooks()
+	if err != nil {
+		return 0, err
+	}
+	tagged := 0
+	for _, b := range books {
+		e, _, err := epub.ParseFile(b.Path)
+		if err != nil {
+			app.logger.WithError(err).WithField("path", b.Path).Warning("could not read subjects")
+			continue
+		}
+		tags := booksing.ParseSubjects(e.Subjects)
+		if len(tags) == 0 {
+			continue
+		}
+		err = app.db.SetBookTags(b.ID, tags)
+		if err != nil {
+			return tagged, err
+		}
+		tagged++
+	}
+	return tagged, nil
+}
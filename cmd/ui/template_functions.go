@@ -10,12 +10,27 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/gnur/booksing"
 )
 
 var templateFunctions = template.FuncMap{
 	"percent": func(a, b int) float64 {
 		return float64(a) / float64(b) * 100
 	},
+	"progress": func(f float64) string {
+		return fmt.Sprintf("%.0f%%", f*100)
+	},
+	"seq": func(from, to int) []int {
+		var s []int
+		for i := from; i <= to; i++ {
+			s = append(s, i)
+		}
+		return s
+	},
+	"month": func(i int) string {
+		return time.Month(i + 1).String()
+	},
 	"safeHTML": func(s interface{}) template.HTML {
 		return template.HTML(fmt.Sprint(s))
 	},
@@ -47,6 +62,13 @@ var templateFunctions = template.FuncMap{
 		return fmt.Sprintf("%.1f %ciB",
 			float64(b)/float64(div), "KMGTPE"[exp])
 	},
+	// duration rounds d to what is worth reading: milliseconds below a second and seconds above
+	"duration": func(d time.Duration) string {
+		if d < time.Second {
+			return d.Round(time.Millisecond).String()
+		}
+		return d.Round(time.Second).String()
+	},
 	"nl2br": func(str string) template.HTML {
 		return template.HTML(strings.Replace(str, "\n", "<br />", -1))
 	},
@@ -95,7 +117,8 @@ var templateFunctions = template.FuncMap{
 	"Iterate": func(offset, limit int64, results int64) [][2]int64 {
 		var i int64
 		var Items [][2]int64
-		for i = 0; i <= (results / limit); i++ {
+		pages := (results + limit - 1) / limit
+		for i = 0; i < pages; i++ {
 			Items = append(Items, [2]int64{
 				i + 1,
 				i * limit,
@@ -112,7 +135,7 @@ var templateFunctions = template.FuncMap{
 		}
 		if len(Items) > 8 {
 			l := len(Items)
-			itemIndices = append(itemIndices, l-3, l-2, l-2)
+			itemIndices = append(itemIndices, l-3, l-2, l-1)
 		}
 
 		properIndices := func(a []int) []int {
@@ -161,22 +184,70 @@ var templateFunctions = template.FuncMap{
 		}
 		return template.HTML(t.Format("2006-01-02 15:04:05"))
 	},
-	"page": func(dir, q string, offset, limit int64) template.URL {
+	"page": func(dir string, params url.Values, offset, limit int64) template.URL {
 		v := url.Values{}
-		v.Add("q", q)
-		v.Add("l", fmt.Sprintf("%v", limit))
-		if dir == "next" {
+		for k, vals := range params {
+			v[k] = vals
+		}
+		v.Set("l", fmt.Sprintf("%v", limit))
+		if dir == "at" {
+			v.Set("o", fmt.Sprintf("%v", offset))
+		} else if dir == "next" {
 			start := offset + limit
-			v.Add("o", fmt.Sprintf("%v", start))
+			v.Set("o", fmt.Sprintf("%v", start))
 		} else {
 			start := offset - limit
 			if start > 0 {
-				v.Add("o", fmt.Sprintf("%v", start))
+				v.Set("o", fmt.Sprintf("%v", start))
 			}
 		}
 		return template.URL(v.Encode())
 
 	},
+	"sortOptions": func() []string {
+		return booksing.SortOptions
+	},
+	"facet": func(params url.Values, key, label string, values []booksing.FacetCount) facetView {
+		return facetView{
+			Params:   params,
+			Key:      key,
+			Label:    label,
+			Selected: params.Get(key),
+			Values:   values,
+		}
+	},
+	"withParam": func(params url.Values, key, value string) template.URL {
+		v := url.Values{}
+		for k, vals := range params {
+			v[k] = vals
+		}
+		if value == "" {
+			v.Del(key)
+		} else {
+			v.Set(key, value)
+		}
+		return template.URL(v.Encode())
+	},
+	"fieldSearch": func(field, value string) template.URL {
+		v := url.Values{}
+		v.Add("q", fmt.Sprintf(`%s:"%s"`, field, strings.ReplaceAll(value, `"`, " ")))
+		return template.URL(v.Encode())
+	},
+	// languages returns the first of editions in every language except skip, to link to a work in each language it has
+	"languages": func(editions []booksing.Book, skip string) []booksing.Book {
+		var first []booksing.Book
+		seen := map[string]bool{skip: true}
+		for _, b := range editions {
+			if !seen[b.Language] {
+				seen[b.Language] = true
+				first = append(first, b)
+			}
+		}
+		return first
+	},
+	"languageName": booksing.LanguageName,
+	"flag":         booksing.LanguageFlag,
+	"join":         strings.Join,
 	"json": func(s interface{}) template.HTML {
 		json, _ := json.MarshalIndent(s, "", "  ")
 		return template.HTML(strings.Replace(string(json), "\n", "<br />", -1))
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gnur/booksing"
+)
+
+func TestIterate(t *testing.T) {
+	gap := [2]int64{-1, -1}
+	tests := []struct {
+		name    string
+		offset  int64
+		limit   int64
+		results int64
+		want    [][2]int64
+	}{
+		{
+			name:    "no results",
+			offset:  0,
+			limit:   20,
+			results: 0,
+			want:    nil,
+		},
+		{
+			name:    "partial last page",
+			offset:  0,
+			limit:   20,
+			results: 45,
+			want:    [][2]int64{{1, 0}, {2, 20}, {3, 40}},
+		},
+		{
+			name:    "full last page",
+			offset:  20,
+			limit:   20,
+			results: 40,
+			want:    [][2]int64{{1, 0}, {2, 20}},
+		},
+		{
+			name:    "first page of many",
+			offset:  0,
+			limit:   20,
+			results: 400,
+			want:    [][2]int64{{1, 0}, {2, 20}, {3, 40}, gap, {18, 340}, {19, 360}, {20, 380}},
+		},
+		{
+			name:    "middle page of many",
+			offset:  200,
+			limit:   20,
+			results: 400,
+			want:    [][2]int64{{1, 0}, {2, 20}, {3, 40}, gap, {10, 180}, {11, 200}, {12, 220}, gap, {18, 340}, {19, 360}, {20, 380}},
+		},
+	}
+	iterate := templateFunctions["Iterate"].(func(int64, int64, int64) [][2]int64)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := iterate(tt.offset, tt.limit, tt.results)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Iterate(%d, %d, %d) = %v, want %v", tt.offset, tt.limit, tt.results, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	editions := []booksing.Book{
+		{Title: "Der Hobbit", Language: "de"},
+		{Title: "The Hobbit", Language: "en"},
+		{Title: "The Hobbit, or There and Back Again", Language: "en"},
+		{Title: "De Hobbit", Language: "nl"},
+	}
+	languages := templateFunctions["languages"].(func([]booksing.Book, string) []booksing.Book)
+
+	var titles []string
+	for _, b := range languages(editions, "en") {
+		titles = append(titles, b.Title)
+	}
+	if want := []string{"Der Hobbit", "De Hobbit"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("languages(editions, en) = %v, want %v", titles, want)
+	}
+	if got := languages(editions, ""); len(got) != 3 || got[1].Title != "The Hobbit" {
+		t.Errorf("languages(editions) = %v, want the first edition of every language", got)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
-	"time"
+	"net/url"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gnur/booksing"
 	"github.com/gnur/slev"
@@ -10,38 +12,59 @@ import (
 
 // booksingApp holds all relevant global stuff for the booksing server
 type booksingApp struct {
-	db         database
+	db         booksing.Database
 	canConvert bool
 	bookDir    string
 	slev       *slev.Slev
 	//importDir is very important
 	importDir   string
 	logger      *logrus.Entry
-	timezone    *time.Location
-	adminUser   string
-	cfg         configuration
 	state       string
 	recentCache *booksing.SearchResult
+	// current are the settings from the configuration, loader reads them again on a reload
+	current   atomic.Pointer[settings]
+	loader    *configLoader
+	reloading sync.Mutex
+	// csrfKey signs the tokens of forms that must come from booksing
+	csrfKey []byte
+	// imports follows the running import job, refreshNow starts an import without waiting for the next minute
+	imports    importTracker
+	refreshNow chan struct{}
+	// stopping is closed when booksing stops, responses that never end stop then
+	stopping <-chan struct{}
 }
 
-type database interface {
-	AddDownload(booksing.Download) error
-	GetDownloads(int) ([]booksing.Download, error)
-
-	SaveUser(*booksing.User) error
-	GetUser(string) (booksing.User, error)
-
-	GetUsers() ([]booksing.User, error)
+// readingEntry combines a reported reading position with the book it belongs to
+type readingEntry struct {
+	Progress booksing.Progress
+	Book     *booksing.Book
+}
 
-	GetBookCount() int
+// finishedEntry is a finished book as shown on the yearly reading summary
+type finishedEntry struct {
+	State booksing.ReadingState
+	Book  *booksing.Book
+}
 
-	HasHash(string) (bool, error)
+// readingSummary holds the statistics of a single year of reading
+type readingSummary struct {
+	Year          int
+	Finished      []finishedEntry
+	PerMonth      [12]int
+	AverageRating float64
+}
 
-	Close()
+// proposalGroup are the proposed changes to a single book
+type proposalGroup struct {
+	Book      *booksing.Book
+	Proposals []booksing.Proposal
+}
 
-	AddBooks([]booksing.Book) error
-	AddBook(booksing.Book) error
-	GetBook(string) (*booksing.Book, error)
-	DeleteBook(string) error
-	GetBooks(string, int64, int64) (*booksing.SearchResult, error)
+// facetView is everything the facet template needs to render a single facet in the search sidebar
+type facetView struct {
+	Params   url.Values
+	Key      string
+	Label    string
+	Selected string
+	Values   []booksing.FacetCount
 }
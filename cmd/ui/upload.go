@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/epub"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// uploadDir is the directory in the import dir that uploads are imported from, every user has their own
+	uploadDir = "uploads"
+	// stagingDir is the directory in the import dir that holds uploads while they are received and checked, their
+	// names do not end in .epub so refresh never imports a file that is not complete
+	stagingDir = ".staging"
+	// shownUploads is how many uploads the upload page lists
+	shownUploads = 100
+)
+
+// showUploads shows the upload form and the latest uploads of the user, admins see the uploads of everyone
+func (app *booksingApp) showUploads(c *gin.Context) {
+	user := c.MustGet("id").(*booksing.User)
+	uploader := user.Name
+	if user.IsAdmin {
+		uploader = ""
+	}
+	uploads, err := app.db.GetUploads(uploader, shownUploads)
+	if err != nil {
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	c.HTML(200, "upload.html", V{
+		IsAdmin:    user.IsAdmin,
+		Username:   user.Name,
+		TotalBooks: app.db.GetBookCount(),
+		Indexing:   app.state == "indexing",
+		Uploads:    uploads,
+		MaxSize:    app.settings().cfg.MaxSize,
+	})
+}
+
+// upload streams the files of the form into the staging area, every file that is an epub moves on to the upload dir
+// of the user for refresh to import it
+func (app *booksingApp) upload(c *gin.Context) {
+	if app.importDir == "" {
+		c.HTML(400, "error.html", V{
+			Error: errors.New("uploads need an import dir, set BOOKSING_IMPORTDIR"),
+		})
+		return
+	}
+	user := c.MustGet("id").(*booksing.User)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.HTML(400, "error.html", V{
+			Error: fmt.Errorf("no files were uploaded: %w", err),
+		})
+		return
+	}
+
+	accepted := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			app.logger.WithError(err).Warning("upload was interrupted")
+			c.HTML(400, "error.html", V{
+				Error: fmt.Errorf("the upload was interrupted: %w", err),
+			})
+			return
+		}
+		if part.FormName() != "books" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		u := app.receiveUpload(user.Name, part)
+		part.Close()
+		err = app.db.AddUpload(&u)
+		if err != nil {
+			app.logger.WithError(err).Error("could not store upload")
+			c.HTML(500, "error.html", V{
+				Error: err,
+			})
+			return
+		}
+		app.logger.WithFields(logrus.Fields{
+			"user":   u.Uploader,
+			"file":   u.Filename,
+			"status": u.Status,
+			"reason": u.Message,
+		}).Info("received upload")
+		if u.Status == booksing.UploadPending {
+			accepted++
+		}
+	}
+
+	if accepted > 0 {
+		app.triggerRefresh()
+	}
+	c.Redirect(302, "/upload")
+}
+
+// receiveUpload stores the file in part in the staging area and checks it, a file that passes is moved to the upload
+// dir of user. The upload that is returned says whether the file was accepted.
+func (app *booksingApp) receiveUpload(user string, part *multipart.Part) booksing.Upload {
+	u := booksing.Upload{
+		Created:  time.Now().In(app.settings().timezone),
+		Uploader: user,
+		Filename: filepath.Base(part.FileName()),
+		Status:   booksing.UploadRejected,
+	}
+	if !strings.EqualFold(filepath.Ext(u.Filename), ".epub") {
+		u.Message = "only epub files can be uploaded"
+		return u
+	}
+
+	staged, size, err := app.stage(part)
+	u.Size = size
+	if err != nil {
+		u.Message = err.Error()
+		return u
+	}
+	defer os.Remove(staged)
+
+	err = epub.Validate(staged)
+	if err != nil {
+		u.Message = err.Error()
+		return u
+	}
+
+	dir := filepath.Join(app.importDir, uploadDir, dirName(user))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		app.logger.WithError(err).Error("could not create upload dir")
+		u.Status = booksing.UploadFailed
+		u.Message = "the file could not be stored"
+		return u
+	}
+	u.Path = freePath(filepath.Join(dir, u.Filename))
+	err = os.Rename(staged, u.Path)
+	if err != nil {
+		app.logger.WithError(err).Error("could not move upload out of the staging area")
+		u.Status = booksing.UploadFailed
+		u.Message = "the file could not be stored"
+		u.Path = ""
+		return u
+	}
+	u.Status = booksing.UploadPending
+	return u
+}
+
+// stage writes r to a new file in the staging area and returns its path and size, files larger than MaxSize are
+// removed again
+func (app *booksingApp) stage(r io.Reader) (string, int64, error) {
+	dir := filepath.Join(app.importDir, stagingDir)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		app.logger.WithError(err).Error("could not create staging dir")
+		return "", 0, errors.New("the file could not be stored")
+	}
+	f, err := os.CreateTemp(dir, "upload-*.part")
+	if err != nil {
+		app.logger.WithError(err).Error("could not create staging file")
+		return "", 0, errors.New("the file could not be stored")
+	}
+
+	maxSize := app.settings().cfg.MaxSize
+	if maxSize > 0 {
+		// one byte more than allowed is enough to know the file is too large
+		r = io.LimitReader(r, maxSize+1)
+	}
+	size, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", size, fmt.Errorf("the file could not be received: %w", err)
+	}
+	if maxSize > 0 && size > maxSize {
+		os.Remove(f.Name())
+		return "", size, fmt.Errorf("the file is larger than the maximum of %d bytes", maxSize)
+	}
+	return f.Name(), size, nil
+}
+
+// dirName returns name with only the characters that are safe in the name of a directory
+func dirName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("@-_", r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// freePath returns p, or p with a number added before its extension when a file with that name exists already
+func freePath(p string) string {
+	ext := filepath.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return p
+		}
+		p = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// pendingUploads returns the uploads that wait for refresh by path
+func (app *booksingApp) pendingUploads() map[string]booksing.Upload {
+	uploads := make(map[string]booksing.Upload)
+	pending, err := app.db.GetPendingUploads()
+	if err != nil {
+		app.logger.WithError(err).Error("could not load pending uploads, their results are not recorded")
+		return uploads
+	}
+	for _, u := range pending {
+		uploads[u.Path] = u
+	}
+	return uploads
+}
+
+// uploadResult stores what the import made of the file at path when it was uploaded
+func (app *booksingApp) uploadResult(uploads map[string]booksing.Upload, path string, status booksing.UploadStatus, message string, book uint) {
+	if _, ok := uploads[path]; !ok {
+		return
+	}
+	err := app.db.SetUploadResult(path, status, message, book)
+	if err != nil {
+		app.logger.WithError(err).WithField("path", path).Error("could not store the result of an upload")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gnur/booksing"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReceiveUpload(t *testing.T) {
+	book, err := os.ReadFile(filepath.Join("..", "..", "testdata", "import", "gutenberg", "pg11.epub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	app := booksingApp{
+		importDir: dir,
+		logger:    logrus.NewEntry(logrus.New()),
+	}
+	app.current.Store(&settings{cfg: configuration{MaxSize: int64(len(book))}, timezone: time.UTC})
+
+	files := []struct {
+		name    string
+		content []byte
+		status  booksing.UploadStatus
+		path    string
+	}{
+		{name: "alice.epub", content: book, status: booksing.UploadPending, path: "alice.epub"},
+		{name: "alice.epub", content: book, status: booksing.UploadPending, path: "alice (2).epub"},
+		{name: "notes.txt", content: []byte("notes"), status: booksing.UploadRejected},
+		{name: "fake.epub", content: []byte("not a zip"), status: booksing.UploadRejected},
+		{name: "large.epub", content: append(book, 0), status: booksing.UploadRejected},
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, f := range files {
+		fw, err := w.CreateFormFile("books", f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(f.content)
+	}
+	w.Close()
+
+	r := multipart.NewReader(&body, w.Boundary())
+	for _, f := range files {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := app.receiveUpload("erwin@example.com", part)
+		if u.Status != f.status || u.Uploader != "erwin@example.com" || u.Filename != f.name {
+			t.Errorf("receiveUpload(%s) = %+v, want status %s", f.name, u, f.status)
+		}
+		if f.path == "" {
+			if u.Path != "" || u.Message == "" {
+				t.Errorf("receiveUpload(%s) = %+v, want no path and a reason", f.name, u)
+			}
+			continue
+		}
+		want := filepath.Join(dir, uploadDir, "erwin@example_com", f.path)
+		if u.Path != want || u.Size != int64(len(book)) {
+			t.Errorf("receiveUpload(%s) stored %s of %d bytes, want %s of %d bytes", f.name, u.Path, u.Size, want, len(book))
+		}
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("receiveUpload(%s) did not store the file: %v", f.name, err)
+		}
+	}
+
+	staged, err := os.ReadDir(filepath.Join(dir, stagingDir))
+	if err != nil || len(staged) != 0 {
+		t.Errorf("staging dir holds %d files, %v, want it empty", len(staged), err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// linkWork makes a book an edition of the work of another book, which is given by its id, its hash or the url of its detail page
+func (app *booksingApp) linkWork(c *gin.Context) {
+	book, _, err := app.findBook(c.Param("id"))
+	if err != nil {
+		c.HTML(404, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	to, _, err := app.findBook(path.Base(strings.TrimSpace(c.PostForm("to"))))
+	if err != nil {
+		c.HTML(404, "error.html", V{
+			Error: fmt.Errorf("could not find the book to link to: %w", err),
+		})
+		return
+	}
+
+	err = app.db.LinkWork(book.ID, to.ID)
+	if err != nil {
+		app.logger.WithError(err).Error("could not link book")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	app.recentCache = nil
+	app.logger.WithFields(logrus.Fields{
+		"id": book.ID,
+		"to": to.ID,
+	}).Info("book was linked to another work")
+	c.Redirect(302, fmt.Sprintf("/detail/%d", book.ID))
+}
+
+// unlinkWork takes a book out of its work, it becomes a work of its own
+func (app *booksingApp) unlinkWork(c *gin.Context) {
+	book, _, err := app.findBook(c.Param("id"))
+	if err != nil {
+		c.HTML(404, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+
+	err = app.db.UnlinkWork(book.ID)
+	if err != nil {
+		app.logger.WithError(err).Error("could not unlink book")
+		c.HTML(500, "error.html", V{
+			Error: err,
+		})
+		return
+	}
+	app.recentCache = nil
+	app.logger.WithField("id", book.ID).Info("book was unlinked from its work")
+	c.Redirect(302, fmt.Sprintf("/detail/%d", book.ID))
+}
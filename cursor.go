@@ -0,0 +1,35 @@
+package booksing
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EncodeCursor returns an opaque cursor pointing at b, for keyset paging through newest first results
+func EncodeCursor(b Book) string {
+	s := b.Added.Format(time.RFC3339Nano) + "|" + strconv.FormatUint(uint64(b.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// DecodeCursor returns the added time and id of the book a cursor points at
+func DecodeCursor(cursor string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	added, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, added)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return t, uint(n), nil
+}
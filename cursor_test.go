@@ -0,0 +1,34 @@
+package booksing
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCursor(t *testing.T) {
+	added := time.Date(2023, 4, 5, 6, 7, 8, 9, time.FixedZone("CEST", 2*60*60))
+	b := Book{
+		Model: gorm.Model{ID: 42},
+		Added: added,
+	}
+
+	gotAdded, gotID, err := DecodeCursor(EncodeCursor(b))
+	if err != nil {
+		t.Fatalf("DecodeCursor() error = %v", err)
+	}
+	if !gotAdded.Equal(added) || gotID != 42 {
+		t.Errorf("DecodeCursor() = %v, %d, want %v, 42", gotAdded, gotID, added)
+	}
+	// the cursor is compared to the stored timestamps as text, so the offset has to survive as well
+	if gotAdded.Format(time.RFC3339Nano) != added.Format(time.RFC3339Nano) {
+		t.Errorf("DecodeCursor() = %v, want the same offset as %v", gotAdded, added)
+	}
+
+	for _, cursor := range []string{"", "not base64!", "bm8gc2VwYXJhdG9y", "MjAyMy0wNC0wNXw0Mg"} {
+		if _, _, err := DecodeCursor(cursor); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) error = %v, want %v", cursor, err, ErrInvalidCursor)
+		}
+	}
+}
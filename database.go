@@ -0,0 +1,84 @@
+package booksing
+
+import (
+	"time"
+
+	"github.com/gnur/booksing/migrate"
+)
+
+// Database is the storage of booksing, every backend implements it and passes the conformance tests in dbtest
+type Database interface {
+	AddDownload(Download) error
+	GetDownloads(int) ([]Download, error)
+
+	SaveUser(*User) error
+	GetUser(string) (User, error)
+	GetUsers() ([]User, error)
+
+	GetBookCount() int
+	HasHash(string) (bool, error)
+
+	Close()
+
+	AddBooks([]Book) ([]Book, error)
+	AddBook(Book) error
+	GetBook(uint) (*Book, error)
+	GetBookByHash(string) (*Book, error)
+	GetBookByChecksum(string) (*Book, error)
+	GetBooksWithoutChecksum() ([]Book, error)
+	SetChecksum(uint, string) error
+	DeleteBook(uint) error
+	GetBooks(SearchQuery) (*SearchResult, error)
+	RebuildSearchIndex() error
+	UpdateSpellingIndex() error
+	UpdateCompletionIndex() error
+	Complete(string, int) (*Completions, error)
+	Rehash() (*RehashResult, error)
+	ResolveHash(string) (string, error)
+	GroupWorks() error
+	LinkWork(uint, uint) error
+	UnlinkWork(uint) error
+	GetEditions(...uint) ([]Book, error)
+	GetIncompleteBooks() ([]Book, error)
+	UpdateBook(*Book, ...string) error
+	SaveProposals([]Proposal) error
+	GetProposals() ([]Proposal, error)
+	GetProposal(uint) (*Proposal, error)
+	DeleteProposal(uint) error
+	MergeAuthors(string, []string) error
+	GetAuthors() ([]Author, error)
+	GetAuthorAliases() (AuthorAliases, error)
+	DeleteAuthorAlias(uint) error
+	GetAuthorCounts() ([]FacetCount, error)
+	GetBooksByAuthor(...string) ([]Book, error)
+	GetTags() ([]FacetCount, error)
+	SetBookTags(uint, []string) error
+	RenameTag(string, string) error
+	GetUntaggedBooks() ([]Book, error)
+	AddUpload(*Upload) error
+	GetUploads(string, int) ([]Upload, error)
+	GetPendingUploads() ([]Upload, error)
+	SetUploadResult(string, UploadStatus, string, uint) error
+	FinishUploads() error
+	SaveImportJob(*ImportJob) error
+	AddImportFiles([]ImportFile) error
+	GetImportJobs(int) ([]ImportJob, error)
+	GetImportJob(uint) (*ImportJob, []ImportFile, error)
+	GetImportedPaths() (map[string]bool, error)
+	StopUnfinishedImports() (int64, error)
+
+	SaveProgress(*Progress) error
+	GetProgress(string, string) (*Progress, error)
+	GetBookProgress(string, uint) (*Progress, error)
+	GetRecentProgress(string, int) ([]Progress, error)
+
+	SaveReadingState(*ReadingState) error
+	GetReadingState(string, uint) (*ReadingState, error)
+	DeleteReadingState(string, uint) error
+	GetFinished(string, time.Time, time.Time) ([]ReadingState, error)
+	ImportDownloads(string) (int64, error)
+
+	Migrations() ([]migrate.Status, error)
+	Migrate() error
+	Backup(string) error
+}
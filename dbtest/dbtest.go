@@ -0,0 +1,1239 @@
+// Package dbtest holds the conformance tests that every database backend of booksing has to pass,
+// so search and storage behave the same whichever backend is configured.
+package dbtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/query"
+)
+
+// Run runs all conformance tests, open has to return a new and empty database on every call
+func Run(t *testing.T, open func(t *testing.T) booksing.Database) {
+	t.Run("users", func(t *testing.T) { testUsers(t, open(t)) })
+	t.Run("books", func(t *testing.T) { testBooks(t, open(t)) })
+	t.Run("search", func(t *testing.T) { testSearch(t, open(t)) })
+	t.Run("paging", func(t *testing.T) { testPaging(t, open(t)) })
+	t.Run("suggestions", func(t *testing.T) { testSuggestions(t, open(t)) })
+	t.Run("reading", func(t *testing.T) { testReading(t, open(t)) })
+	t.Run("rehash", func(t *testing.T) { testRehash(t, open(t)) })
+	t.Run("works", func(t *testing.T) { testWorks(t, open(t)) })
+	t.Run("metadata", func(t *testing.T) { testMetadata(t, open(t)) })
+	t.Run("authors", func(t *testing.T) { testAuthors(t, open(t)) })
+	t.Run("tags", func(t *testing.T) { testTags(t, open(t)) })
+	t.Run("uploads", func(t *testing.T) { testUploads(t, open(t)) })
+	t.Run("imports", func(t *testing.T) { testImports(t, open(t)) })
+	t.Run("migrations", func(t *testing.T) { testMigrations(t, open(t)) })
+}
+
+// day returns midnight UTC of the given date
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+// library are the books used in the search tests, the newest book is last
+var library = []booksing.Book{
+	{Hash: "tolkienhobbit", Author: "J.R.R. Tolkien", Title: "The Hobbit", Language: "en", Series: "Middle-earth", SeriesIndex: 1, Publisher: "Allen & Unwin", ISBN: "9780261102217", Size: 300 * 1024, PublishDate: day(1937, 9, 21), Added: day(2022, 1, 1), Description: "A hobbit goes on an adventure with dwarves"},
+	{Hash: "tolkienfellowship", Author: "J.R.R. Tolkien", Title: "The Fellowship of the Ring", Language: "en", Series: "Middle-earth", SeriesIndex: 2, Publisher: "Allen & Unwin", Size: 2 * 1024 * 1024, PublishDate: day(1954, 7, 29), Added: day(2022, 6, 1), Description: "The ring has to be destroyed"},
+	{Hash: "lewislion", Author: "C.S. Lewis", Title: "The Lion, the Witch and the Wardrobe", Language: "en", Series: "Narnia", SeriesIndex: 1, Publisher: "Geoffrey Bles", Size: 500 * 1024, PublishDate: day(1950, 10, 16), Added: day(2023, 1, 15), Description: "Four children find a wardrobe"},
+	{Hash: "zafonshadow", Author: "Carlos Ruiz Zafón", Title: "La Sombra Del Viento", Language: "es", Publisher: "Planeta", Size: 1024 * 1024, PublishDate: day(2001, 1, 1), Added: day(2023, 3, 1), Description: "Barcelona, un cementerio de libros olvidados"},
+	{Hash: "bjorkjongen", Author: "Samuel Bjørk", Title: "De Jongen In De Sneeuw", Language: "nl", Publisher: "Boekerij", Size: 800 * 1024, Added: day(2023, 5, 1), Description: "Een thriller uit Noorwegen"},
+	{Hash: "dickenstwist", Author: "Charles Dickens", Title: "Oliver Twist", Language: "en", Publisher: "Bentley", Size: 700 * 1024, PublishDate: day(1838, 1, 1), Added: day(2023, 7, 1), HasCover: true, Description: "An orphan in London"},
+	{Hash: "dickenscarol", Author: "Charles Dickens", Title: "A Christmas Carol", Language: "en", Publisher: "Chapman & Hall", Size: 200 * 1024, PublishDate: day(1843, 12, 19), Added: day(2023, 7, 1), HasCover: true, Description: "Scrooge meets three ghosts"},
+}
+
+func addLibrary(t *testing.T, db booksing.Database) {
+	t.Helper()
+	books := append([]booksing.Book{}, library...)
+	for i := range books {
+		books[i].Path = libraryPath(books[i])
+	}
+	_, err := db.AddBooks(books)
+	if err != nil {
+		t.Fatalf("AddBooks() error = %v", err)
+	}
+}
+
+// libraryPath is where the file of a book of the library is stored
+func libraryPath(b booksing.Book) string {
+	return "/books/" + b.Hash + ".epub"
+}
+
+// libraryID returns the id of the first book with hash
+func libraryID(t *testing.T, db booksing.Database, hash string) uint {
+	t.Helper()
+	b, err := db.GetBookByHash(hash)
+	if err != nil {
+		t.Fatalf("GetBookByHash(%s) error = %v", hash, err)
+	}
+	return b.ID
+}
+
+func hashes(books []booksing.Book) []string {
+	var h []string
+	for _, b := range books {
+		h = append(h, b.Hash)
+	}
+	return h
+}
+
+func equalSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, s := range a {
+		seen[s]++
+	}
+	for _, s := range b {
+		seen[s]--
+		if seen[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func equalLists(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUsers(t *testing.T, db booksing.Database) {
+	if _, err := db.GetUser("alice"); err != booksing.ErrNotFound {
+		t.Fatalf("GetUser() of an unknown user error = %v, want %v", err, booksing.ErrNotFound)
+	}
+
+	u := booksing.User{Name: "alice", IsAllowed: true}
+	if err := db.SaveUser(&u); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+	u, err := db.GetUser("alice")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	u.IsAdmin = true
+	if err := db.SaveUser(&u); err != nil {
+		t.Fatalf("SaveUser() of an existing user error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err := db.AddDownload(booksing.Download{User: "alice", BookID: 1, Timestamp: day(2023, 1, i+1)})
+		if err != nil {
+			t.Fatalf("AddDownload() error = %v", err)
+		}
+	}
+	dls, err := db.GetDownloads(2)
+	if err != nil {
+		t.Fatalf("GetDownloads() error = %v", err)
+	}
+	if len(dls) != 2 || !dls[0].Timestamp.Equal(day(2023, 1, 3)) {
+		t.Errorf("GetDownloads(2) = %v, want the 2 newest downloads", dls)
+	}
+
+	users, err := db.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 1 || !users[0].IsAdmin || users[0].Downloads != 3 {
+		t.Errorf("GetUsers() = %+v, want alice as admin with 3 downloads", users)
+	}
+}
+
+func testBooks(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	if n := db.GetBookCount(); n != len(library) {
+		t.Errorf("GetBookCount() = %d, want %d", n, len(library))
+	}
+
+	// files that are already stored are skipped without failing the batch
+	stored := library[0]
+	stored.Path = libraryPath(stored)
+	added, err := db.AddBooks([]booksing.Book{stored, {Hash: "new", Title: "New", Path: "/books/new.epub", Added: day(2024, 1, 1)}})
+	if err != nil {
+		t.Fatalf("AddBooks() with a duplicate error = %v", err)
+	}
+	if len(added) != 1 || added[0].Hash != "new" || added[0].ID == 0 {
+		t.Errorf("AddBooks() with a duplicate added %+v, want only the new book with its id", added)
+	}
+	if n := db.GetBookCount(); n != len(library)+1 {
+		t.Errorf("GetBookCount() after adding a duplicate = %d, want %d", n, len(library)+1)
+	}
+
+	b, err := db.GetBookByHash("zafonshadow")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	if b.Author != "Carlos Ruiz Zafón" || b.Size != 1024*1024 || !b.PublishDate.Equal(day(2001, 1, 1)) {
+		t.Errorf("GetBookByHash() = %+v, want the stored book", b)
+	}
+	if _, err := db.GetBookByHash("unknown"); err != booksing.ErrNotFound {
+		t.Errorf("GetBookByHash() of an unknown book error = %v, want %v", err, booksing.ErrNotFound)
+	}
+	byID, err := db.GetBook(b.ID)
+	if err != nil || byID.Hash != "zafonshadow" {
+		t.Errorf("GetBook(%d) = %v, %v, want zafonshadow", b.ID, byID.Hash, err)
+	}
+	if _, err := db.GetBook(b.ID + 1000); err != booksing.ErrNotFound {
+		t.Errorf("GetBook() of an unknown id error = %v, want %v", err, booksing.ErrNotFound)
+	}
+
+	if ok, err := db.HasHash("zafonshadow"); !ok || err != nil {
+		t.Errorf("HasHash() = %v, %v, want true", ok, err)
+	}
+	if ok, err := db.HasHash("unknown"); ok || err != nil {
+		t.Errorf("HasHash() of an unknown book = %v, %v, want false", ok, err)
+	}
+
+	missing, err := db.GetBooksWithoutChecksum()
+	if err != nil {
+		t.Fatalf("GetBooksWithoutChecksum() error = %v", err)
+	}
+	if len(missing) != len(library)+1 {
+		t.Errorf("GetBooksWithoutChecksum() returned %d books, want %d", len(missing), len(library)+1)
+	}
+	if err := db.SetChecksum(b.ID, "abc123"); err != nil {
+		t.Fatalf("SetChecksum() error = %v", err)
+	}
+	b, err = db.GetBookByChecksum("abc123")
+	if err != nil || b.Hash != "zafonshadow" {
+		t.Errorf("GetBookByChecksum() = %v, %v, want zafonshadow", b.Hash, err)
+	}
+
+	if err := db.DeleteBook(b.ID); err != nil {
+		t.Fatalf("DeleteBook() error = %v", err)
+	}
+	if _, err := db.GetBook(b.ID); err != booksing.ErrNotFound {
+		t.Errorf("GetBook() of a deleted book error = %v, want %v", err, booksing.ErrNotFound)
+	}
+	res, err := db.GetBooks(booksing.SearchQuery{Query: "zafon", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetBooks() error = %v", err)
+	}
+	if res.Total != 0 {
+		t.Errorf("GetBooks() found %v, want deleted books to be gone from the index", hashes(res.Items))
+	}
+
+	// another edition of a work is a book of its own that shares the hash
+	first, err := db.GetBookByHash("tolkienhobbit")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	edition := booksing.Book{Hash: "tolkienhobbit", Author: "J.R.R. Tolkien", Title: "De Hobbit", Language: "nl", Path: "/books/tolkienhobbit-nl.epub", Added: day(2024, 2, 1)}
+	if err := db.AddBook(edition); err != nil {
+		t.Fatalf("AddBook() of another edition error = %v", err)
+	}
+	res, err = db.GetBooks(booksing.SearchQuery{Query: "hobbit", Limit: 10})
+	if err != nil || res.Total != 2 {
+		t.Errorf("GetBooks(hobbit) = %v, %v, want both editions", res, err)
+	}
+	if b, err := db.GetBookByHash("tolkienhobbit"); err != nil || b.ID != first.ID {
+		t.Errorf("GetBookByHash() with two editions = %v, %v, want the first one", b, err)
+	}
+}
+
+func testSearch(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{q: "hobbit", want: []string{"tolkienhobbit"}},
+		{q: "tolkien ring", want: []string{"tolkienfellowship"}},
+		{q: `"christmas carol"`, want: []string{"dickenscarol"}},
+		{q: `"carol christmas"`, want: nil},
+		{q: "tolk*", want: []string{"tolkienhobbit", "tolkienfellowship"}},
+		{q: "author:dickens", want: []string{"dickenstwist", "dickenscarol"}},
+		{q: "title:dickens", want: nil},
+		{q: `author:"charles dickens" -title:carol`, want: []string{"dickenstwist"}},
+		{q: "dickens NOT twist", want: []string{"dickenscarol"}},
+		{q: "hobbit OR wardrobe", want: []string{"tolkienhobbit", "lewislion"}},
+		{q: "(author:tolkien OR author:lewis) -hobbit", want: []string{"tolkienfellowship", "lewislion"}},
+		{q: "series:narnia", want: []string{"lewislion"}},
+		{q: "publisher:unwin", want: []string{"tolkienhobbit", "tolkienfellowship"}},
+		{q: "description:scrooge", want: []string{"dickenscarol"}},
+		{q: "scrooge", want: []string{"dickenscarol"}},
+		{q: "zafon", want: []string{"zafonshadow"}},
+		{q: "author:Zafón", want: []string{"zafonshadow"}},
+		{q: "bjork", want: []string{"bjorkjongen"}},
+		{q: "lang:nl", want: []string{"bjorkjongen"}},
+		{q: "language:dutch", want: []string{"bjorkjongen"}},
+		{q: "isbn:978-0-261-10221-7", want: []string{"tolkienhobbit"}},
+		{q: "year:1900..1960", want: []string{"tolkienhobbit", "tolkienfellowship", "lewislion"}},
+		{q: "year:<1900", want: []string{"dickenstwist", "dickenscarol"}},
+		{q: "size:>1MB", want: []string{"tolkienfellowship"}},
+		{q: "added:2023-07", want: []string{"dickenstwist", "dickenscarol"}},
+		{q: "added:>=2023-05-01 lang:en", want: []string{"dickenstwist", "dickenscarol"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			res, err := db.GetBooks(booksing.SearchQuery{Query: tt.q, Limit: 20})
+			if err != nil {
+				t.Fatalf("GetBooks(%q) error = %v", tt.q, err)
+			}
+			if !equalSets(hashes(res.Items), tt.want) || res.Total != int64(len(tt.want)) {
+				t.Errorf("GetBooks(%q) = %v (total %d), want %v", tt.q, hashes(res.Items), res.Total, tt.want)
+			}
+		})
+	}
+
+	var qe *query.Error
+	if _, err := db.GetBooks(booksing.SearchQuery{Query: "a (b", Limit: 20}); !errors.As(err, &qe) {
+		t.Errorf("GetBooks() of an invalid query error = %v, want a *query.Error", err)
+	}
+	if _, err := db.GetBooks(booksing.SearchQuery{Query: "&&", Limit: 20}); !errors.As(err, &qe) {
+		t.Errorf("GetBooks() of a query without words error = %v, want a *query.Error", err)
+	}
+
+	sorts := []struct {
+		sq   booksing.SearchQuery
+		want []string
+	}{
+		{
+			sq:   booksing.SearchQuery{Query: "tolkien", Sort: "title"},
+			want: []string{"tolkienfellowship", "tolkienhobbit"},
+		},
+		{
+			sq:   booksing.SearchQuery{Query: "lang:en", Sort: "author"},
+			want: []string{"lewislion", "dickenscarol", "dickenstwist", "tolkienfellowship", "tolkienhobbit"},
+		},
+		{
+			sq:   booksing.SearchQuery{Sort: "size"},
+			want: []string{"tolkienfellowship", "zafonshadow", "bjorkjongen", "dickenstwist", "lewislion", "tolkienhobbit", "dickenscarol"},
+		},
+		{
+			sq:   booksing.SearchQuery{Sort: "series", Series: "Middle-earth"},
+			want: []string{"tolkienhobbit", "tolkienfellowship"},
+		},
+		{
+			sq:   booksing.SearchQuery{Sort: "published", Query: "author:dickens"},
+			want: []string{"dickenscarol", "dickenstwist"},
+		},
+		{
+			// books added at the same moment are returned newest id first
+			sq:   booksing.SearchQuery{},
+			want: []string{"dickenscarol", "dickenstwist", "bjorkjongen", "zafonshadow", "lewislion", "tolkienfellowship", "tolkienhobbit"},
+		},
+		{
+			sq:   booksing.SearchQuery{Query: "hobbit OR ring OR dwarves"},
+			want: []string{"tolkienhobbit", "tolkienfellowship"},
+		},
+	}
+	for _, tt := range sorts {
+		tt.sq.Limit = 20
+		res, err := db.GetBooks(tt.sq)
+		if err != nil {
+			t.Fatalf("GetBooks(%+v) error = %v", tt.sq, err)
+		}
+		if !equalLists(hashes(res.Items), tt.want) {
+			t.Errorf("GetBooks(%+v) = %v, want %v", tt.sq, hashes(res.Items), tt.want)
+		}
+	}
+
+	res, err := db.GetBooks(booksing.SearchQuery{Query: "the", Limit: 20, Language: "en", HasCover: false})
+	if err != nil {
+		t.Fatalf("GetBooks() error = %v", err)
+	}
+	if !equalSets(hashes(res.Items), []string{"tolkienhobbit", "tolkienfellowship", "lewislion"}) {
+		t.Errorf("GetBooks() with a language filter = %v", hashes(res.Items))
+	}
+
+	res, err = db.GetBooks(booksing.SearchQuery{Limit: 1, HasCover: true})
+	if err != nil {
+		t.Fatalf("GetBooks() error = %v", err)
+	}
+	f := res.Facets
+	if res.Total != 2 || f == nil || f.WithCover != 2 || len(f.Languages) != 1 || f.Languages[0] != (booksing.FacetCount{Value: "en", Count: 2}) {
+		t.Errorf("GetBooks() facets = %+v (total %d), want 2 english books with a cover", f, res.Total)
+	}
+	res, err = db.GetBooks(booksing.SearchQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetBooks() error = %v", err)
+	}
+	if len(res.Facets.Languages) != 3 || res.Facets.Languages[0] != (booksing.FacetCount{Value: "en", Count: 5}) {
+		t.Errorf("GetBooks() language facet = %+v, want en with 5 books first", res.Facets.Languages)
+	}
+	if len(res.Facets.Series) != 2 || res.Facets.Series[0] != (booksing.FacetCount{Value: "Middle-earth", Count: 2}) {
+		t.Errorf("GetBooks() series facet = %+v, want Middle-earth with 2 books first", res.Facets.Series)
+	}
+}
+
+func testPaging(t *testing.T, db booksing.Database) {
+	var books []booksing.Book
+	for i := 0; i < 25; i++ {
+		books = append(books, booksing.Book{
+			Hash:   string(rune('a'+i)) + "book",
+			Title:  "Book",
+			Author: "Writer",
+			// pairs of books share the moment they were added
+			Added: day(2023, 1, 1+i/2),
+		})
+	}
+	if _, err := db.AddBooks(books); err != nil {
+		t.Fatalf("AddBooks() error = %v", err)
+	}
+
+	for _, q := range []string{"", "writer"} {
+		var seen []string
+		for offset := int64(0); offset < 25; offset += 10 {
+			res, err := db.GetBooks(booksing.SearchQuery{Query: q, Limit: 10, Offset: offset, Sort: "title"})
+			if err != nil {
+				t.Fatalf("GetBooks(%q) error = %v", q, err)
+			}
+			if res.Total != 25 {
+				t.Errorf("GetBooks(%q) total = %d, want 25", q, res.Total)
+			}
+			seen = append(seen, hashes(res.Items)...)
+		}
+		if !equalSets(seen, hashes(books)) {
+			t.Errorf("paging through %q with offsets returned %v, want every book once", q, seen)
+		}
+	}
+
+	var seen []string
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("paging with cursors does not end")
+		}
+		res, err := db.GetBooks(booksing.SearchQuery{Limit: 10, After: after})
+		if err != nil {
+			t.Fatalf("GetBooks() with a cursor error = %v", err)
+		}
+		if res.Total != 25 {
+			t.Errorf("GetBooks() with a cursor total = %d, want 25", res.Total)
+		}
+		seen = append(seen, hashes(res.Items)...)
+		if res.Next == "" {
+			break
+		}
+		after = res.Next
+	}
+	var want []string
+	for i := len(books) - 1; i >= 0; i-- {
+		want = append(want, books[i].Hash)
+	}
+	if !equalLists(seen, want) {
+		t.Errorf("paging with cursors returned %v, want %v", seen, want)
+	}
+
+	if _, err := db.GetBooks(booksing.SearchQuery{Limit: 10, After: "garbage"}); err != booksing.ErrInvalidCursor {
+		t.Errorf("GetBooks() with an invalid cursor error = %v, want %v", err, booksing.ErrInvalidCursor)
+	}
+	res, err := db.GetBooks(booksing.SearchQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetBooks() error = %v", err)
+	}
+	if _, err := db.GetBooks(booksing.SearchQuery{Limit: 10, After: res.Next, Sort: "title"}); err != booksing.ErrInvalidCursor {
+		t.Errorf("GetBooks() with a cursor and another order error = %v, want %v", err, booksing.ErrInvalidCursor)
+	}
+}
+
+func testSuggestions(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	if err := db.RebuildSearchIndex(); err != nil {
+		t.Fatalf("RebuildSearchIndex() error = %v", err)
+	}
+
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{q: "dikens", want: "dickens"},
+		{q: "author:tolkein hobbit", want: "author:tolkien hobbit"},
+		{q: "dickens", want: ""},
+		{q: "xyzzy", want: ""},
+	}
+	for _, tt := range tests {
+		res, err := db.GetBooks(booksing.SearchQuery{Query: tt.q, Limit: 20})
+		if err != nil {
+			t.Fatalf("GetBooks(%q) error = %v", tt.q, err)
+		}
+		var got string
+		if len(res.Suggestions) > 0 {
+			got = res.Suggestions[0].Query
+		}
+		if got != tt.want {
+			t.Errorf("GetBooks(%q) suggestion = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+
+	c, err := db.Complete("tolk", 5)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if len(c.Authors) != 1 || c.Authors[0] != (booksing.FacetCount{Value: "J.R.R. Tolkien", Count: 2}) {
+		t.Errorf("Complete(tolk) authors = %+v, want J.R.R. Tolkien with 2 books", c.Authors)
+	}
+	c, err = db.Complete("Zaf", 5)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if len(c.Authors) != 1 || c.Authors[0].Value != "Carlos Ruiz Zafón" {
+		t.Errorf("Complete(Zaf) authors = %+v, want Carlos Ruiz Zafón", c.Authors)
+	}
+	c, err = db.Complete("the", 5)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if len(c.Titles) != 3 || len(c.Authors) != 0 {
+		t.Errorf("Complete(the) = %+v, want 3 titles", c)
+	}
+	c, err = db.Complete("middle", 5)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if len(c.Series) != 1 || c.Series[0] != (booksing.FacetCount{Value: "Middle-earth", Count: 2}) {
+		t.Errorf("Complete(middle) series = %+v, want Middle-earth", c.Series)
+	}
+}
+
+func testReading(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	// an edition that shares the hash of the hobbit keeps its own progress and reading state
+	edition := booksing.Book{Hash: "tolkienhobbit", Author: "J.R.R. Tolkien", Title: "Der Hobbit", Language: "de", Path: "/books/tolkienhobbit-de.epub", Added: day(2024, 1, 1)}
+	added, err := db.AddBooks([]booksing.Book{edition})
+	if err != nil || len(added) != 1 {
+		t.Fatalf("AddBooks() of an edition = %v, %v", added, err)
+	}
+	edition = added[0]
+	id := func(hash string) uint { return libraryID(t, db, hash) }
+
+	p := booksing.Progress{User: "alice", Document: "doc1", BookID: id("tolkienhobbit"), Percentage: 0.1, Timestamp: day(2023, 1, 1)}
+	if err := db.SaveProgress(&p); err != nil {
+		t.Fatalf("SaveProgress() error = %v", err)
+	}
+	p = booksing.Progress{User: "alice", Document: "doc1", BookID: id("tolkienhobbit"), Percentage: 0.5, Timestamp: day(2023, 1, 2)}
+	if err := db.SaveProgress(&p); err != nil {
+		t.Fatalf("SaveProgress() of existing progress error = %v", err)
+	}
+	got, err := db.GetProgress("alice", "doc1")
+	if err != nil || got.Percentage != 0.5 {
+		t.Errorf("GetProgress() = %v, %v, want the updated progress", got.Percentage, err)
+	}
+	if _, err := db.GetProgress("bob", "doc1"); err != booksing.ErrNotFound {
+		t.Errorf("GetProgress() of another user error = %v, want %v", err, booksing.ErrNotFound)
+	}
+	got, err = db.GetBookProgress("alice", id("tolkienhobbit"))
+	if err != nil || got.Document != "doc1" {
+		t.Errorf("GetBookProgress() = %v, %v, want doc1", got.Document, err)
+	}
+	recent, err := db.GetRecentProgress("alice", 10)
+	if err != nil || len(recent) != 1 {
+		t.Errorf("GetRecentProgress() = %v, %v, want a single entry", recent, err)
+	}
+	// another document in KOReader of the same book only shows the latest progress of the two
+	p = booksing.Progress{User: "alice", Document: "doc2", BookID: id("tolkienhobbit"), Percentage: 0.7, Timestamp: day(2023, 1, 3)}
+	if err := db.SaveProgress(&p); err != nil {
+		t.Fatalf("SaveProgress() of another document error = %v", err)
+	}
+	p = booksing.Progress{User: "alice", Document: "doc3", BookID: id("lewislion"), Percentage: 0.2, Timestamp: day(2023, 1, 2)}
+	if err := db.SaveProgress(&p); err != nil {
+		t.Fatalf("SaveProgress() of another book error = %v", err)
+	}
+	recent, err = db.GetRecentProgress("alice", 10)
+	if err != nil || len(recent) != 2 || recent[0].Document != "doc2" || recent[1].Document != "doc3" {
+		t.Errorf("GetRecentProgress() = %v, %v, want doc2 and doc3", recent, err)
+	}
+
+	state := booksing.ReadingState{User: "alice", BookID: id("lewislion"), Status: booksing.StatusFinished, Finished: day(2023, 2, 1), Rating: 4}
+	if err := db.SaveReadingState(&state); err != nil {
+		t.Fatalf("SaveReadingState() error = %v", err)
+	}
+	state = booksing.ReadingState{User: "alice", BookID: id("dickenscarol"), Status: booksing.StatusFinished, Finished: day(2022, 12, 24)}
+	if err := db.SaveReadingState(&state); err != nil {
+		t.Fatalf("SaveReadingState() error = %v", err)
+	}
+	state = booksing.ReadingState{User: "alice", BookID: id("zafonshadow"), Status: booksing.StatusWantToRead}
+	if err := db.SaveReadingState(&state); err != nil {
+		t.Fatalf("SaveReadingState() error = %v", err)
+	}
+	rs, err := db.GetReadingState("alice", id("lewislion"))
+	if err != nil || rs.Rating != 4 {
+		t.Errorf("GetReadingState() = %+v, %v, want rating 4", rs, err)
+	}
+
+	finished, err := db.GetFinished("alice", day(2023, 1, 1), day(2024, 1, 1))
+	if err != nil || len(finished) != 1 || finished[0].BookID != id("lewislion") {
+		t.Errorf("GetFinished(2023) = %+v, %v, want lewislion", finished, err)
+	}
+
+	filters := []struct {
+		sq   booksing.SearchQuery
+		want []string
+	}{
+		{
+			sq:   booksing.SearchQuery{User: "alice", Status: booksing.StatusFinished},
+			want: []string{"lewislion", "dickenscarol"},
+		},
+		{
+			sq:   booksing.SearchQuery{User: "alice", Status: booksing.StatusFinished, FinishedSince: day(2023, 1, 1)},
+			want: []string{"lewislion"},
+		},
+		{
+			sq:   booksing.SearchQuery{User: "alice", Status: booksing.StatusUnread, Query: "lang:en OR lang:es"},
+			want: []string{"tolkienhobbit", "tolkienfellowship", "dickenstwist", "zafonshadow"},
+		},
+		{
+			sq:   booksing.SearchQuery{User: "bob", Status: booksing.StatusFinished},
+			want: nil,
+		},
+	}
+	for _, tt := range filters {
+		tt.sq.Limit = 20
+		res, err := db.GetBooks(tt.sq)
+		if err != nil {
+			t.Fatalf("GetBooks(%+v) error = %v", tt.sq, err)
+		}
+		if !equalSets(hashes(res.Items), tt.want) {
+			t.Errorf("GetBooks(%+v) = %v, want %v", tt.sq, hashes(res.Items), tt.want)
+		}
+	}
+
+	if err := db.DeleteReadingState("alice", id("zafonshadow")); err != nil {
+		t.Fatalf("DeleteReadingState() error = %v", err)
+	}
+	if _, err := db.GetReadingState("alice", id("zafonshadow")); err != booksing.ErrNotFound {
+		t.Errorf("GetReadingState() after deleting error = %v, want %v", err, booksing.ErrNotFound)
+	}
+	// a deleted state can be stored again
+	state = booksing.ReadingState{User: "alice", BookID: id("zafonshadow"), Status: booksing.StatusReading}
+	if err := db.SaveReadingState(&state); err != nil {
+		t.Fatalf("SaveReadingState() after deleting error = %v", err)
+	}
+
+	// the last download is of a book that is gone
+	for _, bookID := range []uint{id("tolkienhobbit"), id("tolkienhobbit"), id("lewislion"), edition.ID + 1} {
+		err := db.AddDownload(booksing.Download{User: "alice", BookID: bookID, Timestamp: day(2023, 3, 1)})
+		if err != nil {
+			t.Fatalf("AddDownload() error = %v", err)
+		}
+	}
+	imported, err := db.ImportDownloads("alice")
+	if err != nil || imported != 1 {
+		t.Errorf("ImportDownloads() = %d, %v, want only the hobbit to be imported", imported, err)
+	}
+	rs, err = db.GetReadingState("alice", id("tolkienhobbit"))
+	if err != nil || rs.Status != booksing.StatusReading || !rs.Started.Equal(day(2023, 3, 1)) {
+		t.Errorf("GetReadingState() of an imported download = %+v, %v, want reading since the download", rs, err)
+	}
+	if _, err := db.GetReadingState("alice", edition.ID); err != booksing.ErrNotFound {
+		t.Errorf("GetReadingState() of another edition error = %v, want %v", err, booksing.ErrNotFound)
+	}
+	if _, err := db.GetBookProgress("alice", edition.ID); err != booksing.ErrNotFound {
+		t.Errorf("GetBookProgress() of another edition error = %v, want %v", err, booksing.ErrNotFound)
+	}
+}
+
+func testRehash(t *testing.T, db booksing.Database) {
+	// both are the same book, the first version of the hash did not fold ø or drop the generic subtitle
+	first := booksing.Book{Author: "Samuel Bjørk", Title: "De Jongen In De Sneeuw", Language: "nl", HashVersion: 1, Added: day(2023, 5, 1)}
+	second := booksing.Book{Author: "Samuel Bjork", Title: "De jongen in de sneeuw: een thriller", Description: "Een thriller uit Noorwegen", HashVersion: 1, Added: day(2023, 6, 1)}
+	first.Hash = booksing.HashBookVersion(1, first.Author, first.Title)
+	second.Hash = booksing.HashBookVersion(1, second.Author, second.Title)
+	current := booksing.Book{Author: "J.R.R. Tolkien", Title: "The Hobbit", HashVersion: booksing.HashVersion, Added: day(2022, 1, 1)}
+	current.Hash = booksing.HashBook(current.Author, current.Title)
+	added, err := db.AddBooks([]booksing.Book{first, second, current})
+	if err != nil || len(added) != 3 {
+		t.Fatalf("AddBooks() = %v, %v", added, err)
+	}
+	first, second = added[0], added[1]
+
+	for _, s := range []booksing.ReadingState{
+		{User: "alice", BookID: first.ID, Status: booksing.StatusFinished},
+		{User: "alice", BookID: second.ID, Status: booksing.StatusReading},
+		{User: "bob", BookID: second.ID, Status: booksing.StatusWantToRead},
+	} {
+		if err := db.SaveReadingState(&s); err != nil {
+			t.Fatalf("SaveReadingState() error = %v", err)
+		}
+	}
+	for _, b := range []booksing.Book{first, second} {
+		if err := db.AddDownload(booksing.Download{User: "alice", BookID: b.ID, Timestamp: day(2023, 7, 1)}); err != nil {
+			t.Fatalf("AddDownload() error = %v", err)
+		}
+	}
+
+	res, err := db.Rehash()
+	if err != nil {
+		t.Fatalf("Rehash() error = %v", err)
+	}
+	if *res != (booksing.RehashResult{Rehashed: 2, Merged: 1}) {
+		t.Errorf("Rehash() = %+v, want two rehashed books and a single merged work", *res)
+	}
+
+	hash := booksing.HashBook(first.Author, first.Title)
+	if n := db.GetBookCount(); n != 3 {
+		t.Errorf("GetBookCount() after rehashing = %d, want 3", n)
+	}
+	b, err := db.GetBookByHash(hash)
+	if err != nil {
+		t.Fatalf("GetBookByHash() of the merged work error = %v", err)
+	}
+	if b.Title != first.Title || b.HashVersion != booksing.HashVersion {
+		t.Errorf("GetBookByHash() = %q version %d, want the first book of the work", b.Title, b.HashVersion)
+	}
+	found, err := db.GetBooks(booksing.SearchQuery{Query: "sneeuw", Limit: 10})
+	if err != nil || !equalSets(hashes(found.Items), []string{hash, hash}) {
+		t.Errorf("GetBooks(sneeuw) after rehashing = %v, %v, want both books with hash %s", hashes(found.Items), err, hash)
+	}
+	for _, old := range []string{first.Hash, second.Hash} {
+		if got, err := db.ResolveHash(old); got != hash || err != nil {
+			t.Errorf("ResolveHash(%s) = %q, %v, want %s", old, got, err, hash)
+		}
+	}
+	if _, err := db.ResolveHash(current.Hash); err != booksing.ErrNotFound {
+		t.Errorf("ResolveHash() of a book that kept its hash error = %v, want %v", err, booksing.ErrNotFound)
+	}
+
+	// reading states and downloads stay with the edition they are about
+	for _, tt := range []struct {
+		user string
+		book uint
+		want booksing.ReadingStatus
+	}{
+		{user: "alice", book: first.ID, want: booksing.StatusFinished},
+		{user: "alice", book: second.ID, want: booksing.StatusReading},
+		{user: "bob", book: second.ID, want: booksing.StatusWantToRead},
+	} {
+		rs, err := db.GetReadingState(tt.user, tt.book)
+		if err != nil || rs.Status != tt.want {
+			t.Errorf("GetReadingState(%s, %d) after rehashing = %+v, %v, want %s", tt.user, tt.book, rs, err, tt.want)
+		}
+	}
+	dls, err := db.GetDownloads(10)
+	if err != nil || len(dls) != 2 || dls[0].BookID == dls[1].BookID {
+		t.Errorf("GetDownloads() after rehashing = %+v, %v, want a download of each edition", dls, err)
+	}
+
+	res, err = db.Rehash()
+	if err != nil || *res != (booksing.RehashResult{}) {
+		t.Errorf("Rehash() of rehashed books = %+v, %v, want nothing to change", res, err)
+	}
+}
+
+func languages(books []booksing.Book) []string {
+	var l []string
+	for _, b := range books {
+		l = append(l, b.Language)
+	}
+	return l
+}
+
+func testWorks(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	editions := []booksing.Book{
+		// the same hash
+		{Hash: "tolkienhobbit", Author: "J.R.R. Tolkien", Title: "Der Hobbit", Language: "de", Path: "/books/tolkienhobbit-de.epub", Added: day(2024, 1, 1)},
+		// the same ISBN, written differently
+		{Hash: "tolkienhobbitthereandbackagain", Author: "J.R.R. Tolkien", Title: "The Hobbit, or There and Back Again", Language: "en", ISBN: "urn:isbn:978-0-261-10221-7", Path: "/books/tolkienhobbit-2.epub", Added: day(2024, 1, 2)},
+		// the same place in the same series
+		{Hash: "tolkienreisgenoten", Author: "J.R.R. Tolkien", Title: "De Reisgenoten", Language: "nl", Series: "Middle-earth", SeriesIndex: 2, Path: "/books/tolkienreisgenoten.epub", Added: day(2024, 1, 3)},
+		// a translated series only shares its work when it is linked by hand
+		{Hash: "lewisleeuw", Author: "C.S. Lewis", Title: "De Leeuw, De Heks En De Kleerkast", Language: "nl", Series: "De Kronieken Van Narnia", SeriesIndex: 1, Path: "/books/lewisleeuw.epub", Added: day(2024, 1, 4)},
+	}
+	if _, err := db.AddBooks(editions); err != nil {
+		t.Fatalf("AddBooks() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		// grouping again leaves every book in its work
+		if err := db.GroupWorks(); err != nil {
+			t.Fatalf("GroupWorks() error = %v", err)
+		}
+	}
+
+	hobbit, err := db.GetBookByHash("tolkienhobbit")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	if hobbit.WorkID == 0 {
+		t.Fatalf("GetBookByHash() = %+v, want a grouped book", hobbit)
+	}
+	works, err := db.GetEditions(hobbit.WorkID)
+	if err != nil {
+		t.Fatalf("GetEditions() error = %v", err)
+	}
+	if !equalLists(languages(works), []string{"de", "en", "en"}) {
+		t.Errorf("GetEditions() of the hobbit = %v, want the german and both english editions", languages(works))
+	}
+	fellowship, err := db.GetBookByHash("tolkienfellowship")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	works, err = db.GetEditions(fellowship.WorkID)
+	if err != nil || !equalLists(languages(works), []string{"en", "nl"}) {
+		t.Errorf("GetEditions() of the fellowship = %v, %v, want the english and dutch edition", languages(works), err)
+	}
+
+	res, err := db.GetBooks(booksing.SearchQuery{Query: "tolkien", Limit: 10})
+	if err != nil || res.Total != 5 {
+		t.Errorf("GetBooks(tolkien) = %v, %v, want every edition", res, err)
+	}
+	res, err = db.GetBooks(booksing.SearchQuery{Query: "tolkien", Limit: 10, CollapseEditions: true})
+	if err != nil {
+		t.Fatalf("GetBooks() collapsed error = %v", err)
+	}
+	if res.Total != 2 || !equalSets(hashes(res.Items), []string{"tolkienhobbit", "tolkienfellowship"}) {
+		t.Errorf("GetBooks(tolkien) collapsed = %d %v, want the first edition of both works", res.Total, hashes(res.Items))
+	}
+	if len(res.Editions[hobbit.WorkID]) != 3 || len(res.Editions[fellowship.WorkID]) != 2 {
+		t.Errorf("GetBooks(tolkien) collapsed editions = %v, want all editions of both works", res.Editions)
+	}
+	res, err = db.GetBooks(booksing.SearchQuery{Query: "tolkien", Limit: 10, Language: "nl", CollapseEditions: true})
+	if err != nil || !equalLists(hashes(res.Items), []string{"tolkienreisgenoten"}) {
+		t.Errorf("GetBooks(tolkien) collapsed in dutch = %v, %v, want the dutch edition", hashes(res.Items), err)
+	}
+
+	lion, err := db.GetBookByHash("lewislion")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	leeuw, err := db.GetBookByHash("lewisleeuw")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	if leeuw.WorkID == lion.WorkID {
+		t.Errorf("the translated title and series were grouped with %q", lion.Title)
+	}
+	if err := db.LinkWork(leeuw.ID, lion.ID); err != nil {
+		t.Fatalf("LinkWork() error = %v", err)
+	}
+	works, err = db.GetEditions(lion.WorkID)
+	if err != nil || !equalLists(languages(works), []string{"en", "nl"}) {
+		t.Errorf("GetEditions() after linking = %v, %v, want the english and dutch edition", languages(works), err)
+	}
+	if err := db.LinkWork(leeuw.ID, lion.ID+1000); err != booksing.ErrNotFound {
+		t.Errorf("LinkWork() to an unknown book error = %v, want %v", err, booksing.ErrNotFound)
+	}
+
+	if err := db.UnlinkWork(leeuw.ID); err != nil {
+		t.Fatalf("UnlinkWork() error = %v", err)
+	}
+	if err := db.GroupWorks(); err != nil {
+		t.Fatalf("GroupWorks() error = %v", err)
+	}
+	works, err = db.GetEditions(lion.WorkID)
+	if err != nil || !equalLists(languages(works), []string{"en"}) {
+		t.Errorf("GetEditions() after unlinking = %v, %v, want only the english edition", languages(works), err)
+	}
+	if err := db.UnlinkWork(lion.ID + 1000); err != booksing.ErrNotFound {
+		t.Errorf("UnlinkWork() of an unknown book error = %v, want %v", err, booksing.ErrNotFound)
+	}
+}
+
+func testMetadata(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	unknown := booksing.Book{Title: "Vervloekt", Author: "Unknown", Language: "nl", Path: "/books/vervloekt.epub", Added: day(2024, 1, 1)}
+	unknown.Hash = booksing.HashBook(unknown.Author, unknown.Title)
+	if err := db.AddBook(unknown); err != nil {
+		t.Fatalf("AddBook() error = %v", err)
+	}
+
+	// only the hobbit has an isbn
+	incomplete, err := db.GetIncompleteBooks()
+	if err != nil || len(incomplete) != len(library) {
+		t.Fatalf("GetIncompleteBooks() = %v, %v, want every book but the hobbit", hashes(incomplete), err)
+	}
+	b, err := db.GetBookByHash(unknown.Hash)
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	if err := db.SaveReadingState(&booksing.ReadingState{User: "alice", BookID: b.ID, Status: booksing.StatusReading}); err != nil {
+		t.Fatalf("SaveReadingState() error = %v", err)
+	}
+
+	old := b.Hash
+	if err := b.SetField("author", "Josephine Angelini"); err != nil {
+		t.Fatalf("SetField() error = %v", err)
+	}
+	b.Description = "not stored"
+	if err := db.UpdateBook(b, "author"); err != nil {
+		t.Fatalf("UpdateBook() error = %v", err)
+	}
+	stored, err := db.GetBook(b.ID)
+	if err != nil || stored.Author != "Josephine Angelini" || stored.Hash != b.Hash || stored.Description != "" {
+		t.Errorf("GetBook() after UpdateBook() = %+v, %v, want only the author and hash changed", stored, err)
+	}
+	res, err := db.GetBooks(booksing.SearchQuery{Query: "angelini", Limit: 10})
+	if err != nil || res.Total != 1 {
+		t.Errorf("GetBooks(angelini) = %v, %v, want the updated book in the index", res, err)
+	}
+	if rs, err := db.GetReadingState("alice", b.ID); err != nil || rs.Status != booksing.StatusReading {
+		t.Errorf("GetReadingState() after UpdateBook() = %+v, %v, want it kept", rs, err)
+	}
+	if got, err := db.ResolveHash(old); got != b.Hash || err != nil {
+		t.Errorf("ResolveHash(%s) = %q, %v, want %s", old, got, err, b.Hash)
+	}
+	if err := db.UpdateBook(&booksing.Book{Title: "Missing"}, "title"); err != booksing.ErrNotFound {
+		t.Errorf("UpdateBook() of an unknown book error = %v, want %v", err, booksing.ErrNotFound)
+	}
+
+	for _, proposed := range []string{"Angelini", "Josephine Angelini"} {
+		err := db.SaveProposals([]booksing.Proposal{
+			{Book: b.ID, Field: "publisher", Proposed: proposed, Source: "test"},
+			{Book: b.ID, Field: "isbn", Proposed: "9789000000000", Source: "test"},
+		})
+		if err != nil {
+			t.Fatalf("SaveProposals() error = %v", err)
+		}
+	}
+	proposals, err := db.GetProposals()
+	if err != nil || len(proposals) != 2 {
+		t.Fatalf("GetProposals() = %+v, %v, want the latest proposal for both fields", proposals, err)
+	}
+	p, err := db.GetProposal(proposals[0].ID)
+	if err != nil || p.Field != "publisher" || p.Proposed != "Josephine Angelini" || p.CreatedAt.IsZero() {
+		t.Errorf("GetProposal() = %+v, %v, want the latest publisher", p, err)
+	}
+	if err := db.DeleteProposal(p.ID); err != nil {
+		t.Fatalf("DeleteProposal() error = %v", err)
+	}
+	if _, err := db.GetProposal(p.ID); err != booksing.ErrNotFound {
+		t.Errorf("GetProposal() of a deleted proposal error = %v, want %v", err, booksing.ErrNotFound)
+	}
+}
+
+func testAuthors(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	spelling := booksing.Book{Title: "The Silmarillion", Author: "J R R Tolkien", Language: "en", Path: "/books/silmarillion.epub", Added: day(2024, 1, 1)}
+	spelling.Hash = booksing.HashBook(spelling.Author, spelling.Title)
+	if err := db.AddBook(spelling); err != nil {
+		t.Fatalf("AddBook() error = %v", err)
+	}
+
+	counts, err := db.GetAuthorCounts()
+	if err != nil {
+		t.Fatalf("GetAuthorCounts() error = %v", err)
+	}
+	found := map[string]int64{}
+	for _, c := range counts {
+		found[c.Value] = c.Count
+	}
+	if found["J.R.R. Tolkien"] != 2 || found["J R R Tolkien"] != 1 || found["Charles Dickens"] != 2 {
+		t.Errorf("GetAuthorCounts() = %v, want every spelling with its books", counts)
+	}
+
+	if err := db.MergeAuthors("J.R.R. Tolkien", []string{"J R R Tolkien", "John Ronald Reuel Tolkien", "J.R.R. Tolkien"}); err != nil {
+		t.Fatalf("MergeAuthors() error = %v", err)
+	}
+	// merging again replaces the aliases instead of adding them twice
+	if err := db.MergeAuthors("J.R.R. Tolkien", []string{"John Ronald Reuel Tolkien"}); err != nil {
+		t.Fatalf("MergeAuthors() a second time error = %v", err)
+	}
+	if err := db.MergeAuthors("Tolkien", []string{"Tolkien, John"}); err != nil {
+		t.Fatalf("MergeAuthors() error = %v", err)
+	}
+	// merging an author moves its aliases along
+	if err := db.MergeAuthors("J.R.R. Tolkien", []string{"Tolkien"}); err != nil {
+		t.Fatalf("MergeAuthors() of an author error = %v", err)
+	}
+	authors, err := db.GetAuthors()
+	if err != nil || len(authors) != 1 {
+		t.Fatalf("GetAuthors() = %+v, %v, want a single author", authors, err)
+	}
+	var aliases []string
+	for _, a := range authors[0].Aliases {
+		aliases = append(aliases, a.Alias)
+	}
+	if !equalLists(aliases, []string{"John Ronald Reuel Tolkien", "Tolkien", "Tolkien, John"}) {
+		t.Errorf("GetAuthors() aliases = %v, want the merged names without the spelling of the name itself", aliases)
+	}
+
+	resolve, err := db.GetAuthorAliases()
+	if err != nil {
+		t.Fatalf("GetAuthorAliases() error = %v", err)
+	}
+	for _, name := range []string{"J R R Tolkien", "Tolkien, John", "John Ronald Reuel Tolkien"} {
+		if got := resolve.Resolve(name); got != "J.R.R. Tolkien" {
+			t.Errorf("Resolve(%q) = %q, want J.R.R. Tolkien", name, got)
+		}
+	}
+
+	books, err := db.GetBooksByAuthor("J R R Tolkien", "Charles Dickens")
+	if err != nil || len(books) != 3 {
+		t.Errorf("GetBooksByAuthor() = %v, %v, want the books of both names", hashes(books), err)
+	}
+
+	if err := db.DeleteAuthorAlias(authors[0].Aliases[0].ID); err != nil {
+		t.Fatalf("DeleteAuthorAlias() error = %v", err)
+	}
+	resolve, err = db.GetAuthorAliases()
+	if err != nil || resolve.Resolve("John Ronald Reuel Tolkien") != "John Ronald Reuel Tolkien" {
+		t.Errorf("Resolve() of a deleted alias = %q, %v, want the name itself", resolve.Resolve("John Ronald Reuel Tolkien"), err)
+	}
+}
+
+// tagCounts returns how many books have each tag
+func tagCounts(t *testing.T, db booksing.Database) map[string]int64 {
+	t.Helper()
+	tags, err := db.GetTags()
+	if err != nil {
+		t.Fatalf("GetTags() error = %v", err)
+	}
+	counts := map[string]int64{}
+	for _, c := range tags {
+		counts[c.Value] = c.Count
+	}
+	return counts
+}
+
+// search returns the hashes of the books that match q
+func search(t *testing.T, db booksing.Database, q string) []string {
+	t.Helper()
+	res, err := db.GetBooks(booksing.SearchQuery{Query: q, Limit: 20})
+	if err != nil {
+		t.Fatalf("GetBooks(%q) error = %v", q, err)
+	}
+	return hashes(res.Items)
+}
+
+func testTags(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	tagged := []booksing.Book{
+		{Hash: "tolkiensilmarillion", Author: "J.R.R. Tolkien", Title: "The Silmarillion", Language: "en", Added: day(2024, 1, 1)},
+		{Hash: "pratchettmort", Author: "Terry Pratchett", Title: "Mort", Language: "en", Added: day(2024, 2, 1)},
+	}
+	tagged[0].SetTags([]string{"Fantasy", "Mythology"})
+	tagged[1].SetTags([]string{"fantasy", "Humorous Fiction"})
+	for i := range tagged {
+		tagged[i].Path = libraryPath(tagged[i])
+	}
+	if _, err := db.AddBooks(tagged); err != nil {
+		t.Fatalf("AddBooks() error = %v", err)
+	}
+	// adding the same books again links nothing twice
+	if _, err := db.AddBooks(tagged); err != nil {
+		t.Fatalf("AddBooks() a second time error = %v", err)
+	}
+
+	counts := tagCounts(t, db)
+	if len(counts) != 3 || counts["fantasy"] != 2 || counts["mythology"] != 1 || counts["humorous fiction"] != 1 {
+		t.Errorf("GetTags() = %v, want fantasy twice and the other tags once", counts)
+	}
+	for q, want := range map[string][]string{
+		"tag:fantasy":            {"tolkiensilmarillion", "pratchettmort"},
+		"tag:Fantasy -tolkien":   {"pratchettmort"},
+		`tag:"humorous fiction"`: {"pratchettmort"},
+		"tag:myth*":              {"tolkiensilmarillion"},
+		"mythology":              {"tolkiensilmarillion"},
+		"tag:horror":             nil,
+	} {
+		if got := search(t, db, q); !equalSets(got, want) {
+			t.Errorf("GetBooks(%q) = %v, want %v", q, got, want)
+		}
+	}
+
+	untagged, err := db.GetUntaggedBooks()
+	if err != nil || len(untagged) != len(library) {
+		t.Errorf("GetUntaggedBooks() = %v, %v, want the library", hashes(untagged), err)
+	}
+	hobbit, err := db.GetBookByHash("tolkienhobbit")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	if err := db.SetBookTags(hobbit.ID, []string{"Fantasy", "Adventure", "fantasy"}); err != nil {
+		t.Fatalf("SetBookTags() error = %v", err)
+	}
+	hobbit, err = db.GetBook(hobbit.ID)
+	if err != nil || !equalLists(hobbit.TagNames(), []string{"adventure", "fantasy"}) {
+		t.Errorf("GetBook() tags after SetBookTags() = %q, %v, want adventure and fantasy", hobbit.Tags, err)
+	}
+	if got := search(t, db, "adventure tag:fantasy"); !equalSets(got, []string{"tolkienhobbit"}) {
+		t.Errorf("GetBooks(adventure tag:fantasy) = %v, want the hobbit", got)
+	}
+
+	if err := db.RenameTag("Mythology", "legends"); err != nil {
+		t.Fatalf("RenameTag() error = %v", err)
+	}
+	// renaming to a tag that exists merges the two
+	if err := db.RenameTag("adventure", "fantasy"); err != nil {
+		t.Fatalf("RenameTag() onto fantasy error = %v", err)
+	}
+	counts = tagCounts(t, db)
+	if len(counts) != 3 || counts["fantasy"] != 3 || counts["legends"] != 1 || counts["mythology"] != 0 {
+		t.Errorf("GetTags() after RenameTag() = %v, want legends and three books with fantasy", counts)
+	}
+	if got := search(t, db, "legends"); !equalSets(got, []string{"tolkiensilmarillion"}) {
+		t.Errorf("GetBooks(legends) = %v, want the renamed tag in the index", got)
+	}
+	hobbit, err = db.GetBook(hobbit.ID)
+	if err != nil || hobbit.Tags != "fantasy" {
+		t.Errorf("GetBook() tags after merging = %q, %v, want fantasy once", hobbit.Tags, err)
+	}
+	if err := db.RenameTag("horror", "thriller"); !errors.Is(err, booksing.ErrNotFound) {
+		t.Errorf("RenameTag() of a missing tag error = %v, want ErrNotFound", err)
+	}
+
+	// a tag without books is removed
+	if err := db.SetBookTags(hobbit.ID, nil); err != nil {
+		t.Fatalf("SetBookTags() without tags error = %v", err)
+	}
+	if err := db.RenameTag("humorous fiction", "humour"); err != nil {
+		t.Fatalf("RenameTag() error = %v", err)
+	}
+	counts = tagCounts(t, db)
+	if len(counts) != 3 || counts["fantasy"] != 2 || counts["humour"] != 1 {
+		t.Errorf("GetTags() after removing tags = %v, want fantasy, humour and legends", counts)
+	}
+}
+
+func testUploads(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	uploads := []booksing.Upload{
+		{Uploader: "alice", Filename: "mort.epub", Path: "/import/uploads/alice/mort.epub", Status: booksing.UploadPending},
+		{Uploader: "alice", Filename: "twist.epub", Path: "/import/uploads/alice/twist.epub", Status: booksing.UploadPending},
+		{Uploader: "bob", Filename: "notes.txt", Status: booksing.UploadRejected, Message: "only epub files can be uploaded"},
+		{Uploader: "bob", Filename: "broken.epub", Path: "/import/uploads/bob/broken.epub", Status: booksing.UploadPending},
+	}
+	for i := range uploads {
+		uploads[i].Created = day(2024, 3, i+1)
+		if err := db.AddUpload(&uploads[i]); err != nil {
+			t.Fatalf("AddUpload() error = %v", err)
+		}
+	}
+
+	twist, err := db.GetBookByHash("dickenstwist")
+	if err != nil {
+		t.Fatalf("GetBookByHash() error = %v", err)
+	}
+	if err := db.SetUploadResult(uploads[1].Path, booksing.UploadDuplicate, "a copy of Oliver Twist", twist.ID); err != nil {
+		t.Fatalf("SetUploadResult() error = %v", err)
+	}
+	if err := db.SetUploadResult(uploads[3].Path, booksing.UploadFailed, "not an epub", 0); err != nil {
+		t.Fatalf("SetUploadResult() error = %v", err)
+	}
+	pending, err := db.GetPendingUploads()
+	if err != nil || len(pending) != 1 || pending[0].Filename != "mort.epub" {
+		t.Fatalf("GetPendingUploads() = %+v, %v, want mort.epub", pending, err)
+	}
+
+	mort := booksing.Book{Hash: "pratchettmort", Author: "Terry Pratchett", Title: "Mort", Path: uploads[0].Path, UploadedBy: "alice", Added: day(2024, 3, 1)}
+	if _, err := db.AddBooks([]booksing.Book{mort}); err != nil {
+		t.Fatalf("AddBooks() error = %v", err)
+	}
+	if err := db.FinishUploads(); err != nil {
+		t.Fatalf("FinishUploads() error = %v", err)
+	}
+	stored, err := db.GetBookByHash("pratchettmort")
+	if err != nil || stored.UploadedBy != "alice" {
+		t.Fatalf("GetBookByHash() = %+v, %v, want the book uploaded by alice", stored, err)
+	}
+
+	got, err := db.GetUploads("alice", 10)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GetUploads(alice) = %+v, %v, want two uploads", got, err)
+	}
+	if got[0].Filename != "twist.epub" || got[0].Status != booksing.UploadDuplicate || got[0].BookID != twist.ID {
+		t.Errorf("GetUploads(alice)[0] = %+v, want the newest upload as a duplicate of Oliver Twist", got[0])
+	}
+	if got[1].Status != booksing.UploadAdded || got[1].BookID != stored.ID {
+		t.Errorf("GetUploads(alice)[1] = %+v, want mort added as book %d", got[1], stored.ID)
+	}
+	all, err := db.GetUploads("", 3)
+	if err != nil || len(all) != 3 || all[0].Filename != "broken.epub" || all[0].Status != booksing.UploadFailed {
+		t.Errorf("GetUploads() = %+v, %v, want the three newest uploads of everyone", all, err)
+	}
+}
+
+func testImports(t *testing.T, db booksing.Database) {
+	addLibrary(t, db)
+	// a job that skipped the files it did not read
+	first := booksing.ImportJob{Started: day(2024, 4, 1), Finished: day(2024, 4, 1).Add(time.Minute), Found: 3, Parsed: 1, Added: 1, Skipped: 2}
+	if err := db.SaveImportJob(&first); err != nil {
+		t.Fatalf("SaveImportJob() error = %v", err)
+	}
+	job := booksing.ImportJob{Started: day(2024, 4, 2), Found: 3}
+	if err := db.SaveImportJob(&job); err != nil {
+		t.Fatalf("SaveImportJob() error = %v", err)
+	}
+	files := []booksing.ImportFile{
+		{ImportJobID: job.ID, Path: "/import/twist.epub", Outcome: booksing.ImportDuplicate, Message: "a copy of Oliver Twist", Took: time.Second},
+		{ImportJobID: job.ID, Path: "/import/mort.epub", Outcome: booksing.ImportAdded},
+		{ImportJobID: job.ID, Path: "/import/broken.epub", Outcome: booksing.ImportFailed, Message: "not a zip"},
+	}
+	for _, f := range files {
+		job.Count(f.Outcome)
+	}
+	job.Parsed = 2
+	job.Finished = day(2024, 4, 2).Add(time.Hour)
+	if err := db.AddImportFiles(files); err != nil {
+		t.Fatalf("AddImportFiles() error = %v", err)
+	}
+	if err := db.SaveImportJob(&job); err != nil {
+		t.Fatalf("SaveImportJob() of a finished job error = %v", err)
+	}
+
+	jobs, err := db.GetImportJobs(10)
+	if err != nil || len(jobs) != 2 || jobs[0].ID != job.ID {
+		t.Fatalf("GetImportJobs() = %+v, %v, want both jobs with the newest first", jobs, err)
+	}
+	if got := jobs[0]; got.Added != 1 || got.Duplicate != 1 || got.Failed != 1 || got.Parsed != 2 || got.Took() != time.Hour {
+		t.Errorf("GetImportJobs()[0] = %+v, want the counters of the finished job", got)
+	}
+	if got := jobs[1]; got.Skipped != 2 || got.Done() != got.Found {
+		t.Errorf("GetImportJobs()[1] = %+v, want the skipped files of the first job", got)
+	}
+	stored, got, err := db.GetImportJob(job.ID)
+	if err != nil || stored.Found != 3 || len(got) != 3 {
+		t.Fatalf("GetImportJob() = %+v, %+v, %v, want the job with its three files", stored, got, err)
+	}
+	if got[0].Outcome != booksing.ImportDuplicate || got[0].Took != time.Second || got[1].Outcome != booksing.ImportFailed || got[2].Outcome != booksing.ImportAdded {
+		t.Errorf("GetImportJob() files = %+v, want the files that were not added first", got)
+	}
+	if _, _, err := db.GetImportJob(job.ID + 10); !errors.Is(err, booksing.ErrNotFound) {
+		t.Errorf("GetImportJob() of a missing job error = %v, want ErrNotFound", err)
+	}
+
+	// a job booksing died in has no finish time
+	died := booksing.ImportJob{Started: day(2024, 4, 3), Found: 5, Parsed: 1, Added: 1}
+	if err := db.SaveImportJob(&died); err != nil {
+		t.Fatalf("SaveImportJob() error = %v", err)
+	}
+	if n, err := db.StopUnfinishedImports(); n != 1 || err != nil {
+		t.Errorf("StopUnfinishedImports() = %d, %v, want 1", n, err)
+	}
+	jobs, err = db.GetImportJobs(10)
+	if err != nil || len(jobs) != 3 || !jobs[0].Stopped || jobs[1].Stopped || jobs[2].Stopped {
+		t.Errorf("GetImportJobs() = %+v, %v, want only the job that did not finish stopped", jobs, err)
+	}
+	if n, err := db.StopUnfinishedImports(); n != 0 || err != nil {
+		t.Errorf("StopUnfinishedImports() a second time = %d, %v, want 0", n, err)
+	}
+
+	imported, err := db.GetImportedPaths()
+	if err != nil {
+		t.Fatalf("GetImportedPaths() error = %v", err)
+	}
+	if len(imported) != len(library)+1 || !imported[libraryPath(library[0])] || !imported["/import/twist.epub"] || imported["/import/broken.epub"] {
+		t.Errorf("GetImportedPaths() = %v, want the books and the copy of a book", imported)
+	}
+}
+
+func testMigrations(t *testing.T, db booksing.Database) {
+	statuses, err := db.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	if len(statuses) == 0 {
+		t.Fatalf("Migrations() returned nothing")
+	}
+	for i, s := range statuses {
+		if s.Version != i+1 || s.Applied.IsZero() {
+			t.Errorf("Migrations()[%d] = version %d applied at %v, want version %d to be applied", i, s.Version, s.Applied, i+1)
+		}
+	}
+	if err := db.Migrate(); err != nil {
+		t.Errorf("Migrate() of an up to date database error = %v", err)
+	}
+}
@@ -5,15 +5,21 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"html"
 	"image"
 	"image/jpeg"
+	"io"
+	"net/url"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/beevik/etree"
 	"github.com/moraes/isbn"
+	"golang.org/x/tools/godoc/vfs"
 	"golang.org/x/tools/godoc/vfs/zipfs"
 )
 
@@ -29,8 +35,14 @@ type Epub struct {
 	SeriesIndex float64   `json:"series_index"`
 	Description string    `json:"description"`
 	PublishDate time.Time `json:"publish_date"`
+	Subjects    []string  `json:"subjects"`
+	// Sample is text from the start of the book, to tell its language by
+	Sample string `json:"-"`
 }
 
+// sampleSize is how much text of a book is sampled, in bytes
+const sampleSize = 8 << 10
+
 // ParseFile takes a filepath and returns an Epub if possible
 func ParseFile(bookpath string) (bk *Epub, cover []byte, err error) {
 	defer func() {
@@ -101,6 +113,11 @@ func ParseFile(bookpath string) (bk *Epub, cover []byte, err error) {
 		book.Description = e.Text()
 		break
 	}
+	for _, e := range opf.FindElements("//subject") {
+		if s := strings.TrimSpace(e.Text()); s != "" {
+			book.Subjects = append(book.Subjects, s)
+		}
+	}
 	for _, e := range opf.FindElements("//language") {
 		book.Language = e.Text()
 		break
@@ -184,6 +201,7 @@ findISBN:
 	}
 
 	book.PublishDate = parsePublishDate(pubDate)
+	book.Sample = sample(zfs, opf, opfDir)
 
 	// Calibre series metadata
 	if el := opf.FindElement("//meta[@name='calibre:series']"); el != nil {
@@ -232,6 +250,65 @@ findISBN:
 
 }
 
+// sample returns text from the first documents in the spine. Documents with little text, like a cover, title page or
+// colophon, say more about the publisher than about the language of the book and are skipped.
+func sample(zfs vfs.FileSystem, opf *etree.Document, opfDir string) string {
+	hrefs := make(map[string]string)
+	for _, el := range opf.FindElements("//manifest/item") {
+		hrefs[el.SelectAttrValue("id", "")] = el.SelectAttrValue("href", "")
+	}
+
+	var text strings.Builder
+	for _, el := range opf.FindElements("//spine/itemref") {
+		if text.Len() >= sampleSize {
+			break
+		}
+		href, _, _ := strings.Cut(hrefs[el.SelectAttrValue("idref", "")], "#")
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		if href == "" {
+			continue
+		}
+		doc := documentText(zfs, "/"+path.Join(opfDir, href))
+		if len(doc) < 500 {
+			continue
+		}
+		text.WriteString(doc)
+		text.WriteString("\n")
+	}
+
+	s := text.String()
+	if len(s) > sampleSize {
+		s = strings.ToValidUTF8(s[:sampleSize], "")
+	}
+	return s
+}
+
+var (
+	// nonText are the parts of a document that are not read, the head and scripts and styles in the body
+	nonText = regexp.MustCompile(`(?is)<head[\s>].*?</head>|<script[\s>].*?</script>|<style[\s>].*?</style>`)
+	markup  = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// documentText returns the text in an xhtml document without its markup. The documents are xml, an html parser would
+// read a <title/> as a title that never ends.
+func documentText(zfs vfs.FileSystem, name string) string {
+	f, err := zfs.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	doc, err := io.ReadAll(io.LimitReader(f, 1<<20))
+	if err != nil {
+		return ""
+	}
+
+	text := nonText.ReplaceAll(doc, nil)
+	text = markup.ReplaceAll(text, []byte(" "))
+	return strings.Join(strings.Fields(html.UnescapeString(string(text))), " ")
+}
+
 func parsePublishDate(s string) time.Time {
 	// handle the various dumb decisions people make when encoding dates
 	format := ""
@@ -0,0 +1,83 @@
+package epub
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// mimetype is what the mimetype file of an epub holds
+const mimetype = "application/epub+zip"
+
+// Validate checks that the file at bookpath is an epub: a zip with a container that points to a package document.
+// It reads no more than that, so it is cheap enough to check a file before it is accepted for import.
+func Validate(bookpath string) error {
+	zr, err := zip.OpenReader(bookpath)
+	if err != nil {
+		return errors.New("the file is not a zip archive")
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if f, ok := files["mimetype"]; ok {
+		content, err := readFile(f, int64(len(mimetype)+2))
+		if err != nil || strings.TrimSpace(string(content)) != mimetype {
+			return fmt.Errorf("the mimetype of the file is not %s", mimetype)
+		}
+	}
+
+	f, ok := files["META-INF/container.xml"]
+	if !ok {
+		return errors.New("the file has no META-INF/container.xml")
+	}
+	content, err := readFile(f, 1<<20)
+	if err != nil {
+		return err
+	}
+	container := etree.NewDocument()
+	if err := container.ReadFromBytes(content); err != nil {
+		return fmt.Errorf("the container of the file can not be read: %w", err)
+	}
+	el := container.FindElement("//rootfiles/rootfile[@full-path]")
+	if el == nil {
+		return errors.New("the container of the file has no rootfile")
+	}
+	rootfile := path.Clean(strings.TrimPrefix(el.SelectAttrValue("full-path", ""), "/"))
+	opf, ok := files[rootfile]
+	if !ok {
+		return fmt.Errorf("the package document %s is missing", rootfile)
+	}
+	content, err = readFile(opf, 16<<20)
+	if err != nil {
+		return err
+	}
+	if err := etree.NewDocument().ReadFromBytes(content); err != nil {
+		return fmt.Errorf("the package document %s can not be read: %w", rootfile, err)
+	}
+	return nil
+}
+
+// readFile returns the content of f, which may not be larger than max bytes
+func readFile(f *zip.File, max int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s can not be read: %w", f.Name, err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, max+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s can not be read: %w", f.Name, err)
+	}
+	if int64(len(content)) > max {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	return content, nil
+}
@@ -0,0 +1,293 @@
+package booksing
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FilenameMetadata is what the name of a file says about its book
+type FilenameMetadata struct {
+	Title       string
+	Author      string
+	Series      string
+	SeriesIndex float64
+	// Pattern is the name of the pattern that matched
+	Pattern string
+	// Confidence is between 0 and 1, how likely it is that the name was read the right way
+	Confidence float64
+}
+
+// FilenamePattern reads metadata from file names that follow a naming convention
+type FilenamePattern struct {
+	Name string
+	re   *regexp.Regexp
+	// confidence is how reliable the convention is, before the parts it matched are judged
+	confidence float64
+	// underscores are separating words instead of spaces
+	underscores bool
+}
+
+// filenamePatterns are the conventions booksing knows, the order breaks ties between equally confident matches
+var filenamePatterns = []FilenamePattern{
+	{
+		// Andre, Bella - [Sullivan #1] Op het eerste gezicht
+		Name:       "series",
+		re:         regexp.MustCompile(`^(?P<author>[^\[\]]+?)\s+-\s+\[(?P<series>[^\]]+?)\s*#?\s*(?P<index>\d+(?:\.\d+)?)\]\s*(?:-\s+)?(?P<title>.+)$`),
+		confidence: 0.9,
+	},
+	{
+		// Woltz, Anna - Black Box
+		Name:       "author-first",
+		re:         regexp.MustCompile(`^(?P<author>[^,\[\]]+,[^,\[\]]+?)\s+-\s+(?P<title>[^\[\]]+)$`),
+		confidence: 0.85,
+	},
+	{
+		// Golden Vanity - Rachel Pollack
+		Name:       "title-first",
+		re:         regexp.MustCompile(`^(?P<title>.+?)\s+-\s+(?P<author>[^,\[\]]+)$`),
+		confidence: 0.6,
+	},
+	{
+		// Terry_Pratchett-Guards_Guards or A_C_Baantjer-02_De_Cock_En_De_Wurger_Op_Zondag
+		Name:        "underscore",
+		re:          regexp.MustCompile(`^(?P<author>[^\s-]+_[^\s-]+)-(?:(?P<index>\d+)_)?(?P<title>\S+)$`),
+		confidence:  0.6,
+		underscores: true,
+	},
+}
+
+// DefaultFilenamePatterns are the names of all patterns booksing knows
+func DefaultFilenamePatterns() []string {
+	var names []string
+	for _, p := range filenamePatterns {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// ParseFilenamePatterns returns the patterns with these names. A name booksing does not know is used as a regular
+// expression, it needs a title group and can have author, series and index groups.
+func ParseFilenamePatterns(names []string) ([]FilenamePattern, error) {
+	var patterns []FilenamePattern
+names:
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		for _, p := range filenamePatterns {
+			if p.Name == name {
+				patterns = append(patterns, p)
+				continue names
+			}
+		}
+
+		re, err := regexp.Compile(name)
+		if err != nil {
+			return nil, fmt.Errorf("filename pattern %q is not a known pattern nor a valid regular expression: %w", name, err)
+		}
+		if re.SubexpIndex("title") < 0 {
+			return nil, fmt.Errorf("filename pattern %q has no title group", name)
+		}
+		patterns = append(patterns, FilenamePattern{
+			Name:       name,
+			re:         re,
+			confidence: 0.7,
+		})
+	}
+	return patterns, nil
+}
+
+// copySuffix is how file managers name a second copy, like "Septemberlichten (1).epub"
+var copySuffix = regexp.MustCompile(`\s*\(\d\)$`)
+
+// ParseFilename returns the most confident reading of the name of the file at path by any of patterns. It returns
+// false when no pattern matches.
+func ParseFilename(path string, patterns []FilenamePattern) (FilenameMetadata, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = strings.TrimSpace(copySuffix.ReplaceAllString(name, ""))
+
+	var best FilenameMetadata
+	found := false
+	for _, p := range patterns {
+		m, ok := p.parse(name)
+		if ok && (!found || m.Confidence > best.Confidence) {
+			best, found = m, true
+		}
+	}
+	return best, found
+}
+
+func (p FilenamePattern) parse(name string) (FilenameMetadata, bool) {
+	match := p.re.FindStringSubmatch(name)
+	if match == nil {
+		return FilenameMetadata{}, false
+	}
+	group := func(g string) string {
+		i := p.re.SubexpIndex(g)
+		if i < 0 {
+			return ""
+		}
+		s := match[i]
+		if p.underscores {
+			s = strings.ReplaceAll(s, "_", " ")
+		} else {
+			// calibre writes a colon as an underscore
+			s = strings.ReplaceAll(s, "_ ", ": ")
+		}
+		return strings.Join(strings.Fields(s), " ")
+	}
+
+	m := FilenameMetadata{
+		Title:      group("title"),
+		Author:     group("author"),
+		Series:     group("series"),
+		Pattern:    p.Name,
+		Confidence: p.confidence,
+	}
+	if m.Title == "" {
+		return FilenameMetadata{}, false
+	}
+	if index := group("index"); index != "" {
+		m.SeriesIndex, _ = strconv.ParseFloat(index, 64)
+	}
+	if m.Author != "" {
+		m.Confidence *= nameLikelihood(m.Author)
+	}
+	if p.underscores {
+		m.Confidence *= underscoreLikelihood(match[p.re.SubexpIndex("title")], m.Author, m.Title)
+	}
+	return m, true
+}
+
+// reversedName matches a name written last name first with a short first name, like Voorhorst At
+var reversedName = regexp.MustCompile(`^\p{Lu}\pL+ \p{Lu}\pL?$`)
+
+// underscoreLikelihood is 1 when the name with underscores was split between its author and title in a likely place.
+// The dash between them is the only separator, so a title with another bare dash may have been split off too early,
+// an author of more than three words has taken part of the title and a title that reads like a name last name first
+// is probably the author.
+func underscoreLikelihood(rawTitle, author, title string) float64 {
+	switch {
+	case strings.Contains(strings.ReplaceAll(rawTitle, "_-_", ""), "-"):
+		return 0.5
+	case len(strings.Fields(author)) > 3:
+		return 0.5
+	case reversedName.MatchString(title):
+		return 0.5
+	}
+	return 1
+}
+
+// nameLikelihood is 1 for something that looks like the name of a person and lower when it looks more like a title
+func nameLikelihood(s string) float64 {
+	words := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	switch {
+	case strings.ContainsAny(s, "0123456789!?:"):
+		return 0.5
+	case len(words) > 5:
+		return 0.7
+	}
+	return 1
+}
+
+const (
+	// filenameFill is the confidence a file name needs before it fills in what the epub does not know
+	filenameFill = 0.5
+	// filenameCorrect is the confidence a file name needs before its series overrules the one in the epub, a series
+	// in a file name was put there by a person and is more often right than the one an ebook store put in
+	filenameCorrect = 0.85
+)
+
+// ApplyFilename completes b with what its file name says. Fields the epub did not have are filled in, and a confident
+// series in the file name replaces a series in the epub that differs. An index without a series completes the series
+// of the epub. It returns the fields it changed.
+func (b *Book) ApplyFilename(m FilenameMetadata) []string {
+	if m.confidenceFor(b) < filenameFill {
+		return nil
+	}
+
+	var changed []string
+	// without a title in the epub its title is the name of the file
+	if m.Title != "" && (b.Missing("title") || strings.EqualFold(b.Title, filepath.Base(b.Path))) {
+		b.Title = m.Title
+		changed = append(changed, "title")
+	}
+	if m.Author != "" && b.Missing("author") {
+		b.Author = m.Author
+		changed = append(changed, "author")
+	}
+
+	if m.Series != "" {
+		same := strings.EqualFold(NormalizeSearch(b.Series), NormalizeSearch(m.Series)) && b.SeriesIndex == m.SeriesIndex
+		if b.Series == "" || (!same && m.Confidence >= filenameCorrect) {
+			b.Series, b.SeriesIndex = m.Series, m.SeriesIndex
+			changed = append(changed, "series", "series_index")
+		}
+	} else if m.SeriesIndex != 0 && b.Series != "" && b.SeriesIndex == 0 {
+		b.SeriesIndex = m.SeriesIndex
+		changed = append(changed, "series_index")
+	}
+	return changed
+}
+
+// confidenceFor is the confidence of m for the book b was read from. Every author or title the epub has that does not
+// agree with the file name halves it, the name was probably read the wrong way.
+func (m FilenameMetadata) confidenceFor(b *Book) float64 {
+	c := m.Confidence
+	if m.Title != "" && !b.Missing("title") && !strings.EqualFold(b.Title, filepath.Base(b.Path)) && !sameWords(m.Title, b.Title) {
+		c *= 0.5
+	}
+	if m.Author != "" && !b.Missing("author") && !sameWords(m.Author, b.Author) {
+		c *= 0.5
+	}
+	return c
+}
+
+// ampersandWords are written as & as well, a file name can not always have one
+var ampersandWords = wordSet("and en et und")
+
+// sameWords reports whether every word of short is in long. File names are often cut short and lose letters like the
+// å of Håkan, so a word that has its letters in order in a word of long is in it as well.
+func sameWords(short, long string) bool {
+	longWords := searchWords(long)
+	for _, w := range searchWords(short) {
+		found := ampersandWords[w]
+		for _, l := range longWords {
+			if subsequence(w, l) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchWords returns the normalized and lowercased words of s, without apostrophes so Clancy's is clancys
+func searchWords(s string) []string {
+	s = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(NormalizeSearch(s)))
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// subsequence reports whether the letters of s appear in t in the same order
+func subsequence(s, t string) bool {
+	for _, r := range t {
+		if s == "" {
+			break
+		}
+		if first, size := utf8.DecodeRuneInString(s); first == r {
+			s = s[size:]
+		}
+	}
+	return s == ""
+}
@@ -0,0 +1,273 @@
+package booksing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gnur/booksing/epub"
+)
+
+func TestParseFilename(t *testing.T) {
+	patterns, err := ParseFilenamePatterns(DefaultFilenamePatterns())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every book in the odd collection, with what its name says and whether it is confident after comparing it with the
+	// epub
+	tests := []struct {
+		name      string
+		pattern   string
+		author    string
+		title     string
+		series    string
+		index     float64
+		confident bool
+	}{
+		{"A_C_Baantjer-02_De_Cock_En_De_Wurger_Op_Zondag.epub", "underscore", "A C Baantjer", "De Cock En De Wurger Op Zondag", "", 2, true},
+		{"A_C_Baantjer-16_De_Cock_En_Het_Dodelijk_Akkoord.epub", "underscore", "A C Baantjer", "De Cock En Het Dodelijk Akkoord", "", 16, true},
+		{"A_G_Barnett-A_Staged_Death_A_Brock_Poole.epub", "underscore", "A G Barnett", "A Staged Death A Brock Poole", "", 0, true},
+		{"Andre, Bella - [Sullivan #1] Op het eerste gezicht.epub", "series", "Andre, Bella", "Op het eerste gezicht", "Sullivan", 1, true},
+		{"Andre, Bella - [Sullivan #2] Vanaf nu, altijd.epub", "series", "Andre, Bella", "Vanaf nu, altijd", "Sullivan", 2, true},
+		{"Andre, Bella - [Sullivan #4] Betoverd door jou.epub", "series", "Andre, Bella", "Betoverd door jou", "Sullivan", 4, true},
+		{"Andre, Bella - [Sullivan #5] Als je van mij was.epub", "series", "Andre, Bella", "Als je van mij was", "Sullivan", 5, true},
+		{"Andre, Bella - [Sullivan #6] De ware voor jou.epub", "series", "Andre, Bella", "De ware voor jou", "Sullivan", 6, true},
+		{"Andre, Bella - [Sullivan #7] Kom in mijn armen.epub", "series", "Andre, Bella", "Kom in mijn armen", "Sullivan", 7, true},
+		{"Andre, Bella - [Sullivan #8] Voor altijd in mijn hart.epub", "series", "Andre, Bella", "Voor altijd in mijn hart", "Sullivan", 8, true},
+		{"Andre, Bella - [Sullivan #9] Een gestolen kus.epub", "series", "Andre, Bella", "Een gestolen kus", "Sullivan", 9, true},
+		{"Angelini, Josephine - [Goddelijk #1] Vervloekt.epub", "series", "Angelini, Josephine", "Vervloekt", "Goddelijk", 1, true},
+		{"Anouk_Van_Arnhem-De_Klas_Van_Tina_Op_Werkweek.epub", "underscore", "Anouk Van Arnhem", "De Klas Van Tina Op Werkweek", "", 0, true},
+		{"Belsham, Alison - De tattooverzamelaar.epub", "author-first", "Belsham, Alison", "De tattooverzamelaar", "", 0, true},
+		{"Biesheuvel, J.M.A. - Brommer op zee.epub", "author-first", "Biesheuvel, J.M.A.", "Brommer op zee", "", 0, true},
+		{"Biesheuvel, J.M.A. - De verpletterende werkelijkheid en andere verhalen.epub", "author-first", "Biesheuvel, J.M.A.", "De verpletterende werkelijkheid en andere verhalen", "", 0, true},
+		{"Biesheuvel, J.M.A. - Een dag uit het leven van David Windvaantje.epub", "author-first", "Biesheuvel, J.M.A.", "Een dag uit het leven van David Windvaantje", "", 0, true},
+		{"Biesheuvel, J.M.A. - Een overtollig mens.epub", "author-first", "Biesheuvel, J.M.A.", "Een overtollig mens", "", 0, true},
+		{"Biesheuvel, J.M.A. - In de bovenkooi.epub", "author-first", "Biesheuvel, J.M.A.", "In de bovenkooi", "", 0, true},
+		{"Biesheuvel, J.M.A. - Reis door mijn kamer.epub", "author-first", "Biesheuvel, J.M.A.", "Reis door mijn kamer", "", 0, true},
+		{"Bjørk, Samuel - De doodsvogel.epub", "author-first", "Bjørk, Samuel", "De doodsvogel", "", 0, true},
+		{"Bjørk, Samuel - De jongen in de sneeuw.epub", "author-first", "Bjørk, Samuel", "De jongen in de sneeuw", "", 0, true},
+		{"Bjørk, Samuel - Ik reis alleen.epub", "author-first", "Bjørk, Samuel", "Ik reis alleen", "", 0, true},
+		{"Brugman, Marit - Friet in de kliniek.epub", "author-first", "Brugman, Marit", "Friet in de kliniek", "", 0, true},
+		{"Carlos_Ruiz_Zafon-Septemberlichten (1).epub", "underscore", "Carlos Ruiz Zafon", "Septemberlichten", "", 0, true},
+		{"Carlos_Ruiz_Zafon-Septemberlichten.epub", "underscore", "Carlos Ruiz Zafon", "Septemberlichten", "", 0, true},
+		{"Cummins, Fiona - De opvolger.epub", "author-first", "Cummins, Fiona", "De opvolger", "", 0, true},
+		{"De patroonmeester - Octavia Estelle Butler.epub", "title-first", "Octavia Estelle Butler", "De patroonmeester", "", 0, true},
+		{"De strijd om het licht - Gwyneth Cravens.epub", "title-first", "Gwyneth Cravens", "De strijd om het licht", "", 0, true},
+		{"De tijd van de jeneverbes - Kate Wilhelm.epub", "title-first", "Kate Wilhelm", "De tijd van de jeneverbes", "", 0, true},
+		{"De vrouw-man - Joanna Russ.epub", "title-first", "Joanna Russ", "De vrouw-man", "", 0, true},
+		{"Diverse Auteurs - Verzamelde Erotische Verhalen 21.epub", "title-first", "Verzamelde Erotische Verhalen 21", "Diverse Auteurs", "", 0, false},
+		{"Dubbelgangers_Ontmaskerd-Voorhorst_At.epub", "underscore", "Dubbelgangers Ontmaskerd", "Voorhorst At", "", 0, false},
+		{"Gardner, Erle Stanley - De zaak van de gillende vrouw.epub", "author-first", "Gardner, Erle Stanley", "De zaak van de gillende vrouw", "", 0, true},
+		{"Gardner, Erle Stanley - De zaak van een zorgeloze cupido.epub", "author-first", "Gardner, Erle Stanley", "De zaak van een zorgeloze cupido", "", 0, true},
+		{"Gardner, Erle Stanley - Het geheim van de gechanteerde dame.epub", "author-first", "Gardner, Erle Stanley", "Het geheim van de gechanteerde dame", "", 0, true},
+		{"Gardner, Erle Stanley - Het geheim van de onechte echtgenote.epub", "author-first", "Gardner, Erle Stanley", "Het geheim van de onechte echtgenote", "", 0, true},
+		{"Gardner, Erle Stanley - Het geheim van de pseudo zakenvrouw.epub", "author-first", "Gardner, Erle Stanley", "Het geheim van de pseudo zakenvrouw", "", 0, true},
+		{"Gardner, Erle Stanley - Het geheim van het jacht 'Jinesa'.epub", "author-first", "Gardner, Erle Stanley", "Het geheim van het jacht 'Jinesa'", "", 0, true},
+		{"Goeken, Paul - Camouflage.epub", "author-first", "Goeken, Paul", "Camouflage", "", 0, true},
+		{"Goeken, Paul - De Orde.epub", "author-first", "Goeken, Paul", "De Orde", "", 0, true},
+		{"Goeken, Paul - De oversteek.epub", "author-first", "Goeken, Paul", "De oversteek", "", 0, true},
+		{"Goeken, Paul - Dodelijke stijging.epub", "author-first", "Goeken, Paul", "Dodelijke stijging", "", 0, true},
+		{"Goeken, Paul - Hammerhead.epub", "author-first", "Goeken, Paul", "Hammerhead", "", 0, true},
+		{"Goeken, Paul - Spaanse Furie.epub", "author-first", "Goeken, Paul", "Spaanse Furie", "", 0, true},
+		{"Golden Vanity - Rachel Pollack.epub", "title-first", "Rachel Pollack", "Golden Vanity", "", 0, true},
+		{"Hakan_Ostlundh-De_Vrouw_Die_Wilde_Afrekenen.epub", "underscore", "Hakan Ostlundh", "De Vrouw Die Wilde Afrekenen", "", 0, true},
+		{"Ham, Lizzie van den - [Tussen de sterren 1] Laat me sterren zien.epub", "series", "Ham, Lizzie van den", "Laat me sterren zien", "Tussen de sterren", 1, true},
+		{"Ham, Lizzie van den - [Tussen de sterren 2] Laat me liefde voelen.epub", "series", "Ham, Lizzie van den", "Laat me liefde voelen", "Tussen de sterren", 2, true},
+		{"Ham, Lizzie van den - [Tussen de sterren 3] Laat me van jou zijn.epub", "series", "Ham, Lizzie van den", "Laat me van jou zijn", "Tussen de sterren", 3, true},
+		{"Hazegrauw - Chelsea Quinn Yarbro.epub", "title-first", "Chelsea Quinn Yarbro", "Hazegrauw", "", 0, true},
+		{"Hkan_stlundh-De_Vrouw_Die_Wilde_Afrekenen.epub", "underscore", "Hkan stlundh", "De Vrouw Die Wilde Afrekenen", "", 0, true},
+		{"Hoffman, Jilliane - Insomnia.epub", "author-first", "Hoffman, Jilliane", "Insomnia", "", 0, true},
+		{"Hoffman, Jilliane - Nummer 9.epub", "author-first", "Hoffman, Jilliane", "Nummer 9", "", 0, true},
+		{"Janssen, John-Alexander - Een verhaal uit de Zonnestad.epub", "author-first", "Janssen, John-Alexander", "Een verhaal uit de Zonnestad", "", 0, true},
+		{"Joris, Lieve - Terug naar Neerpelt.epub", "author-first", "Joris, Lieve", "Terug naar Neerpelt", "", 0, true},
+		{"Kingsbury, Karen - Vijftien minuten.epub", "author-first", "Kingsbury, Karen", "Vijftien minuten", "", 0, true},
+		{"Kingsbury, Karen - [Forever Faithful 1] Wachten op de morgen.epub", "series", "Kingsbury, Karen", "Wachten op de morgen", "Forever Faithful", 1, true},
+		{"Kingsbury, Karen - [Forever Faithful 2] Tweede kans.epub", "series", "Kingsbury, Karen", "Tweede kans", "Forever Faithful", 2, true},
+		{"Kingsbury, Karen - [Forever Faithful 3] Kostbaar geschenk.epub", "series", "Kingsbury, Karen", "Kostbaar geschenk", "Forever Faithful", 3, true},
+		{"Ko, Vinnie - Met hartelijke groente.epub", "author-first", "Ko, Vinnie", "Met hartelijke groente", "", 0, true},
+		{"Lara_Adrian_Schreibt_Als_Tina_St_John-Der_Kelch_Von_Anavrin_Das_Magi.epub", "underscore", "Lara Adrian Schreibt Als Tina St John", "Der Kelch Von Anavrin Das Magi", "", 0, false},
+		{"Maalouf, Amin - De ontheemden.epub", "author-first", "Maalouf, Amin", "De ontheemden", "", 0, true},
+		{"Macomber, Debbie - Breibabes.epub", "author-first", "Macomber, Debbie", "Breibabes", "", 0, true},
+		{"Macomber, Debbie - De geur van aarde.epub", "author-first", "Macomber, Debbie", "De geur van aarde", "", 0, true},
+		{"Macomber, Debbie - De hoogste tijd!.epub", "author-first", "Macomber, Debbie", "De hoogste tijd!", "", 0, true},
+		{"Macomber, Debbie - De kristallen bol.epub", "author-first", "Macomber, Debbie", "De kristallen bol", "", 0, true},
+		{"Macomber, Debbie - De ontbijtclub.epub", "author-first", "Macomber, Debbie", "De ontbijtclub", "", 0, true},
+		{"Macomber, Debbie - De wolwinkel.epub", "author-first", "Macomber, Debbie", "De wolwinkel", "", 0, true},
+		{"Macomber, Debbie - In goed vertrouwen.epub", "author-first", "Macomber, Debbie", "In goed vertrouwen", "", 0, true},
+		{"Macomber, Debbie - Stilte voor de storm.epub", "author-first", "Macomber, Debbie", "Stilte voor de storm", "", 0, true},
+		{"Macomber, Debbie - Terug naar Montana.epub", "author-first", "Macomber, Debbie", "Terug naar Montana", "", 0, true},
+		{"Macomber, Debbie - [Rose Harbor 1] De bed en breakfast in Rose Harbor.epub", "series", "Macomber, Debbie", "De bed en breakfast in Rose Harbor", "Rose Harbor", 1, true},
+		{"Macomber, Debbie - [Rose Harbor 2] Rose Harbor in bloei.epub", "series", "Macomber, Debbie", "Rose Harbor in bloei", "Rose Harbor", 2, true},
+		{"Macomber, Debbie - [Rose Harbor 3] Liefdesbrieven in Rose Harbor.epub", "series", "Macomber, Debbie", "Liefdesbrieven in Rose Harbor", "Rose Harbor", 3, true},
+		{"Macomber, Debbie - [Rose Harbor 4] Een nieuw begin in Rose Harbor.epub", "series", "Macomber, Debbie", "Een nieuw begin in Rose Harbor", "Rose Harbor", 4, true},
+		{"Macomber, Debbie - [Rose Harbor 5] Rose Harbor voor altijd.epub", "series", "Macomber, Debbie", "Rose Harbor voor altijd", "Rose Harbor", 5, true},
+		{"Mansell, Jill - Stuur me een berichtje.epub", "author-first", "Mansell, Jill", "Stuur me een berichtje", "", 0, true},
+		{"Margaret en ik - Kate Wilhelm.epub", "title-first", "Kate Wilhelm", "Margaret en ik", "", 0, true},
+		{"Mars, Jack - [Luke Stone #1] Koste wat het kost.epub", "series", "Mars, Jack", "Koste wat het kost", "Luke Stone", 1, true},
+		{"Mars, Jack - [Luke Stone #2] Ambtseed.epub", "series", "Mars, Jack", "Ambtseed", "Luke Stone", 2, true},
+		{"Meyerhoff, Joachim - Wanneer wordt het eindelijk weer zoals het nooit is geweest.epub", "author-first", "Meyerhoff, Joachim", "Wanneer wordt het eindelijk weer zoals het nooit is geweest", "", 0, true},
+		{"Middendorp, Peter - Jij bent van mij.epub", "author-first", "Middendorp, Peter", "Jij bent van mij", "", 0, true},
+		{"Ondaatje, Michael - Blindganger.epub", "author-first", "Ondaatje, Michael", "Blindganger", "", 0, true},
+		{"Perry_Rhodan-Perry_Rhodan_Pocket_G_-_05_-_P.epub", "underscore", "Perry Rhodan", "Perry Rhodan Pocket G - 05 - P", "", 0, true},
+		{"Perry_Rhodan-Perry_Rhodan_Pocket_G_-_10_-_P.epub", "underscore", "Perry Rhodan", "Perry Rhodan Pocket G - 10 - P", "", 0, true},
+		{"Pollack, Rachel - [SFem 5] - Golden Vanity.epub", "series", "Pollack, Rachel", "Golden Vanity", "SFem", 5, true},
+		{"Rijn, Linda van - Zomerhuis.epub", "author-first", "Rijn, Linda van", "Zomerhuis", "", 0, true},
+		{"Robben, Jaap - Zomervacht.epub", "author-first", "Robben, Jaap", "Zomervacht", "", 0, true},
+		{"Roberts, Nora - [Calhoun Saga 1] Catherine.epub", "series", "Roberts, Nora", "Catherine", "Calhoun Saga", 1, true},
+		{"Roberts, Nora - [Calhoun Saga 2] Amanda.epub", "series", "Roberts, Nora", "Amanda", "Calhoun Saga", 2, true},
+		{"Roberts, Nora - [Calhoun Saga 3] Lilah.epub", "series", "Roberts, Nora", "Lilah", "Calhoun Saga", 3, true},
+		{"Roberts, Nora - [Calhoun Saga 4] Suzanna.epub", "series", "Roberts, Nora", "Suzanna", "Calhoun Saga", 4, true},
+		{"Roberts, Nora - [Calhoun Saga 5] Megan.epub", "series", "Roberts, Nora", "Megan", "Calhoun Saga", 5, true},
+		{"Roberts, Nora - [De Gallaghers van Ardmore 1] Hart van de zee.epub", "series", "Roberts, Nora", "Hart van de zee", "De Gallaghers van Ardmore", 1, true},
+		{"Roberts, Nora - [De Gallaghers van Ardmore 2] Tranen van de maan.epub", "series", "Roberts, Nora", "Tranen van de maan", "De Gallaghers van Ardmore", 2, true},
+		{"Roberts, Nora - [De Gallaghers van Ardmore 3] Schittering van de zon.epub", "series", "Roberts, Nora", "Schittering van de zon", "De Gallaghers van Ardmore", 3, true},
+		{"Steiner, Susie - Na 72 uur.epub", "author-first", "Steiner, Susie", "Na 72 uur", "", 0, true},
+		{"Sveistrup, Soren - Oktober.epub", "author-first", "Sveistrup, Soren", "Oktober", "", 0, true},
+		{"Svernström, Bo - Wie zint op wraak.epub", "author-first", "Svernström, Bo", "Wie zint op wraak", "", 0, true},
+		{"Terry_Pratchett-Guards_Guards.epub", "underscore", "Terry Pratchett", "Guards Guards", "", 0, true},
+		{"The Pioppi Diet_ A 21-Day Lifes - Aseem Malhotra.epub", "title-first", "Aseem Malhotra", "The Pioppi Diet: A 21-Day Lifes", "", 0, true},
+		{"Thomas, Han - Het Darwin Dilemma.epub", "author-first", "Thomas, Han", "Het Darwin Dilemma", "", 0, true},
+		{"Tom_Clancys_Op-Center-Vuurlinie.epub", "underscore", "Tom Clancys Op", "Center-Vuurlinie", "", 0, false},
+		{"Troisi, Licia - [Het Drakenmeisje 1] De Erfenis Van Thuban.epub", "series", "Troisi, Licia", "De Erfenis Van Thuban", "Het Drakenmeisje", 1, true},
+		{"Troisi, Licia - [Het Drakenmeisje 2] De boom van Idhunn.epub", "series", "Troisi, Licia", "De boom van Idhunn", "Het Drakenmeisje", 2, true},
+		{"Troisi, Licia - [Het Drakenmeisje 3] De zandloper van Aldibah.epub", "series", "Troisi, Licia", "De zandloper van Aldibah", "Het Drakenmeisje", 3, true},
+		{"Troisi, Licia - [Het Drakenmeisje 4] De Tweeling van Kuma.epub", "series", "Troisi, Licia", "De Tweeling van Kuma", "Het Drakenmeisje", 4, true},
+		{"Vrouwen in wonderland - Pamela Sargent (red).epub", "title-first", "Pamela Sargent (red)", "Vrouwen in wonderland", "", 0, true},
+		{"W_Voltz-Perry_Rhodan_800_-_De_Keizerin.epub", "underscore", "W Voltz", "Perry Rhodan 800 - De Keizerin", "", 0, true},
+		{"Will, Milou van der - Stil in de stad.epub", "author-first", "Will, Milou van der", "Stil in de stad", "", 0, true},
+		{"Woltz, Anna - Black Box.epub", "author-first", "Woltz, Anna", "Black Box", "", 0, true},
+		{"Woltz, Anna - Honderd uur nacht.epub", "author-first", "Woltz, Anna", "Honderd uur nacht", "", 0, true},
+		{"Woltz, Anna - Ik kan nog steeds niet vliegen.epub", "author-first", "Woltz, Anna", "Ik kan nog steeds niet vliegen", "", 0, true},
+		{"Woltz, Anna - Mijn bijzonder rare week met Tess.epub", "author-first", "Woltz, Anna", "Mijn bijzonder rare week met Tess", "", 0, true},
+	}
+
+	dir := filepath.Join("testdata", "import", "odd-collection")
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]bool)
+	for _, tc := range tests {
+		want[tc.name] = true
+	}
+	for _, f := range files {
+		if !want[f.Name()] {
+			t.Errorf("%s has no test case", f.Name())
+		}
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, ok := ParseFilename(filepath.Join(dir, tc.name), patterns)
+			if !ok {
+				t.Fatalf("ParseFilename() found no pattern")
+			}
+			if m.Pattern != tc.pattern || m.Author != tc.author || m.Title != tc.title || m.Series != tc.series || m.SeriesIndex != tc.index {
+				t.Errorf("ParseFilename() = %s: %q by %q, %q %g, want %s: %q by %q, %q %g",
+					m.Pattern, m.Title, m.Author, m.Series, m.SeriesIndex, tc.pattern, tc.title, tc.author, tc.series, tc.index)
+			}
+			path := filepath.Join(dir, tc.name)
+			e, _, err := epub.ParseFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := Book{Title: e.Title, Author: e.Author, Path: path}
+			if c := m.confidenceFor(&b); c >= filenameFill != tc.confident {
+				t.Errorf("ParseFilename() confidence = %.2f, %.2f against the epub, want confident %v", m.Confidence, c, tc.confident)
+			}
+		})
+	}
+}
+
+func TestParseFilenamePatterns(t *testing.T) {
+	patterns, err := ParseFilenamePatterns([]string{"underscore", `^(?P<title>.+) by (?P<author>.+)$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patterns) != 2 {
+		t.Fatalf("ParseFilenamePatterns() returned %d patterns, want 2", len(patterns))
+	}
+	m, ok := ParseFilename("import/Guards Guards by Terry Pratchett.epub", patterns)
+	if !ok || m.Title != "Guards Guards" || m.Author != "Terry Pratchett" {
+		t.Errorf("ParseFilename() with a custom pattern = %+v, %v", m, ok)
+	}
+	if _, ok := ParseFilename("import/Woltz, Anna - Black Box.epub", patterns); ok {
+		t.Errorf("ParseFilename() matched a pattern that is not configured")
+	}
+
+	for _, invalid := range []string{`^(?P<author>.+)$`, `^(?P<title>.+`} {
+		if _, err := ParseFilenamePatterns([]string{invalid}); err == nil {
+			t.Errorf("ParseFilenamePatterns(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestApplyFilename(t *testing.T) {
+	tests := []struct {
+		name    string
+		book    Book
+		file    FilenameMetadata
+		changed []string
+		want    Book
+	}{
+		{
+			name:    "fills what the epub lacks",
+			book:    Book{Title: "Verzamelde verhalen.epub", Path: "import/Verzamelde verhalen.epub"},
+			file:    FilenameMetadata{Title: "Verzamelde verhalen", Author: "Diverse auteurs", Confidence: 0.6},
+			changed: []string{"title", "author"},
+			want:    Book{Title: "Verzamelde verhalen", Author: "Diverse auteurs", Path: "import/Verzamelde verhalen.epub"},
+		},
+		{
+			name: "keeps the epub when both know",
+			book: Book{Title: "Guards! Guards!", Author: "Terry Pratchett", Series: "Discworld", SeriesIndex: 8},
+			file: FilenameMetadata{Title: "Guards Guards", Author: "Terry Pratchett", Confidence: 0.6},
+			want: Book{Title: "Guards! Guards!", Author: "Terry Pratchett", Series: "Discworld", SeriesIndex: 8},
+		},
+		{
+			name:    "corrects a series",
+			book:    Book{Title: "Hart van de zee", Series: "De Gallaghers van Ardmore 3", SeriesIndex: 2},
+			file:    FilenameMetadata{Title: "Hart van de zee", Series: "De Gallaghers van Ardmore", SeriesIndex: 1, Confidence: 0.9},
+			changed: []string{"series", "series_index"},
+			want:    Book{Title: "Hart van de zee", Series: "De Gallaghers van Ardmore", SeriesIndex: 1},
+		},
+		{
+			name: "does not correct with a doubtful name",
+			book: Book{Title: "Hart van de zee", Series: "De Gallaghers van Ardmore 3", SeriesIndex: 2},
+			file: FilenameMetadata{Title: "Hart van de zee", Series: "De Gallaghers van Ardmore", SeriesIndex: 1, Confidence: 0.6},
+			want: Book{Title: "Hart van de zee", Series: "De Gallaghers van Ardmore 3", SeriesIndex: 2},
+		},
+		{
+			name:    "completes the index of a series",
+			book:    Book{Title: "De Cock en de wurger op zondag", Author: "A.C. Baantjer", Series: "De Cock"},
+			file:    FilenameMetadata{Title: "De Cock En De Wurger Op Zondag", Author: "A C Baantjer", SeriesIndex: 2, Confidence: 0.6},
+			changed: []string{"series_index"},
+			want:    Book{Title: "De Cock en de wurger op zondag", Author: "A.C. Baantjer", Series: "De Cock", SeriesIndex: 2},
+		},
+		{
+			name: "ignores a name the epub disagrees with",
+			book: Book{Title: "Vuurlinie", Author: "Tom Clancy's Op-Center"},
+			file: FilenameMetadata{Title: "Center-Vuurlinie", Author: "Tom Clancys Op", Series: "Op-Center", SeriesIndex: 5, Confidence: 0.9},
+			want: Book{Title: "Vuurlinie", Author: "Tom Clancy's Op-Center"},
+		},
+		{
+			name: "ignores an unlikely name",
+			book: Book{Title: "Verzamelde verhalen"},
+			file: FilenameMetadata{Title: "Diverse auteurs", Author: "Verzamelde verhalen 21", Confidence: 0.3},
+			want: Book{Title: "Verzamelde verhalen"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := tc.book
+			changed := b.ApplyFilename(tc.file)
+			if len(changed) != len(tc.changed) {
+				t.Errorf("ApplyFilename() changed %v, want %v", changed, tc.changed)
+			}
+			if b != tc.want {
+				t.Errorf("ApplyFilename() = %+v, want %+v", b, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// MergeAuthors makes names aliases of the author called name, an author that is merged gives its aliases to name. It
+// does not change books, the caller moves them with UpdateBook so their hashes follow.
+func (db *DB) MergeAuthors(name string, names []string) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		author := booksing.Author{Name: name}
+		err := tx.Where("name = ?", name).FirstOrCreate(&author).Error
+		if err != nil {
+			return err
+		}
+
+		for _, n := range names {
+			key := booksing.AuthorKey(n)
+			if n == name || key == booksing.AuthorKey(name) {
+				continue
+			}
+			var merged booksing.Author
+			err = tx.Where("name = ?", n).Limit(1).Find(&merged).Error
+			if err != nil {
+				return err
+			}
+			if merged.ID != 0 {
+				err = tx.Model(&booksing.AuthorAlias{}).Where("author_id = ?", merged.ID).Update("author_id", author.ID).Error
+				if err != nil {
+					return err
+				}
+				err = tx.Delete(&merged).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			err = tx.Where("key = ?", key).Delete(&booksing.AuthorAlias{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&booksing.AuthorAlias{AuthorID: author.ID, Alias: n, Key: key}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetAuthors returns the authors with their aliases, by name
+func (db *DB) GetAuthors() ([]booksing.Author, error) {
+	var authors []booksing.Author
+	tx := db.db.Preload("Aliases", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("alias")
+	}).Order("name").Find(&authors)
+	return authors, tx.Error
+}
+
+// GetAuthorAliases returns the name to use for every spelling of the authors
+func (db *DB) GetAuthorAliases() (booksing.AuthorAliases, error) {
+	authors, err := db.GetAuthors()
+	if err != nil {
+		return nil, err
+	}
+	return booksing.NewAuthorAliases(authors), nil
+}
+
+// DeleteAuthorAlias removes an alias, the books that were moved to its author keep their new name
+func (db *DB) DeleteAuthorAlias(id uint) error {
+	return db.db.Delete(&booksing.AuthorAlias{}, id).Error
+}
+
+// GetAuthorCounts returns every name books are stored under and how many books have it
+func (db *DB) GetAuthorCounts() ([]booksing.FacetCount, error) {
+	var counts []booksing.FacetCount
+	tx := db.db.Model(&booksing.Book{}).
+		Select("author AS value, count(*) AS count").
+		Group("author").Order("author").
+		Scan(&counts)
+	return counts, tx.Error
+}
+
+// GetBooksByAuthor returns the books stored under any of names
+func (db *DB) GetBooksByAuthor(names ...string) ([]booksing.Book, error) {
+	var books []booksing.Book
+	tx := db.db.Where("author IN ?", names).Order("id").Find(&books)
+	return books, tx.Error
+}
@@ -0,0 +1,122 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+func (db *DB) GetBookCount() int {
+	var count int64
+	tx := db.db.Model(&booksing.Book{}).Count(&count)
+	if tx.Error != nil {
+		return -1
+	}
+	return int(count)
+}
+
+func (db *DB) HasHash(h string) (bool, error) {
+	var count int64
+	tx := db.db.Model(&booksing.Book{}).Where("hash = ?", h).Count(&count)
+	return count > 0, tx.Error
+}
+
+func (db *DB) AddBook(b booksing.Book) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&b).Error
+		if err != nil {
+			return err
+		}
+		return TagBooks(tx, []booksing.Book{b})
+	})
+}
+
+// GetBook returns the book with id
+func (db *DB) GetBook(id uint) (*booksing.Book, error) {
+	var b booksing.Book
+	tx := db.db.First(&b, id)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return &b, booksing.ErrNotFound
+	}
+	return &b, tx.Error
+}
+
+// GetBookByHash returns the first book of the work with hash
+func (db *DB) GetBookByHash(hash string) (*booksing.Book, error) {
+	var b booksing.Book
+	tx := db.db.Where("hash = ?", hash).Order("id").First(&b)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return &b, booksing.ErrNotFound
+	}
+	return &b, tx.Error
+}
+
+func (db *DB) GetBookByChecksum(sum string) (*booksing.Book, error) {
+	var b booksing.Book
+	tx := db.db.Where("checksum = ?", sum).First(&b)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return &b, booksing.ErrNotFound
+	}
+	return &b, tx.Error
+}
+
+func (db *DB) GetBooksWithoutChecksum() ([]booksing.Book, error) {
+	var books []booksing.Book
+	tx := db.db.Select("id", "hash", "path").Where("checksum = '' OR checksum IS NULL").Find(&books)
+	return books, tx.Error
+}
+
+func (db *DB) SetChecksum(id uint, sum string) error {
+	tx := db.db.Model(&booksing.Book{}).Where("id = ?", id).UpdateColumn("checksum", sum)
+	return tx.Error
+}
+
+// AddBooks stores books and returns the ones it stored with their id, books with a path that is already stored are
+// skipped
+func (db *DB) AddBooks(books []booksing.Book) ([]booksing.Book, error) {
+	var added []booksing.Book
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		var paths []string
+		for _, b := range books {
+			if b.Path != "" {
+				paths = append(paths, b.Path)
+			}
+		}
+		var stored []string
+		// deleted books keep their path in the unique index
+		err := tx.Unscoped().Model(&booksing.Book{}).Where("path IN ?", paths).Pluck("path", &stored).Error
+		if err != nil {
+			return err
+		}
+		skip := make(map[string]bool)
+		for _, p := range stored {
+			skip[p] = true
+		}
+		for _, b := range books {
+			if b.Path != "" {
+				if skip[b.Path] {
+					continue
+				}
+				skip[b.Path] = true
+			}
+			added = append(added, b)
+		}
+		if len(added) == 0 {
+			return nil
+		}
+
+		err = tx.Create(&added).Error
+		if err != nil {
+			return err
+		}
+		return TagBooks(tx, added)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (db *DB) DeleteBook(id uint) error {
+	tx := db.db.Delete(&booksing.Book{}, id)
+	return tx.Error
+}
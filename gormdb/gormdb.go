@@ -0,0 +1,24 @@
+// Package gormdb holds the parts of the booksing database that gorm writes the same for every backend. The sqlite and
+// postgres backends embed DB and add what their sql dialect does differently, like searching and migrating.
+package gormdb
+
+import (
+	"gorm.io/gorm"
+)
+
+// DB implements the methods of the booksing database that do not depend on the sql dialect
+type DB struct {
+	db *gorm.DB
+}
+
+// New returns the shared methods on db, a connection opened by a backend
+func New(db *gorm.DB) *DB {
+	return &DB{db: db}
+}
+
+func (db *DB) Close() {
+	sqlDB, err := db.db.DB()
+	if err == nil {
+		sqlDB.Close()
+	}
+}
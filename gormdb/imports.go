@@ -0,0 +1,69 @@
+package gormdb
+
+import (
+	"time"
+
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// SaveImportJob stores a new import job or the counters of an existing one
+func (db *DB) SaveImportJob(j *booksing.ImportJob) error {
+	return db.db.Save(j).Error
+}
+
+// AddImportFiles stores the outcomes of files
+func (db *DB) AddImportFiles(files []booksing.ImportFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	return db.db.CreateInBatches(files, 100).Error
+}
+
+// StopUnfinishedImports marks the import jobs that never finished as stopped and returns how many there were. Only
+// call it when no import runs, a running job is not finished yet either.
+func (db *DB) StopUnfinishedImports() (int64, error) {
+	tx := db.db.Model(&booksing.ImportJob{}).
+		Where("(finished IS NULL OR finished = ?) AND stopped = ?", time.Time{}, false).
+		Update("stopped", true)
+	return tx.RowsAffected, tx.Error
+}
+
+// GetImportJobs returns the latest limit import jobs, newest first
+func (db *DB) GetImportJobs(limit int) ([]booksing.ImportJob, error) {
+	var jobs []booksing.ImportJob
+	tx := db.db.Order("id DESC").Limit(limit).Find(&jobs)
+	return jobs, tx.Error
+}
+
+// GetImportJob returns the import job with id and the outcomes of its files, files that were not added come first
+func (db *DB) GetImportJob(id uint) (*booksing.ImportJob, []booksing.ImportFile, error) {
+	var j booksing.ImportJob
+	tx := db.db.First(&j, id)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return nil, nil, booksing.ErrNotFound
+	}
+	if tx.Error != nil {
+		return nil, nil, tx.Error
+	}
+	var files []booksing.ImportFile
+	tx = db.db.Where("import_job_id = ?", id).
+		Order("CASE outcome WHEN 'added' THEN 1 ELSE 0 END, outcome, path").
+		Find(&files)
+	return &j, files, tx.Error
+}
+
+// GetImportedPaths returns the paths that are imported already: those of books, deleted ones included, and of
+// copies of stored books
+func (db *DB) GetImportedPaths() (map[string]bool, error) {
+	var paths []string
+	tx := db.db.Raw("SELECT path FROM books UNION SELECT path FROM import_files WHERE outcome = ?", booksing.ImportDuplicate).Scan(&paths)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	imported := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		imported[p] = true
+	}
+	return imported, nil
+}
@@ -0,0 +1,28 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// NormalizeLanguages writes the language of every book the way FixLang does, books imported before it knew ISO 639-2
+// codes and names of languages have fre, français and French where they should have fr. A language FixLang does not
+// know is left as it is, it may still say more than nothing.
+func NormalizeLanguages(tx *gorm.DB) error {
+	var languages []string
+	err := tx.Unscoped().Model(&booksing.Book{}).Distinct().Pluck("language", &languages).Error
+	if err != nil {
+		return err
+	}
+	for _, lang := range languages {
+		fixed := booksing.FixLang(lang)
+		if fixed == lang || fixed == "" {
+			continue
+		}
+		err = tx.Unscoped().Model(&booksing.Book{}).Where("language = ?", lang).UpdateColumn("language", fixed).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm/clause"
+)
+
+func (db *DB) SaveProgress(p *booksing.Progress) error {
+	tx := db.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user"}, {Name: "document"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "book_id", "progress", "percentage", "device", "device_id", "timestamp"}),
+	}).Create(p)
+	return tx.Error
+}
+
+func (db *DB) SaveReadingState(r *booksing.ReadingState) error {
+	tx := db.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user"}, {Name: "book_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "status", "started", "finished", "rating", "note"}),
+	}).Create(r)
+	return tx.Error
+}
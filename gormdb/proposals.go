@@ -0,0 +1,80 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// GetIncompleteBooks returns the books that miss an author, title, description or ISBN
+func (db *DB) GetIncompleteBooks() ([]booksing.Book, error) {
+	var books []booksing.Book
+	tx := db.db.Where("author = 'Unknown' OR title = 'Unknown' OR coalesce(description, '') = '' OR coalesce(isbn, '') = ''").Order("id").Find(&books)
+	return books, tx.Error
+}
+
+// UpdateBook stores fields of b, the hash is always stored as well because it follows the title and author. When no
+// other book keeps the old hash, everything that referred to it moves to the new hash and the old one becomes an alias.
+func (db *DB) UpdateBook(b *booksing.Book, fields ...string) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var old booksing.Book
+		err := tx.Select("id", "hash").First(&old, b.ID).Error
+		if err == gorm.ErrRecordNotFound {
+			return booksing.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(b).Select(append(fields[:len(fields):len(fields)], "hash", "hash_version")).Updates(b).Error
+		if err != nil || old.Hash == b.Hash {
+			return err
+		}
+		var kept int64
+		err = tx.Unscoped().Model(&booksing.Book{}).Where("hash = ?", old.Hash).Count(&kept).Error
+		if err != nil || kept > 0 {
+			return err
+		}
+		err = moveHash(tx, old.Hash, b.Hash)
+		if err != nil {
+			return err
+		}
+		return tx.Where("hash = ?", b.Hash).Delete(&booksing.HashAlias{}).Error
+	})
+}
+
+// SaveProposals stores proposals, they replace the earlier proposals for the same field of the same book
+func (db *DB) SaveProposals(proposals []booksing.Proposal) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range proposals {
+			err := tx.Where("book = ? AND field = ?", p.Book, p.Field).Delete(&booksing.Proposal{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&p).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetProposals returns all proposals, grouped by book
+func (db *DB) GetProposals() ([]booksing.Proposal, error) {
+	var proposals []booksing.Proposal
+	tx := db.db.Order("book, id").Find(&proposals)
+	return proposals, tx.Error
+}
+
+func (db *DB) GetProposal(id uint) (*booksing.Proposal, error) {
+	var p booksing.Proposal
+	tx := db.db.First(&p, id)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return nil, booksing.ErrNotFound
+	}
+	return &p, tx.Error
+}
+
+func (db *DB) DeleteProposal(id uint) error {
+	return db.db.Delete(&booksing.Proposal{}, id).Error
+}
@@ -0,0 +1,84 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rehash recomputes the hash of every book with the current version of booksing.HashBook. Works that end up with
+// the same hash are merged and the old hashes are kept as aliases. Downloads, progress and reading states refer to a
+// book by its id, so they stay where they are.
+func (db *DB) Rehash() (*booksing.RehashResult, error) {
+	var res *booksing.RehashResult
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		res, err = rehash(tx)
+		return err
+	})
+	return res, err
+}
+
+// RehashBooks rehashes the books in tx, it is the rehash migration of every backend as well
+func RehashBooks(tx *gorm.DB) error {
+	_, err := rehash(tx)
+	return err
+}
+
+func rehash(tx *gorm.DB) (*booksing.RehashResult, error) {
+	var books []booksing.Book
+	// deleted books are rehashed as well, so they stay with their work when they are restored
+	err := tx.Unscoped().Order("id").Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var res booksing.RehashResult
+	for _, g := range booksing.PlanRehash(books) {
+		err = tx.Unscoped().Model(&booksing.Book{}).Where("id IN ?", g.Books).Update("hash", g.Hash).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, old := range g.Aliases {
+			err = moveHash(tx, old, g.Hash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res.Rehashed += len(g.Books)
+		res.Merged += g.Merged()
+	}
+
+	err = tx.Unscoped().Model(&booksing.Book{}).Where("hash_version < ?", booksing.HashVersion).Update("hash_version", booksing.HashVersion).Error
+	if err != nil {
+		return nil, err
+	}
+	// a work that got the hash of an alias back always wins
+	err = tx.Exec("DELETE FROM hash_aliases WHERE hash IN (SELECT hash FROM books)").Error
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// moveHash leads hash old, and the hashes that already led to it, to hash new
+func moveHash(tx *gorm.DB, old, new string) error {
+	err := tx.Model(&booksing.HashAlias{}).Where("book = ?", old).Update("book", new).Error
+	if err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"book"}),
+	}).Create(&booksing.HashAlias{Hash: old, Book: new}).Error
+}
+
+// ResolveHash returns the current hash of a book that had hash before it was rehashed
+func (db *DB) ResolveHash(hash string) (string, error) {
+	var a booksing.HashAlias
+	tx := db.db.Where("hash = ?", hash).First(&a)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return "", booksing.ErrNotFound
+	}
+	return a.Book, tx.Error
+}
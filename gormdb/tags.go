@@ -0,0 +1,158 @@
+package gormdb
+
+import (
+	"strings"
+
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// TagBooks links books that were just added to the tags they list. Books are found by path because AddBooks skips
+// books that are stored already, a stored book that has tags keeps them.
+func TagBooks(tx *gorm.DB, books []booksing.Book) error {
+	tags := make(map[string][]string)
+	var paths []string
+	for _, b := range books {
+		if b.Tags != "" && b.Path != "" {
+			tags[b.Path] = b.TagNames()
+			paths = append(paths, b.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	var stored []booksing.Book
+	err := tx.Select("id", "path").Where("path IN ?", paths).Where("id NOT IN (SELECT book_id FROM book_tags)").Find(&stored).Error
+	if err != nil {
+		return err
+	}
+	for _, b := range stored {
+		err = setTags(tx, b.ID, tags[b.Path])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTags replaces the tags of a book, tags that are new are created
+func setTags(tx *gorm.DB, book uint, names []string) error {
+	err := tx.Where("book_id = ?", book).Delete(&booksing.BookTag{}).Error
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, n := range names {
+		n = booksing.TagName(n)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		tag := booksing.Tag{Name: n}
+		err = tx.Where("name = ?", n).FirstOrCreate(&tag).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(&booksing.BookTag{BookID: book, TagID: tag.ID}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return writeTags(tx, book)
+}
+
+// writeTags stores the names of the tags of books in their tags column, which is what search indexes
+func writeTags(tx *gorm.DB, books ...uint) error {
+	for _, id := range books {
+		var names []string
+		err := tx.Model(&booksing.Tag{}).
+			Joins("JOIN book_tags ON book_tags.tag_id = tags.id").
+			Where("book_tags.book_id = ?", id).
+			Order("tags.name").Pluck("tags.name", &names).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&booksing.Book{}).Where("id = ?", id).UpdateColumn("tags", strings.Join(names, "\n")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeUnusedTags(tx *gorm.DB) error {
+	return tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM book_tags)").Error
+}
+
+// SetBookTags replaces the tags of the book with id by the tags with names
+func (db *DB) SetBookTags(id uint, names []string) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		err := setTags(tx, id, names)
+		if err != nil {
+			return err
+		}
+		return removeUnusedTags(tx)
+	})
+}
+
+// GetTags returns every tag and how many books have it, by name
+func (db *DB) GetTags() ([]booksing.FacetCount, error) {
+	var tags []booksing.FacetCount
+	tx := db.db.Model(&booksing.Tag{}).
+		Select("tags.name AS value, count(*) AS count").
+		Joins("JOIN book_tags ON book_tags.tag_id = tags.id").
+		Joins("JOIN books ON books.id = book_tags.book_id AND books.deleted_at IS NULL").
+		Group("tags.name").Order("tags.name").
+		Scan(&tags)
+	return tags, tx.Error
+}
+
+// RenameTag gives the tag from the name to, when a tag called to exists already the two are merged
+func (db *DB) RenameTag(from, to string) error {
+	from, to = booksing.TagName(from), booksing.TagName(to)
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var old booksing.Tag
+		err := tx.Where("name = ?", from).First(&old).Error
+		if err == gorm.ErrRecordNotFound {
+			return booksing.ErrNotFound
+		}
+		if err != nil || from == to {
+			return err
+		}
+		var books []uint
+		err = tx.Model(&booksing.BookTag{}).Where("tag_id = ?", old.ID).Pluck("book_id", &books).Error
+		if err != nil {
+			return err
+		}
+
+		var target booksing.Tag
+		err = tx.Where("name = ?", to).Limit(1).Find(&target).Error
+		if err != nil {
+			return err
+		}
+		if target.ID == 0 {
+			err = tx.Model(&old).Update("name", to).Error
+		} else {
+			// a book with both tags keeps a single one
+			err = tx.Where("tag_id = ? AND book_id IN (SELECT book_id FROM book_tags WHERE tag_id = ?)", old.ID, target.ID).Delete(&booksing.BookTag{}).Error
+			if err == nil {
+				err = tx.Model(&booksing.BookTag{}).Where("tag_id = ?", old.ID).Update("tag_id", target.ID).Error
+			}
+			if err == nil {
+				err = tx.Delete(&old).Error
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return writeTags(tx, books...)
+	})
+}
+
+// GetUntaggedBooks returns the books without tags
+func (db *DB) GetUntaggedBooks() ([]booksing.Book, error) {
+	var books []booksing.Book
+	tx := db.db.Where("tags = ''").Order("id").Find(&books)
+	return books, tx.Error
+}
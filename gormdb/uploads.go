@@ -0,0 +1,41 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+)
+
+// AddUpload stores an uploaded file
+func (db *DB) AddUpload(u *booksing.Upload) error {
+	return db.db.Create(u).Error
+}
+
+// GetUploads returns the latest limit uploads of uploader, or of every user when uploader is empty, newest first
+func (db *DB) GetUploads(uploader string, limit int) ([]booksing.Upload, error) {
+	var uploads []booksing.Upload
+	tx := db.db.Order("id DESC").Limit(limit)
+	if uploader != "" {
+		tx = tx.Where("uploader = ?", uploader)
+	}
+	tx = tx.Find(&uploads)
+	return uploads, tx.Error
+}
+
+// GetPendingUploads returns the uploads that were not imported yet
+func (db *DB) GetPendingUploads() ([]booksing.Upload, error) {
+	var uploads []booksing.Upload
+	tx := db.db.Where("status = ?", booksing.UploadPending).Order("id").Find(&uploads)
+	return uploads, tx.Error
+}
+
+// SetUploadResult stores what the import made of the pending upload at path, book is the book it became or is a copy of
+func (db *DB) SetUploadResult(path string, status booksing.UploadStatus, message string, book uint) error {
+	return db.db.Model(&booksing.Upload{}).
+		Where("path = ? AND status = ?", path, booksing.UploadPending).
+		Updates(map[string]interface{}{"status": status, "message": message, "book_id": book}).Error
+}
+
+// FinishUploads marks the pending uploads that are stored as a book as added
+func (db *DB) FinishUploads() error {
+	return db.db.Exec("UPDATE uploads SET status = ?, book_id = (SELECT books.id FROM books WHERE books.path = uploads.path AND books.deleted_at IS NULL) WHERE status = ? AND path IN (SELECT path FROM books WHERE deleted_at IS NULL)",
+		booksing.UploadAdded, booksing.UploadPending).Error
+}
@@ -0,0 +1,20 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+func (db *DB) AddDownload(dl booksing.Download) error {
+	tx := db.db.Create(&dl)
+	return tx.Error
+}
+
+func (db *DB) GetUser(username string) (booksing.User, error) {
+	var u booksing.User
+	tx := db.db.Where("name = ?", username).First(&u)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return u, booksing.ErrNotFound
+	}
+	return u, tx.Error
+}
@@ -0,0 +1,153 @@
+package gormdb
+
+import (
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// GroupWorks gives every book without a work the work of the editions it shares a hash, an ISBN or a place in a
+// series with, or a new work. Works that no book belongs to anymore are removed.
+func (db *DB) GroupWorks() error {
+	return db.db.Transaction(GroupWorks)
+}
+
+// GroupWorks groups the books in tx into works, it is the group_works migration of every backend as well
+func GroupWorks(tx *gorm.DB) error {
+	var books []booksing.Book
+	// deleted books keep their work, so they are grouped as well
+	err := tx.Unscoped().Select("id", "hash", "title", "author", "isbn", "series", "series_index", "work_id").Order("id").Find(&books).Error
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint]booksing.Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	for _, g := range booksing.PlanWorks(books) {
+		work := g.Work
+		if work == 0 {
+			first := byID[g.Books[0]]
+			w := booksing.Work{Title: first.Title, Author: first.Author}
+			err = tx.Create(&w).Error
+			if err != nil {
+				return err
+			}
+			work = w.ID
+		}
+		err = tx.Unscoped().Model(&booksing.Book{}).Where("id IN ?", g.Books).UpdateColumn("work_id", work).Error
+		if err != nil {
+			return err
+		}
+	}
+	return removeEmptyWorks(tx)
+}
+
+func removeEmptyWorks(tx *gorm.DB) error {
+	return tx.Exec("DELETE FROM works WHERE id NOT IN (SELECT work_id FROM books)").Error
+}
+
+// LinkWork makes book an edition of the work of another book
+func (db *DB) LinkWork(book, to uint) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var other booksing.Book
+		err := tx.Select("id", "title", "author", "work_id").First(&other, to).Error
+		if err == gorm.ErrRecordNotFound {
+			return booksing.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if other.WorkID == 0 {
+			// the other book was not grouped yet, it gets a work of its own first
+			w := booksing.Work{Title: other.Title, Author: other.Author}
+			err = tx.Create(&w).Error
+			if err != nil {
+				return err
+			}
+			err = setWork(tx, to, w.ID)
+			if err != nil {
+				return err
+			}
+			other.WorkID = w.ID
+		}
+		err = setWork(tx, book, other.WorkID)
+		if err != nil {
+			return err
+		}
+		return removeEmptyWorks(tx)
+	})
+}
+
+// UnlinkWork takes book out of its work, it becomes the only edition of a new work
+func (db *DB) UnlinkWork(book uint) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var b booksing.Book
+		err := tx.Select("id", "title", "author").First(&b, book).Error
+		if err == gorm.ErrRecordNotFound {
+			return booksing.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		w := booksing.Work{Title: b.Title, Author: b.Author}
+		err = tx.Create(&w).Error
+		if err != nil {
+			return err
+		}
+		err = setWork(tx, book, w.ID)
+		if err != nil {
+			return err
+		}
+		return removeEmptyWorks(tx)
+	})
+}
+
+func setWork(tx *gorm.DB, book, work uint) error {
+	res := tx.Model(&booksing.Book{}).Where("id = ?", book).UpdateColumn("work_id", work)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return booksing.ErrNotFound
+	}
+	return nil
+}
+
+// GetEditions returns all editions of the given works, ordered by language
+func (db *DB) GetEditions(works ...uint) ([]booksing.Book, error) {
+	var books []booksing.Book
+	tx := db.db.Where("work_id IN ? AND work_id != 0", works).Order("language, id").Find(&books)
+	return books, tx.Error
+}
+
+// EditionsOf returns the editions of the works of books by work
+func (db *DB) EditionsOf(books []booksing.Book) (map[uint][]booksing.Book, error) {
+	var works []uint
+	for _, b := range books {
+		if b.WorkID != 0 {
+			works = append(works, b.WorkID)
+		}
+	}
+	editions := make(map[uint][]booksing.Book)
+	if len(works) == 0 {
+		return editions, nil
+	}
+	all, err := db.GetEditions(works...)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range all {
+		editions[b.WorkID] = append(editions[b.WorkID], b)
+	}
+	return editions, nil
+}
+
+// FirstEditions limits a book query to the first edition of every work that matches the scopes, books that are not
+// grouped yet are all kept
+func FirstEditions(db *gorm.DB, scopes ...func(*gorm.DB) *gorm.DB) func(*gorm.DB) *gorm.DB {
+	first := db.Model(&booksing.Book{}).Select("min(books.id)").Scopes(scopes...).Where("books.work_id != 0").Group("books.work_id")
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("books.work_id = 0 OR books.id IN (?)", first)
+	}
+}
@@ -0,0 +1,89 @@
+package booksing
+
+import "time"
+
+// ImportOutcome is what an import made of a single file
+type ImportOutcome string
+
+// The outcomes of a file, a duplicate is a copy of a stored book, a rejected book is too large or in a language
+// that is not accepted and a skipped file was not read because the job was stopped first
+const (
+	ImportAdded     ImportOutcome = "added"
+	ImportDuplicate ImportOutcome = "duplicate"
+	ImportRejected  ImportOutcome = "rejected"
+	ImportFailed    ImportOutcome = "failed"
+	ImportSkipped   ImportOutcome = "skipped"
+)
+
+// ImportJob is a single run of the import over the files in the import dir that were not imported before
+type ImportJob struct {
+	ID      uint `gorm:"primaryKey"`
+	Started time.Time
+	// Finished is zero while the job runs, or when booksing died before the job was done. Stopped is set when the job
+	// was canceled by an admin, because booksing shut down or, without Finished, when booksing started again after it
+	// died.
+	Finished time.Time
+	Stopped  bool
+	// Found is the number of new files, Parsed how many of them could be read
+	Found     int
+	Parsed    int
+	Added     int
+	Duplicate int
+	Rejected  int
+	Failed    int
+	Skipped   int
+}
+
+// ImportFile is the outcome of a single file of an ImportJob
+type ImportFile struct {
+	ID          uint `gorm:"primaryKey"`
+	ImportJobID uint `gorm:"index"`
+	Path        string
+	Outcome     ImportOutcome
+	// Message says why a file was not added
+	Message string
+	// Took is how long reading the file took
+	Took time.Duration
+}
+
+// Done returns how many files have an outcome
+func (j ImportJob) Done() int {
+	return j.Added + j.Duplicate + j.Rejected + j.Failed + j.Skipped
+}
+
+// Count adds a file with outcome o to the counters of j
+func (j *ImportJob) Count(o ImportOutcome) {
+	switch o {
+	case ImportAdded:
+		j.Added++
+	case ImportDuplicate:
+		j.Duplicate++
+	case ImportRejected:
+		j.Rejected++
+	case ImportFailed:
+		j.Failed++
+	case ImportSkipped:
+		j.Skipped++
+	}
+}
+
+// Took returns how long the job ran, or has been running when it is not finished. A job that was stopped when booksing
+// died did not record when it ended, it took 0.
+func (j ImportJob) Took() time.Duration {
+	if j.Finished.IsZero() && j.Stopped {
+		return 0
+	}
+	if j.Finished.IsZero() {
+		return time.Since(j.Started)
+	}
+	return j.Finished.Sub(j.Started)
+}
+
+// Remaining estimates how long a running job still needs from the pace it had so far, it is zero until a file is done
+func (j ImportJob) Remaining() time.Duration {
+	done := j.Done()
+	if done == 0 || !j.Finished.IsZero() || done >= j.Found {
+		return 0
+	}
+	return j.Took() / time.Duration(done) * time.Duration(j.Found-done)
+}
@@ -0,0 +1,34 @@
+package booksing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImportJob(t *testing.T) {
+	started := time.Now().Add(-time.Minute)
+	j := ImportJob{Started: started, Found: 4}
+	if j.Remaining() != 0 {
+		t.Errorf("Remaining() before a file is done = %v, want 0", j.Remaining())
+	}
+	for _, o := range []ImportOutcome{ImportAdded, ImportDuplicate, ImportFailed} {
+		j.Count(o)
+	}
+	if j.Done() != 3 || j.Added != 1 || j.Duplicate != 1 || j.Failed != 1 {
+		t.Errorf("Count() gives %+v, want a file of every outcome that was counted", j)
+	}
+	// three files took a minute, the last one takes another twenty seconds
+	if r := j.Remaining(); r < 19*time.Second || r > 21*time.Second {
+		t.Errorf("Remaining() = %v, want about 20s", r)
+	}
+
+	j.Finished = started.Add(2 * time.Minute)
+	if j.Took() != 2*time.Minute || j.Remaining() != 0 {
+		t.Errorf("Took() = %v and Remaining() = %v of a finished job, want 2m0s and 0", j.Took(), j.Remaining())
+	}
+
+	died := ImportJob{Started: started, Found: 4, Stopped: true}
+	if died.Took() != 0 || died.Remaining() != 0 {
+		t.Errorf("Took() = %v and Remaining() = %v of a job that stopped when booksing died, want 0 and 0", died.Took(), died.Remaining())
+	}
+}
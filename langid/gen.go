@@ -0,0 +1,31 @@
+//go:build ignore
+
+// gen writes a profile for every text in corpus to profiles, run it with go generate after changing a corpus
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnur/booksing/langid"
+)
+
+func main() {
+	corpora, err := filepath.Glob(filepath.Join("corpus", "*.txt"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range corpora {
+		text, err := os.ReadFile(c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grams := langid.Profile(string(text), langid.ProfileSize)
+		err = os.WriteFile(filepath.Join("profiles", filepath.Base(c)), []byte(strings.Join(grams, "\n")+"\n"), 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
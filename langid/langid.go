@@ -0,0 +1,144 @@
+// Package langid identifies the language of a text by comparing its most frequent n-grams with those of known
+// languages, the way Cavnar and Trenkle describe in "N-Gram-Based Text Categorization".
+package langid
+
+import (
+	"bufio"
+	"embed"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:generate go run gen.go
+
+// ProfileSize is the number of n-grams kept per language, more mostly adds noise
+const ProfileSize = 300
+
+// minLetters is the least amount of text that says anything about its language
+const minLetters = 100
+
+//go:embed profiles/*.txt
+var profileFiles embed.FS
+
+// profiles has the rank of every n-gram in the profile of a language, by ISO 639-1 code
+var profiles = loadProfiles()
+
+func loadProfiles() map[string]map[string]int {
+	files, err := profileFiles.ReadDir("profiles")
+	if err != nil {
+		panic(err)
+	}
+	ps := make(map[string]map[string]int)
+	for _, f := range files {
+		lang := strings.TrimSuffix(f.Name(), ".txt")
+		r, err := profileFiles.Open(path.Join("profiles", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		ranks := make(map[string]int)
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			ranks[s.Text()] = len(ranks)
+		}
+		r.Close()
+		ps[lang] = ranks
+	}
+	return ps
+}
+
+// Languages returns the languages Detect knows, as ISO 639-1 codes
+func Languages() []string {
+	var langs []string
+	for lang := range profiles {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Detect returns the language text is most likely in, and how much more likely that is than the runner up, between
+// 0 and 1. It returns "" when text is too short to tell.
+func Detect(text string) (lang string, confidence float64) {
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < minLetters {
+		return "", 0
+	}
+
+	grams := Profile(text, ProfileSize)
+	best, second := -1, -1
+	for l, ranks := range profiles {
+		d := distance(grams, ranks)
+		switch {
+		case best < 0 || d < best || (d == best && l < lang):
+			second = best
+			best, lang = d, l
+		case second < 0 || d < second:
+			second = d
+		}
+	}
+	if second <= 0 {
+		return lang, 1
+	}
+	return lang, float64(second-best) / float64(second)
+}
+
+// distance is the out-of-place measure: how far every n-gram of the text is from its rank in a profile, n-grams the
+// profile does not have are as far as can be
+func distance(grams []string, ranks map[string]int) int {
+	d := 0
+	for i, g := range grams {
+		r, ok := ranks[g]
+		if !ok {
+			d += ProfileSize
+			continue
+		}
+		if r > i {
+			d += r - i
+		} else {
+			d += i - r
+		}
+	}
+	return d
+}
+
+// Profile returns the size most frequent n-grams of one to three letters in text, most frequent first. Words are
+// padded with an underscore, so n-grams at the start and end of words are told apart.
+func Profile(text string, size int) []string {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		runes := []rune("_" + word + "_")
+		for n := 1; n <= 3; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				g := string(runes[i : i+n])
+				if g == "_" {
+					continue
+				}
+				counts[g]++
+			}
+		}
+	}
+
+	grams := make([]string, 0, len(counts))
+	for g := range counts {
+		grams = append(grams, g)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		if counts[grams[i]] != counts[grams[j]] {
+			return counts[grams[i]] > counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+	if len(grams) > size {
+		grams = grams[:size]
+	}
+	return grams
+}
@@ -0,0 +1,38 @@
+package langid
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	// none of these are in the corpus the profiles were made of
+	tests := map[string]string{
+		"en": "The recipe is simple enough. Cut the onions into thin slices and fry them slowly in butter until they turn golden brown, then add the flour and stir for a minute before pouring in the stock. Let the soup simmer for at least half an hour and serve it with toasted bread and plenty of cheese.",
+		"nl": "Het recept is eenvoudig genoeg. Snijd de uien in dunne ringen en bak ze langzaam in boter tot ze goudbruin zijn, voeg dan de bloem toe en roer een minuut voordat je de bouillon erbij schenkt. Laat de soep minstens een half uur zachtjes koken en serveer hem met geroosterd brood en veel kaas.",
+		"de": "Das Rezept ist ganz einfach. Schneiden Sie die Zwiebeln in dünne Scheiben und braten Sie sie langsam in Butter, bis sie goldbraun sind, dann geben Sie das Mehl dazu und rühren eine Minute, bevor Sie die Brühe angießen. Lassen Sie die Suppe mindestens eine halbe Stunde köcheln und servieren Sie sie mit geröstetem Brot und viel Käse.",
+		"fr": "La recette est assez simple. Coupez les oignons en fines lamelles et faites-les revenir doucement dans le beurre jusqu'à ce qu'ils soient bien dorés, puis ajoutez la farine et remuez une minute avant de verser le bouillon. Laissez mijoter la soupe au moins une demi-heure et servez-la avec du pain grillé et beaucoup de fromage.",
+		"es": "La receta es bastante sencilla. Corta las cebollas en rodajas finas y fríelas despacio en mantequilla hasta que estén doradas, después añade la harina y remueve durante un minuto antes de echar el caldo. Deja que la sopa hierva a fuego lento al menos media hora y sírvela con pan tostado y mucho queso.",
+		"it": "La ricetta è abbastanza semplice. Tagliate le cipolle a fettine sottili e fatele soffriggere lentamente nel burro finché non diventano dorate, poi aggiungete la farina e mescolate per un minuto prima di versare il brodo. Lasciate cuocere la zuppa a fuoco basso per almeno mezz'ora e servitela con pane tostato e molto formaggio.",
+		"pt": "A receita é bastante simples. Corte as cebolas em fatias finas e frite-as devagar em manteiga até ficarem douradas, depois junte a farinha e mexa durante um minuto antes de deitar o caldo. Deixe a sopa cozer em lume brando pelo menos meia hora e sirva-a com pão torrado e muito queijo.",
+		"sv": "Receptet är ganska enkelt. Skär löken i tunna skivor och stek den långsamt i smör tills den blir gyllenbrun, tillsätt sedan mjölet och rör om en minut innan du häller i buljongen. Låt soppan sjuda i minst en halvtimme och servera den med rostat bröd och mycket ost.",
+		"da": "Opskriften er ret enkel. Skær løgene i tynde skiver og steg dem langsomt i smør, indtil de bliver gyldenbrune, og tilsæt derefter melet og rør i et minut, før du hælder bouillonen i. Lad suppen simre i mindst en halv time, og server den med ristet brød og masser af ost.",
+		"no": "Oppskriften er ganske enkel. Skjær løken i tynne skiver og stek den sakte i smør til den blir gyllenbrun, tilsett så melet og rør i et minutt før du heller i kraften. La suppen småkoke i minst en halvtime, og server den med ristet brød og masse ost.",
+		"fi": "Resepti on melko yksinkertainen. Leikkaa sipulit ohuiksi viipaleiksi ja paista niitä hitaasti voissa, kunnes ne ovat kullanruskeita, lisää sitten jauhot ja sekoita minuutin ajan ennen kuin kaadat liemen joukkoon. Anna keiton hautua vähintään puoli tuntia ja tarjoa se paahdetun leivän ja runsaan juuston kanssa.",
+		"pl": "Przepis jest dość prosty. Pokrój cebulę w cienkie plasterki i smaż ją powoli na maśle, aż stanie się złocista, potem dodaj mąkę i mieszaj przez minutę, zanim wlejesz bulion. Gotuj zupę na małym ogniu przez co najmniej pół godziny i podawaj ją z grzankami i dużą ilością sera.",
+	}
+	for want, text := range tests {
+		t.Run(want, func(t *testing.T) {
+			got, confidence := Detect(text)
+			if got != want {
+				t.Errorf("Detect() = %s (%.2f), want %s", got, confidence, want)
+			}
+			if confidence <= 0 || confidence > 1 {
+				t.Errorf("Detect() confidence = %f, want it between 0 and 1", confidence)
+			}
+		})
+	}
+
+	for _, short := range []string{"", "De kat", "1234 5678 ... !!!"} {
+		if got, _ := Detect(short); got != "" {
+			t.Errorf("Detect(%q) = %s, want nothing", short, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package booksing
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gnur/booksing/langid"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// The sources of the language of a book
+const (
+	// LanguageDeclared is a language that came with the book
+	LanguageDeclared = "declared"
+	// LanguageDetected is a language that was told from the text of the book
+	LanguageDetected = "detected"
+)
+
+const (
+	// detectFill is the confidence a detected language needs to be used for a book without one
+	detectFill = 0.02
+	// detectCorrect is the confidence a detected language needs to replace the language a book declares, close
+	// languages like Danish and Norwegian stay below it
+	detectCorrect = 0.1
+)
+
+// iso6391 are all languages with a two letter code
+var iso6391 = strings.Fields(`aa ab ae af ak am an ar as av ay az ba be bg bi bm bn bo br bs ca ce ch co cr cs cu cv cy
+	da de dv dz ee el en eo es et eu fa ff fi fj fo fr fy ga gd gl gn gu gv ha he hi ho hr ht hu hy hz ia id ie ig ii ik
+	io is it iu ja jv ka kg ki kj kk kl km kn ko kr ks ku kv kw ky la lb lg li ln lo lt lu lv mg mh mi mk ml mn mr ms mt
+	my na nb nd ne ng nl nn no nr nv ny oc oj om or os pa pi pl ps pt qu rm rn ro ru rw sa sc sd se sg si sk sl sm sn so
+	sq sr ss st su sv sw ta te tg th ti tk tl tn to tr ts tt tw ty ug uk ur uz ve vi vo wa wo xh yi yo za zh zu`)
+
+// languageAliases maps what is not a language code to one, codes themselves are left to x/text. Names in English and
+// in the language itself come first, then the names the languages langid knows have for other languages, like frans
+// and französisch.
+var languageAliases = func() map[string]string {
+	aliases := map[string]string{
+		// a region and variants that are used for English, uk is left alone as it is the code for Ukrainian
+		"us":    "en",
+		"en-en": "en",
+		"en_en": "en",
+		// a few Dutch and German names that FixLang always knew
+		"nederland": "nl",
+		"duits":     "de",
+		"deutsche":  "de",
+		"engels":    "en",
+	}
+	namers := []display.Namer{display.English.Languages(), display.Self}
+	for _, lang := range langid.Languages() {
+		if n := display.Languages(language.Make(lang)); n != nil {
+			namers = append(namers, n)
+		}
+	}
+	for _, namer := range namers {
+		for _, code := range iso6391 {
+			name := strings.ToLower(namer.Name(language.Make(code)))
+			if _, ok := aliases[name]; name != "" && !ok {
+				aliases[name] = code
+			}
+		}
+	}
+	return aliases
+}()
+
+// macrolanguages are written as the language they are a variant of, so a library has one Norwegian
+var macrolanguages = map[string]string{
+	"nb": "no",
+	"nn": "no",
+}
+
+// FixLang returns the ISO 639-1 code of a language, given as a code of any part of ISO 639, a tag like pt-BR or en_US,
+// or its English or native name. A language without a two letter code keeps its three letter code, what is not a
+// language becomes empty.
+func FixLang(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return ""
+	}
+	code, ok := languageAliases[s]
+	if !ok {
+		tag, err := language.Parse(strings.ReplaceAll(s, "_", "-"))
+		if err != nil {
+			return ""
+		}
+		// a guessed base, like English for und, is not what the book says
+		base, confidence := tag.Base()
+		if confidence != language.Exact {
+			return ""
+		}
+		code = base.String()
+	}
+	if macro, ok := macrolanguages[code]; ok {
+		return macro
+	}
+	return code
+}
+
+// languageNames are names x/text gets wrong for booksing, it names no after Bokmål that FixLang folds into it
+var languageNames = map[string]string{
+	"no": "Norsk",
+}
+
+// LanguageName returns the name of a language in that language, like Nederlands for nl, so readers find their own
+// language whatever language the rest of the page is in. A code x/text has no name for is returned as it is.
+func LanguageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	tag, err := language.Parse(code)
+	if err != nil {
+		return code
+	}
+	name := display.Self.Name(tag)
+	if name == "" {
+		name = display.English.Languages().Name(tag)
+	}
+	if name == "" {
+		return code
+	}
+	// French and Spanish, among others, write the names of languages in lower case
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// flagRegions are the countries whose flag is shown for a language where that is not the country with the most
+// speakers, English and Portuguese would otherwise get the flags of the US and Brazil. Latin gets no flag rather than
+// that of Vatican City.
+var flagRegions = map[string]string{
+	"en": "GB",
+	"la": "",
+	"pt": "PT",
+}
+
+// LanguageFlag returns the flag emoji of the country a language is from, or "" for a language that is not tied to a
+// country, like Esperanto or Latin.
+func LanguageFlag(code string) string {
+	region, ok := flagRegions[code]
+	if !ok {
+		tag, err := language.Parse(code)
+		if err != nil {
+			return ""
+		}
+		r, confidence := tag.Region()
+		if confidence == language.No || !r.IsCountry() {
+			return ""
+		}
+		region = r.String()
+	}
+	// a flag is the two letters of the country as regional indicator symbols
+	var flag strings.Builder
+	for _, c := range region {
+		flag.WriteRune(c - 'A' + 0x1F1E6)
+	}
+	return flag.String()
+}
+
+// detectLanguage tells the language of b from a sample of its text. It is used when b declares no language, or when it
+// declares one that langid knows and the sample is clearly in another.
+func (b *Book) detectLanguage(sample string) {
+	if b.Language != "" {
+		b.LanguageSource = LanguageDeclared
+	}
+
+	lang, confidence := langid.Detect(sample)
+	if lang == "" || lang == b.Language {
+		return
+	}
+	if b.Language == "" && confidence >= detectFill {
+		b.Language, b.LanguageSource = lang, LanguageDetected
+		return
+	}
+	if confidence >= detectCorrect && detectable(b.Language) {
+		b.Language, b.LanguageSource = lang, LanguageDetected
+	}
+}
+
+func detectable(lang string) bool {
+	for _, l := range langid.Languages() {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
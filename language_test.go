@@ -0,0 +1,104 @@
+package booksing
+
+import "testing"
+
+func TestFixLang(t *testing.T) {
+	for in, want := range map[string]string{
+		"nl":         "nl",
+		"NL-nl":      "nl",
+		"nl_NL":      "nl",
+		"dut":        "nl",
+		"nld":        "nl",
+		"Dutch":      "nl",
+		"Nederlands": "nl",
+		"fre":        "fr",
+		"fra":        "fr",
+		"fr-FR":      "fr",
+		"français":   "fr",
+		"ger":        "de",
+		"Deutsch":    "de",
+		"duits":      "de",
+		"frans":      "fr",
+		"anglais":    "en",
+		"Englisch":   "en",
+		"spaans":     "es",
+		"en-US":      "en",
+		"us":         "en",
+		"uk":         "uk",
+		"en-en":      "en",
+		"EN_en":      "en",
+		"Ukrainian":  "uk",
+		"pt-BR":      "pt",
+		"nb":         "no",
+		"nob":        "no",
+		"nn-NO":      "no",
+		"zh-Hant-TW": "zh",
+		"haw":        "haw",
+		"und":        "",
+		"":           "",
+		"klingonese": "",
+	} {
+		if got := FixLang(in); got != want {
+			t.Errorf("FixLang(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLanguageName(t *testing.T) {
+	for code, want := range map[string]string{
+		"nl":  "Nederlands",
+		"fr":  "Français",
+		"en":  "English",
+		"no":  "Norsk",
+		"haw": "ʻŌlelo Hawaiʻi",
+		"xx":  "xx",
+		"":    "",
+	} {
+		if got := LanguageName(code); got != want {
+			t.Errorf("LanguageName(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestLanguageFlag(t *testing.T) {
+	for code, want := range map[string]string{
+		"nl": "🇳🇱",
+		"en": "🇬🇧",
+		"pt": "🇵🇹",
+		"sv": "🇸🇪",
+		"la": "",
+		"eo": "",
+		"":   "",
+	} {
+		if got := LanguageFlag(code); got != want {
+			t.Errorf("LanguageFlag(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	dutch := "Het dorp lag aan het einde van een lange weg die tussen de heuvels en de rivier door slingerde. De meeste mensen die er woonden waren geboren in dezelfde kamers waar hun ouders en grootouders waren geboren."
+	tests := []struct {
+		name     string
+		language string
+		sample   string
+		want     string
+		source   string
+	}{
+		{name: "declared and right", language: "nl", sample: dutch, want: "nl", source: LanguageDeclared},
+		{name: "missing", sample: dutch, want: "nl", source: LanguageDetected},
+		{name: "declared and wrong", language: "en", sample: dutch, want: "nl", source: LanguageDetected},
+		{name: "declared and unknown to langid", language: "af", sample: dutch, want: "af", source: LanguageDeclared},
+		{name: "too little text", language: "en", sample: "Hoofdstuk een", want: "en", source: LanguageDeclared},
+		{name: "nothing at all", want: "", source: ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := Book{Language: tc.language}
+			b.detectLanguage(tc.sample)
+			if b.Language != tc.want || b.LanguageSource != tc.source {
+				t.Errorf("detectLanguage() = %q %s, want %q %s", b.Language, b.LanguageSource, tc.want, tc.source)
+			}
+		})
+	}
+}
@@ -19,10 +19,26 @@ var alphaNumeric = regexp.MustCompile(`[^a-z0-9]+`)
 
 //var year = regexp.MustCompile(`(19[0-9]{2})|(20[0-9]{2})`)
 
+// HashVersion is the version of the algorithm behind HashBook, books hashed with an older version are updated by a rehash
+const HashVersion = 2
+
+// HashBook returns the key of a book, books with the same author and title but a different edition or file share it
 func HashBook(author, title string) string {
+	return HashBookVersion(HashVersion, author, title)
+}
+
+// genericSubtitle matches subtitles that only tell what kind of book it is, like ": a thriller"
+var genericSubtitle = regexp.MustCompile(`\s*[:-]\s*(a |een )?(novel|novella|roman|thriller|mystery|memoir)\s*$`)
+
+// HashBookVersion returns the key of a book as the given version of HashBook computed it.
+// Version 2 also folds letters without a decomposed form, like ø and ß, and drops generic subtitles.
+func HashBookVersion(version int, author, title string) string {
 	author = strings.ToLower(author)
 	author = strings.Replace(author, "-", " ", -1)
 	title = strings.ToLower(title)
+	if version >= 2 {
+		title = genericSubtitle.ReplaceAllString(title, "")
+	}
 
 	authorParts := strings.Split(author, " ")
 	lastName := authorParts[len(authorParts)-1]
@@ -37,7 +53,11 @@ func HashBook(author, title string) string {
 	//concatenate to half further actions
 	title = lastName + " " + title
 
-	title = removeAccents(title)
+	if version >= 2 {
+		title = NormalizeSearch(title)
+	} else {
+		title = removeAccents(title)
+	}
 
 	//make sure no whitespace is on either end
 	title = strings.TrimSpace(title)
@@ -68,3 +88,41 @@ func removeAccents(in string) string {
 	}
 	return s
 }
+
+// foldLetters replaces letters that have no decomposed form, removeAccents leaves those alone
+var foldLetters = strings.NewReplacer(
+	"ø", "o", "Ø", "O",
+	"æ", "ae", "Æ", "Ae",
+	"œ", "oe", "Œ", "Oe",
+	"ß", "ss",
+	"ł", "l", "Ł", "L",
+	"đ", "d", "Đ", "D",
+	"ð", "d", "Ð", "D",
+	"þ", "th", "Þ", "Th",
+	"ı", "i",
+)
+
+// NormalizeSearch strips accents from s and folds special letters, so Zafón becomes Zafon and Bjørk becomes Bjork.
+// It is applied to both the indexed text and the search queries so they always agree.
+func NormalizeSearch(s string) string {
+	return foldLetters.Replace(removeAccents(s))
+}
+
+// CompletionKeys returns the normalized and lowercased value starting at each of its words,
+// a prefix of any of these keys completes to value.
+func CompletionKeys(value string) []string {
+	normalized := strings.ToLower(NormalizeSearch(value))
+	var keys []string
+	seen := make(map[string]bool)
+	for i, r := range normalized {
+		if r == ' ' || i > 0 && normalized[i-1] != ' ' {
+			continue
+		}
+		key := strings.TrimSpace(normalized[i:])
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,70 @@
+package booksing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSearch(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Carlos Ruiz Zafón", want: "Carlos Ruiz Zafon"},
+		{in: "Bjørk", want: "Bjork"},
+		{in: "Łódź", want: "Lodz"},
+		{in: "Straße", want: "Strasse"},
+		{in: "Æsir œuvre", want: "Aesir oeuvre"},
+		{in: "Ærø", want: "Aero"},
+		{in: "plain text", want: "plain text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeSearch(tt.in); got != tt.want {
+				t.Errorf("NormalizeSearch(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletionKeys(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "Tolkien", want: []string{"tolkien"}},
+		{value: "J.R.R. Tolkien", want: []string{"j.r.r. tolkien", "tolkien"}},
+		{value: "Samuel  Bjørk ", want: []string{"samuel  bjork", "bjork"}},
+		{value: "De Cock en de wurger", want: []string{"de cock en de wurger", "cock en de wurger", "en de wurger", "de wurger", "wurger"}},
+		{value: "  ", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := CompletionKeys(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompletionKeys(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashBookVersion(t *testing.T) {
+	tests := []struct {
+		author string
+		title  string
+		want   [2]string
+	}{
+		{author: "Frank Herbert", title: "Dune", want: [2]string{"herbertdune", "herbertdune"}},
+		{author: "Samuel Bjørk", title: "De Jongen In De Sneeuw", want: [2]string{"bjrkdejongenindesneeuw", "bjorkdejongenindesneeuw"}},
+		{author: "Samuel Bjork", title: "De jongen in de sneeuw: een thriller", want: [2]string{"bjorkdejongenindesneeuweenthriller", "bjorkdejongenindesneeuw"}},
+		{author: "Carlos Ruiz Zafón", title: "La Sombra Del Viento", want: [2]string{"zafonlasombradelviento", "zafonlasombradelviento"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := HashBookVersion(i+1, tt.author, tt.title); got != want {
+					t.Errorf("HashBookVersion(%d, %q, %q) = %q, want %q", i+1, tt.author, tt.title, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GoogleBooks looks up books with the Google Books api, it works without a key but with a far lower quota
+type GoogleBooks struct {
+	// BaseURL is https://www.googleapis.com/books/v1, tests point it to a stub
+	BaseURL string
+	client  *http.Client
+	cache   Cache
+	key     string
+}
+
+// NewGoogleBooks returns a provider for Google Books that does its requests with client and keeps the responses in cache,
+// key is the api key and can be empty
+func NewGoogleBooks(client *http.Client, cache Cache, key string) *GoogleBooks {
+	return &GoogleBooks{
+		BaseURL: "https://www.googleapis.com/books/v1",
+		client:  client,
+		cache:   cache,
+		key:     key,
+	}
+}
+
+func (g *GoogleBooks) Name() string {
+	return "googlebooks"
+}
+
+type gbVolumes struct {
+	Items []struct {
+		VolumeInfo struct {
+			Title               string   `json:"title"`
+			Authors             []string `json:"authors"`
+			Publisher           string   `json:"publisher"`
+			PublishedDate       string   `json:"publishedDate"`
+			Description         string   `json:"description"`
+			Language            string   `json:"language"`
+			IndustryIdentifiers []struct {
+				Type       string `json:"type"`
+				Identifier string `json:"identifier"`
+			} `json:"industryIdentifiers"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func (g *GoogleBooks) ByISBN(ctx context.Context, isbn string) (*Metadata, error) {
+	isbn = strings.ReplaceAll(strings.TrimPrefix(isbn, "urn:isbn:"), "-", "")
+	return g.volume(ctx, "isbn:"+isbn)
+}
+
+func (g *GoogleBooks) Search(ctx context.Context, title, author string) (*Metadata, error) {
+	q := fmt.Sprintf("intitle:%q", title)
+	if author != "" {
+		q += fmt.Sprintf(" inauthor:%q", author)
+	}
+	return g.volume(ctx, q)
+}
+
+// volume returns the first volume that matches q
+func (g *GoogleBooks) volume(ctx context.Context, q string) (*Metadata, error) {
+	params := url.Values{
+		"q":          {q},
+		"maxResults": {"1"},
+		"printType":  {"books"},
+	}
+	if g.key != "" {
+		params.Set("key", g.key)
+	}
+	var res gbVolumes
+	err := getJSON(ctx, g.client, g.cache, g.BaseURL+"/volumes?"+params.Encode(), &res)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	v := res.Items[0].VolumeInfo
+	m := &Metadata{
+		Title:       v.Title,
+		Description: v.Description,
+		Publisher:   v.Publisher,
+		PublishDate: parseDate(v.PublishedDate),
+		Language:    v.Language,
+	}
+	if len(v.Authors) > 0 {
+		m.Author = v.Authors[0]
+	}
+	var isbns []string
+	for _, id := range v.IndustryIdentifiers {
+		if strings.HasPrefix(id.Type, "ISBN") {
+			isbns = append(isbns, id.Identifier)
+		}
+	}
+	m.ISBN = isbn13(isbns)
+	return m, nil
+}
@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGoogleBooks(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/volumes" || r.URL.Query().Get("key") != "secret" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		q := r.URL.Query().Get("q")
+		queries = append(queries, q)
+		switch q {
+		case "isbn:9789022599467", `intitle:"De jongen in de sneeuw" inauthor:"Samuel Bjørk"`:
+			w.Write([]byte(`{"totalItems": 1, "items": [{"volumeInfo": {"title": "De jongen in de sneeuw", "authors": ["Samuel Bjørk"], "publisher": "Boekerij", "publishedDate": "2016-05", "description": "<p>Een <b>thriller</b> uit Noorwegen</p>", "language": "nl", "industryIdentifiers": [{"type": "ISBN_10", "identifier": "9022599464"}, {"type": "ISBN_13", "identifier": "9789022599467"}]}}]}`))
+		default:
+			w.Write([]byte(`{"totalItems": 0}`))
+		}
+	}))
+	defer srv.Close()
+
+	gb := NewGoogleBooks(srv.Client(), NewMemoryCache(time.Hour), "secret")
+	gb.BaseURL = srv.URL
+
+	m, err := gb.ByISBN(context.Background(), "978-90-225-9946-7")
+	if err != nil {
+		t.Fatalf("ByISBN() error = %v", err)
+	}
+	want := Metadata{
+		Title:       "De jongen in de sneeuw",
+		Author:      "Samuel Bjørk",
+		Description: "<p>Een <b>thriller</b> uit Noorwegen</p>",
+		ISBN:        "9789022599467",
+		Publisher:   "Boekerij",
+		PublishDate: time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC),
+		Language:    "nl",
+	}
+	if *m != want {
+		t.Errorf("ByISBN() = %+v, want %+v", *m, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		m, err = gb.Search(context.Background(), "De jongen in de sneeuw", "Samuel Bjørk")
+		if err != nil || m.ISBN != "9789022599467" {
+			t.Errorf("Search() = %+v, %v, want the book", m, err)
+		}
+	}
+	if _, err := gb.Search(context.Background(), "Unknown book", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Search() of an unknown book error = %v, want %v", err, ErrNotFound)
+	}
+	if len(queries) != 3 {
+		t.Errorf("did %d requests (%q), want 3 and the repeated search from the cache", len(queries), queries)
+	}
+}
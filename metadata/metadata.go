@@ -0,0 +1,284 @@
+// Package metadata looks up books in external catalogs, like Open Library and Google Books, to complete the
+// metadata that came with an epub.
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gnur/booksing"
+	"github.com/kennygrant/sanitize"
+)
+
+// ErrNotFound is returned when a catalog does not know a book
+var ErrNotFound = errors.New("book not found in catalog")
+
+// userAgent identifies booksing to the catalogs, Open Library asks for that
+const userAgent = "booksing (https://github.com/gnur/booksing)"
+
+// Metadata is what a catalog knows about a book, fields it does not know are empty
+type Metadata struct {
+	Title       string
+	Author      string
+	Description string
+	ISBN        string
+	Publisher   string
+	Series      string
+	SeriesIndex float64
+	PublishDate time.Time
+	// Language is in whatever form the catalog uses, like en or eng
+	Language string
+	// Source is the name of the provider that found the book
+	Source string
+}
+
+// Provider looks up books in a single catalog
+type Provider interface {
+	Name() string
+	// ByISBN returns the book with isbn, or ErrNotFound
+	ByISBN(ctx context.Context, isbn string) (*Metadata, error)
+	// Search returns the best match for a title and author, author can be empty. It returns ErrNotFound when nothing matches.
+	Search(ctx context.Context, title, author string) (*Metadata, error)
+}
+
+// Lookup asks every provider for b, by its ISBN first and by title and author after that. Fields the first provider
+// does not know are taken from the next providers. It only returns an error when no provider found the book.
+func Lookup(ctx context.Context, providers []Provider, b booksing.Book) (*Metadata, error) {
+	var found *Metadata
+	var lookupErr error
+	for _, p := range providers {
+		m, err := lookup(ctx, p, b)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) && lookupErr == nil {
+				lookupErr = fmt.Errorf("%s: %w", p.Name(), err)
+			}
+			continue
+		}
+		m.Source = p.Name()
+		if found == nil {
+			found = m
+			continue
+		}
+		found.complete(m)
+	}
+	if found != nil {
+		return found, nil
+	}
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return nil, ErrNotFound
+}
+
+func lookup(ctx context.Context, p Provider, b booksing.Book) (*Metadata, error) {
+	if !b.Missing("isbn") {
+		m, err := p.ByISBN(ctx, b.ISBN)
+		if !errors.Is(err, ErrNotFound) {
+			return m, err
+		}
+	}
+	if b.Missing("title") {
+		return nil, ErrNotFound
+	}
+	author := b.Author
+	if b.Missing("author") {
+		author = ""
+	}
+	return p.Search(ctx, b.Title, author)
+}
+
+// complete fills the fields m does not know with those of other
+func (m *Metadata) complete(other *Metadata) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&m.Title, other.Title},
+		{&m.Author, other.Author},
+		{&m.Description, other.Description},
+		{&m.ISBN, other.ISBN},
+		{&m.Publisher, other.Publisher},
+		{&m.Series, other.Series},
+		{&m.Language, other.Language},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+	if m.SeriesIndex == 0 {
+		m.SeriesIndex = other.SeriesIndex
+	}
+	if m.PublishDate.IsZero() {
+		m.PublishDate = other.PublishDate
+	}
+	if !strings.Contains(m.Source, other.Source) {
+		m.Source += ", " + other.Source
+	}
+}
+
+// Diff compares b with what a catalog knows about it. With fill the fields b is missing are set on b directly and
+// returned, all other differences are returned as proposals for an admin to approve. Without fill everything is a proposal.
+func Diff(b *booksing.Book, m *Metadata, fill bool) (filled []string, proposals []booksing.Proposal) {
+	// the catalog is cleaned up the same way as an imported epub, so only real differences remain
+	lang := booksing.FixLang(m.Language)
+	found := booksing.Book{
+		Title:       booksing.TitleCase(booksing.Fix(m.Title, false, false), lang),
+		Author:      booksing.NameCase(booksing.Fix(m.Author, false, true), lang),
+		Description: strings.TrimSpace(sanitize.HTML(m.Description)),
+		ISBN:        m.ISBN,
+		Publisher:   m.Publisher,
+		Series:      m.Series,
+		SeriesIndex: m.SeriesIndex,
+		PublishDate: m.PublishDate,
+		Language:    lang,
+	}
+	for _, field := range booksing.MetadataFields {
+		if found.Missing(field) {
+			continue
+		}
+		current, proposed := b.Field(field), found.Field(field)
+		if strings.EqualFold(booksing.NormalizeSearch(current), booksing.NormalizeSearch(proposed)) {
+			continue
+		}
+		if fill && b.Missing(field) && b.SetField(field, proposed) == nil {
+			filled = append(filled, field)
+			continue
+		}
+		proposals = append(proposals, booksing.Proposal{
+			Book:     b.ID,
+			Field:    field,
+			Current:  current,
+			Proposed: proposed,
+			Source:   m.Source,
+		})
+	}
+	return filled, proposals
+}
+
+// Cache keeps the responses of catalogs, so the same book is not requested over and over
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, body []byte)
+}
+
+// MemoryCache is a Cache that keeps responses in memory for a while
+type MemoryCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns an empty cache that keeps responses for ttl
+func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Get returns the response stored for key, unless it expired
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.body, true
+}
+
+// Set stores the response for key, expired responses are dropped at the same time
+func (c *MemoryCache) Set(key string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{body: body, expires: now.Add(c.ttl)}
+}
+
+// getJSON requests url and decodes the json response into v. Responses, including not found ones, come from the cache when
+// possible, cache can be nil.
+func getJSON(ctx context.Context, client *http.Client, cache Cache, url string, v interface{}) error {
+	var body []byte
+	ok := false
+	if cache != nil {
+		body, ok = cache.Get(url)
+	}
+	if !ok {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			body, err = io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+			if err != nil {
+				return err
+			}
+		case http.StatusNotFound:
+			// an empty body is how a cached not found is remembered
+			body = []byte{}
+		default:
+			return fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		if cache != nil {
+			cache.Set(url, body)
+		}
+	}
+
+	if len(body) == 0 {
+		return ErrNotFound
+	}
+	return json.Unmarshal(body, v)
+}
+
+// parseDate parses the dates catalogs use, from a full date to only a year
+func parseDate(s string) time.Time {
+	for _, layout := range []string{"2006-01-02", "2006-01", "January 2, 2006", "Jan 2, 2006", "January 2006", "2006"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// isbn13 returns the first 13 digit ISBN of isbns, or the first one when there is none
+func isbn13(isbns []string) string {
+	for _, isbn := range isbns {
+		if len(isbn) == 13 {
+			return isbn
+		}
+	}
+	if len(isbns) > 0 {
+		return isbns[0]
+	}
+	return ""
+}
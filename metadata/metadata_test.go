@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gnur/booksing"
+)
+
+// fakeProvider knows the books in byISBN and byTitle and records what it was asked
+type fakeProvider struct {
+	name    string
+	byISBN  map[string]Metadata
+	byTitle map[string]Metadata
+	err     error
+	asked   []string
+}
+
+func (f *fakeProvider) Name() string {
+	return f.name
+}
+
+func (f *fakeProvider) ByISBN(ctx context.Context, isbn string) (*Metadata, error) {
+	f.asked = append(f.asked, "isbn:"+isbn)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if m, ok := f.byISBN[isbn]; ok {
+		return &m, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (f *fakeProvider) Search(ctx context.Context, title, author string) (*Metadata, error) {
+	f.asked = append(f.asked, "search:"+title+"/"+author)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if m, ok := f.byTitle[title]; ok {
+		return &m, nil
+	}
+	return nil, ErrNotFound
+}
+
+func TestLookup(t *testing.T) {
+	first := &fakeProvider{name: "first", byTitle: map[string]Metadata{
+		"Vervloekt": {Title: "Vervloekt", Author: "Josephine Angelini", Language: "dut"},
+	}}
+	second := &fakeProvider{name: "second", byISBN: map[string]Metadata{
+		"9789000000000": {Title: "Vervloekt (Goddelijk #1)", Description: "Helen is anders", ISBN: "9789000000000", Language: "nl"},
+	}}
+	broken := &fakeProvider{name: "broken", err: errors.New("connection refused")}
+
+	b := booksing.Book{Title: "Vervloekt", Author: "Unknown", ISBN: "9789000000000"}
+	m, err := Lookup(context.Background(), []Provider{broken, first, second}, b)
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	want := Metadata{Title: "Vervloekt", Author: "Josephine Angelini", Description: "Helen is anders", ISBN: "9789000000000", Language: "dut", Source: "first, second"}
+	if *m != want {
+		t.Errorf("Lookup() = %+v, want %+v", *m, want)
+	}
+	// the isbn is tried first, an unknown author is left out of the search
+	if want := []string{"isbn:9789000000000", "search:Vervloekt/"}; !reflect.DeepEqual(first.asked, want) {
+		t.Errorf("Lookup() asked %v, want %v", first.asked, want)
+	}
+
+	if _, err := Lookup(context.Background(), []Provider{first}, booksing.Book{Title: "Unknown", Author: "Unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup() of a book without a title error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := Lookup(context.Background(), []Provider{broken}, b); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup() with only a failing provider error = %v, want its error", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	b := booksing.Book{Title: "De Jongen In De Sneeuw", Author: "Unknown", Language: "nl", Publisher: "Boekerij Bv"}
+	b.ID = 5
+	m := &Metadata{
+		Title:       "De jongen in de sneeuw",
+		Author:      "Bjørk, Samuel",
+		Description: "<p>Een thriller</p>",
+		Publisher:   "Boekerij",
+		PublishDate: time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC),
+		Language:    "dut",
+		Source:      "googlebooks",
+	}
+
+	filled, proposals := Diff(&b, m, true)
+	if want := []string{"author", "description", "publish_date"}; !reflect.DeepEqual(filled, want) {
+		t.Errorf("Diff() filled %v, want %v", filled, want)
+	}
+	if b.Author != "Samuel Bjørk" || b.Description != "Een thriller" || b.Hash != booksing.HashBook("Samuel Bjørk", "De Jongen In De Sneeuw") {
+		t.Errorf("Diff() left %+v, want the missing fields filled", b)
+	}
+	want := []booksing.Proposal{{Book: 5, Field: "publisher", Current: "Boekerij Bv", Proposed: "Boekerij", Source: "googlebooks"}}
+	if !reflect.DeepEqual(proposals, want) {
+		t.Errorf("Diff() proposed %+v, want %+v", proposals, want)
+	}
+
+	b = booksing.Book{Title: "Unknown", Author: "Unknown"}
+	filled, proposals = Diff(&b, m, false)
+	if len(filled) != 0 || len(proposals) != 6 || b.Title != "Unknown" {
+		t.Errorf("Diff() without fill = %v, %+v, want only proposals", filled, proposals)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(time.Hour)
+	c.Set("a", []byte("1"))
+	if body, ok := c.Get("a"); !ok || string(body) != "1" {
+		t.Errorf("Get(a) = %q, %v, want 1", body, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Get(b) found a response that was never stored")
+	}
+
+	expired := NewMemoryCache(-time.Second)
+	expired.Set("a", []byte("1"))
+	if _, ok := expired.Get("a"); ok {
+		t.Errorf("Get(a) returned an expired response")
+	}
+}
@@ -0,0 +1,184 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenLibrary looks up books in the catalog of openlibrary.org, it needs no key
+type OpenLibrary struct {
+	// BaseURL is https://openlibrary.org, tests point it to a stub
+	BaseURL string
+	client  *http.Client
+	cache   Cache
+}
+
+// NewOpenLibrary returns a provider for Open Library that does its requests with client and keeps the responses in cache
+func NewOpenLibrary(client *http.Client, cache Cache) *OpenLibrary {
+	return &OpenLibrary{
+		BaseURL: "https://openlibrary.org",
+		client:  client,
+		cache:   cache,
+	}
+}
+
+func (o *OpenLibrary) Name() string {
+	return "openlibrary"
+}
+
+// olSearch is a response of the search api, only with the fields that are requested
+type olSearch struct {
+	Docs []struct {
+		Key              string   `json:"key"`
+		Title            string   `json:"title"`
+		AuthorName       []string `json:"author_name"`
+		ISBN             []string `json:"isbn"`
+		Publisher        []string `json:"publisher"`
+		FirstPublishYear int      `json:"first_publish_year"`
+		Language         []string `json:"language"`
+	} `json:"docs"`
+}
+
+const olFields = "key,title,author_name,isbn,publisher,first_publish_year,language"
+
+// olText is a description, which is either a plain string or an object with the text as value
+type olText string
+
+func (t *olText) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = olText(s)
+		return nil
+	}
+	var v struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = olText(v.Value)
+	return nil
+}
+
+type olWork struct {
+	Description olText `json:"description"`
+}
+
+type olEdition struct {
+	Publishers  []string `json:"publishers"`
+	PublishDate string   `json:"publish_date"`
+	Series      []string `json:"series"`
+	Languages   []struct {
+		Key string `json:"key"`
+	} `json:"languages"`
+}
+
+// ByISBN combines the search result for isbn with its edition, which knows the exact publisher, date and series
+func (o *OpenLibrary) ByISBN(ctx context.Context, isbn string) (*Metadata, error) {
+	isbn = strings.ReplaceAll(strings.TrimPrefix(isbn, "urn:isbn:"), "-", "")
+	m, err := o.search(ctx, url.Values{"isbn": {isbn}})
+	if err != nil {
+		return nil, err
+	}
+	m.ISBN = isbn
+
+	var e olEdition
+	err = getJSON(ctx, o.client, o.cache, o.BaseURL+"/isbn/"+url.PathEscape(isbn)+".json", &e)
+	if errors.Is(err, ErrNotFound) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Publishers) > 0 {
+		m.Publisher = e.Publishers[0]
+	}
+	if t := parseDate(e.PublishDate); !t.IsZero() {
+		m.PublishDate = t
+	}
+	if len(e.Languages) == 1 {
+		m.Language = path.Base(e.Languages[0].Key)
+	}
+	for _, s := range e.Series {
+		if name, index := parseSeries(s); index > 0 {
+			m.Series, m.SeriesIndex = name, index
+			break
+		}
+	}
+	return m, nil
+}
+
+func (o *OpenLibrary) Search(ctx context.Context, title, author string) (*Metadata, error) {
+	q := url.Values{"title": {title}}
+	if author != "" {
+		q.Set("author", author)
+	}
+	return o.search(ctx, q)
+}
+
+// search returns the first search result for q with the description of its work
+func (o *OpenLibrary) search(ctx context.Context, q url.Values) (*Metadata, error) {
+	q.Set("fields", olFields)
+	q.Set("limit", "1")
+	var res olSearch
+	err := getJSON(ctx, o.client, o.cache, o.BaseURL+"/search.json?"+q.Encode(), &res)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Docs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	doc := res.Docs[0]
+	m := &Metadata{
+		Title: doc.Title,
+		ISBN:  isbn13(doc.ISBN),
+	}
+	if len(doc.AuthorName) > 0 {
+		m.Author = doc.AuthorName[0]
+	}
+	if len(doc.Publisher) > 0 {
+		m.Publisher = doc.Publisher[0]
+	}
+	if doc.FirstPublishYear > 0 {
+		m.PublishDate = time.Date(doc.FirstPublishYear, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	// a work with editions in several languages says nothing about the language of this one
+	if len(doc.Language) == 1 {
+		m.Language = doc.Language[0]
+	}
+
+	if strings.HasPrefix(doc.Key, "/works/") {
+		var w olWork
+		err = getJSON(ctx, o.client, o.cache, o.BaseURL+doc.Key+".json", &w)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		m.Description = string(w.Description)
+	}
+	return m, nil
+}
+
+// olSeries matches the way editions name their series, like "Discworld #3", "Middle-earth ; 1" or "(Narnia, 2)"
+var olSeries = regexp.MustCompile(`(?i)^\(?\s*(.+?)[\s,;:#-]*(?:no\.|vol\.|book)?\s*#?\s*(\d+(?:\.\d+)?)\s*\)?$`)
+
+// parseSeries returns the name and position of a series, the position is 0 for series without one
+func parseSeries(s string) (string, float64) {
+	m := olSeries.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return strings.TrimSpace(s), 0
+	}
+	index, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return strings.TrimSpace(s), 0
+	}
+	return strings.TrimSpace(m[1]), index
+}
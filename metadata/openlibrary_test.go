@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// openLibraryStub serves the responses of openlibrary.org for The Hobbit and counts the requests
+func openLibraryStub(t *testing.T, requests *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("request without the booksing user agent: %q", r.Header.Get("User-Agent"))
+		}
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/search.json" && (q.Get("isbn") == "9780261102217" || q.Get("title") == "The Hobbit" && q.Get("author") == "Tolkien"):
+			w.Write([]byte(`{"numFound": 1, "docs": [{"key": "/works/OL262758W", "title": "The Hobbit", "author_name": ["J.R.R. Tolkien"], "isbn": ["0261102214", "9780261102217"], "publisher": ["HarperCollins"], "first_publish_year": 1937, "language": ["eng", "dut"]}]}`))
+		case r.URL.Path == "/search.json":
+			w.Write([]byte(`{"numFound": 0, "docs": []}`))
+		case r.URL.Path == "/isbn/9780261102217.json":
+			w.Write([]byte(`{"publishers": ["Allen & Unwin"], "publish_date": "September 21, 1937", "series": ["Middle-earth ; 1"], "languages": [{"key": "/languages/eng"}]}`))
+		case r.URL.Path == "/works/OL262758W.json":
+			w.Write([]byte(`{"description": {"type": "/type/text", "value": "A hobbit goes on an adventure"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenLibraryByISBN(t *testing.T) {
+	requests := 0
+	srv := openLibraryStub(t, &requests)
+	ol := NewOpenLibrary(srv.Client(), NewMemoryCache(time.Hour))
+	ol.BaseURL = srv.URL
+
+	want := Metadata{
+		Title:       "The Hobbit",
+		Author:      "J.R.R. Tolkien",
+		Description: "A hobbit goes on an adventure",
+		ISBN:        "9780261102217",
+		Publisher:   "Allen & Unwin",
+		Series:      "Middle-earth",
+		SeriesIndex: 1,
+		PublishDate: time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC),
+		Language:    "eng",
+	}
+	for i := 0; i < 2; i++ {
+		m, err := ol.ByISBN(context.Background(), "urn:isbn:978-0-261-10221-7")
+		if err != nil {
+			t.Fatalf("ByISBN() error = %v", err)
+		}
+		if *m != want {
+			t.Errorf("ByISBN() = %+v, want %+v", *m, want)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("ByISBN() twice did %d requests, want 3 and the rest from the cache", requests)
+	}
+}
+
+func TestOpenLibrarySearch(t *testing.T) {
+	requests := 0
+	srv := openLibraryStub(t, &requests)
+	ol := NewOpenLibrary(srv.Client(), nil)
+	ol.BaseURL = srv.URL
+
+	m, err := ol.Search(context.Background(), "The Hobbit", "Tolkien")
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	// the search knows the work, not the edition, so the language and publish date are vague
+	if m.ISBN != "9780261102217" || m.Language != "" || m.PublishDate.Year() != 1937 || m.Publisher != "HarperCollins" || m.Description == "" {
+		t.Errorf("Search() = %+v, want the work without a language", m)
+	}
+
+	if _, err := ol.Search(context.Background(), "Unknown book", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Search() of an unknown book error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := ol.ByISBN(context.Background(), "9789022599467"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ByISBN() of an unknown isbn error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestParseSeries(t *testing.T) {
+	tests := []struct {
+		series string
+		name   string
+		index  float64
+	}{
+		{series: "Middle-earth ; 1", name: "Middle-earth", index: 1},
+		{series: "Discworld #3", name: "Discworld", index: 3},
+		{series: "(The Chronicles of Narnia, 2)", name: "The Chronicles of Narnia", index: 2},
+		{series: "Harry Potter, book 7", name: "Harry Potter", index: 7},
+		{series: "Penguin Classics", name: "Penguin Classics", index: 0},
+	}
+	for _, tt := range tests {
+		name, index := parseSeries(tt.series)
+		if name != tt.name || index != tt.index {
+			t.Errorf("parseSeries(%q) = %q, %v, want %q, %v", tt.series, name, index, tt.name, tt.index)
+		}
+	}
+}
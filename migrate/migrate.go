@@ -0,0 +1,171 @@
+// Package migrate applies the ordered schema migrations of a database backend and records them in the schema_migrations table.
+//
+// Migrations are either sql files named like 0001_initial.sql, embedded in the backend, or Go functions for
+// changes that need more than sql, like backfilling data. A released migration never changes, every schema
+// change is a new migration with the next version. A Go migration that rewrites stored data keeps a copy of the code
+// it was released with next to it, so a later booksing does the same to an old database.
+//
+// Backfills are the exception: Go migrations that only derive data from the books as they are, like the completions,
+// the hashes and works of books and normalized languages. They use the code of the booksing that applies them on purpose and are
+// written so running them again on an up to date database changes nothing. A booksing that derives the data
+// differently adds a new backfill, or a command like rebuild-index, instead of changing an old one.
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a single step from one version of the schema to the next
+type Migration struct {
+	Version int
+	Name    string
+	// SQL is executed as a whole, so it can hold several statements
+	SQL string
+	// Up runs after SQL, when set
+	Up func(tx *gorm.DB) error
+}
+
+// Status is a migration with the moment it was applied, Applied is zero for pending migrations
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+// applied is a row of the schema_migrations table
+type applied struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (applied) TableName() string {
+	return "schema_migrations"
+}
+
+// Load reads the sql migrations in dir of fsys and combines them with the Go migrations in funcs, ordered by version.
+func Load(fsys fs.FS, dir string, funcs ...Migration) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := append([]Migration{}, funcs...)
+	for _, f := range files {
+		version, name, ok := strings.Cut(strings.TrimSuffix(path.Base(f), ".sql"), "_")
+		v, err := strconv.Atoi(version)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s is not named like 0001_name.sql", f)
+		}
+		sql, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: v, Name: name, SQL: string(sql)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d (%s) is out of sequence, expected version %d", m.Version, m.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Statuses returns all migrations with the moment they were applied
+func Statuses(db *gorm.DB, migrations []Migration) ([]Status, error) {
+	var rows []applied
+	if db.Migrator().HasTable(&applied{}) {
+		tx := db.Order("version").Find(&rows)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+	}
+
+	at := make(map[int]time.Time)
+	for _, r := range rows {
+		at[r.Version] = r.AppliedAt
+	}
+
+	var statuses []Status
+	for _, m := range migrations {
+		statuses = append(statuses, Status{Migration: m, Applied: at[m.Version]})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that are not applied yet
+func Pending(db *gorm.DB, migrations []Migration) ([]Migration, error) {
+	statuses, err := Statuses(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range statuses {
+		if s.Applied.IsZero() {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Version returns the highest version that is applied to db, 0 for a database without migrations.
+// This can be higher than the versions a backend knows when the database comes from a newer booksing.
+func Version(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&applied{}) {
+		return 0, nil
+	}
+	var version int
+	tx := db.Model(&applied{}).Select("coalesce(max(version), 0)").Scan(&version)
+	return version, tx.Error
+}
+
+// Apply runs all pending migrations in order, each in its own transaction
+func Apply(db *gorm.DB, migrations []Migration) error {
+	err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name text NOT NULL, applied_at timestamp NOT NULL)").Error
+	if err != nil {
+		return err
+	}
+
+	version, err := Version(db)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("the database has schema version %d, this booksing only knows up to version %d", version, len(migrations))
+	}
+
+	pending, err := Pending(db, migrations)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if m.SQL != "" {
+				if err := tx.Exec(m.SQL).Error; err != nil {
+					return err
+				}
+			}
+			if m.Up != nil {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&applied{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func open(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/test.db"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("opening database failed: %v", err)
+	}
+	return db
+}
+
+var files = fstest.MapFS{
+	"migrations/0001_initial.sql": {Data: []byte("CREATE TABLE books (id integer PRIMARY KEY, title text);\nCREATE INDEX idx_books_title ON books (title);")},
+	"migrations/0003_authors.sql": {Data: []byte("ALTER TABLE books ADD COLUMN author text;")},
+	"migrations/README.md":        {Data: []byte("not a migration")},
+	"other/0002_not_included.sql": {Data: []byte("DROP TABLE books;")},
+}
+
+var backfill = Migration{
+	Version: 2,
+	Name:    "backfill",
+	Up: func(tx *gorm.DB) error {
+		return tx.Exec("INSERT INTO books (title) VALUES ('the hobbit')").Error
+	},
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(files, "migrations", backfill)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.Name)
+	}
+	if len(names) != 3 || names[0] != "initial" || names[1] != "backfill" || names[2] != "authors" {
+		t.Errorf("Load() = %v, want initial, backfill, authors", names)
+	}
+
+	if _, err := Load(files, "migrations"); err == nil {
+		t.Errorf("Load() with a missing version succeeded, want an error")
+	}
+	bad := fstest.MapFS{"m/initial.sql": {Data: []byte("SELECT 1")}}
+	if _, err := Load(bad, "m"); err == nil {
+		t.Errorf("Load() of a badly named file succeeded, want an error")
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := open(t)
+	migrations, err := Load(files, "migrations", backfill)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	pending, err := Pending(db, migrations)
+	if err != nil || len(pending) != 3 {
+		t.Fatalf("Pending() of a new database = %d migrations, %v, want 3", len(pending), err)
+	}
+
+	if err := Apply(db, migrations); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	// applying again is a no-op, the backfill would otherwise insert a second book
+	if err := Apply(db, migrations); err != nil {
+		t.Fatalf("Apply() of an up to date database error = %v", err)
+	}
+
+	var count int64
+	if err := db.Raw("SELECT count(*) FROM books WHERE author IS NULL").Scan(&count).Error; err != nil || count != 1 {
+		t.Errorf("books after migrating = %d, %v, want 1", count, err)
+	}
+
+	statuses, err := Statuses(db, migrations)
+	if err != nil {
+		t.Fatalf("Statuses() error = %v", err)
+	}
+	for _, s := range statuses {
+		if s.Applied.IsZero() {
+			t.Errorf("migration %d is not applied", s.Version)
+		}
+	}
+	if v, err := Version(db); err != nil || v != 3 {
+		t.Errorf("Version() = %d, %v, want 3", v, err)
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	db := open(t)
+	failing := Migration{
+		Version: 2,
+		Name:    "failing",
+		SQL:     "CREATE TABLE authors (id integer PRIMARY KEY);",
+		Up: func(tx *gorm.DB) error {
+			return errors.New("backfill failed")
+		},
+	}
+	migrations, err := Load(files, "migrations", failing)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if err := Apply(db, migrations); err == nil {
+		t.Fatalf("Apply() succeeded, want the error of migration 2")
+	}
+	if v, err := Version(db); err != nil || v != 1 {
+		t.Errorf("Version() after a failed migration = %d, %v, want 1", v, err)
+	}
+	if db.Migrator().HasTable("authors") {
+		t.Errorf("the failed migration was not rolled back")
+	}
+}
+
+func TestApplyNewerDatabase(t *testing.T) {
+	db := open(t)
+	migrations, err := Load(files, "migrations", backfill)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := Apply(db, migrations); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// an older booksing that only knows the first two migrations
+	if err := Apply(db, migrations[:2]); err == nil {
+		t.Errorf("Apply() of a database with a newer schema succeeded, want an error")
+	}
+}
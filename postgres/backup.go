@@ -0,0 +1,11 @@
+package postgres
+
+import "errors"
+
+// errBackup is returned by Backup, postgres has its own tools for that
+var errBackup = errors.New("booksing does not back up a postgres database, use pg_dump instead")
+
+// Backup is not supported for postgres
+func (db *pgDB) Backup(path string) error {
+	return errBackup
+}
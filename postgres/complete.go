@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// completion is a single entry of the prefix index, every value is stored once for each word it contains
+// with Key holding the normalized value from that word onwards, so "tolk" completes "J.R.R. Tolkien".
+type completion struct {
+	Kind  string
+	Key   string
+	Value string
+	Books int64
+}
+
+// grouped rewrites an order of completions rows into one of the rows grouped by value
+var grouped = strings.NewReplacer("books", "max(books)", "key", "min(key)")
+
+const (
+	completeAuthor = "author"
+	completeSeries = "series"
+	completeTitle  = "title"
+)
+
+// UpdateCompletionIndex rebuilds the prefix index from the books table
+func (db *pgDB) UpdateCompletionIndex() error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&completion{}).Error; err != nil {
+			return err
+		}
+		for kind, column := range map[string]string{
+			completeAuthor: "author",
+			completeSeries: "series",
+			completeTitle:  "title",
+		} {
+			var values []booksing.FacetCount
+			err := tx.Model(&booksing.Book{}).
+				Select(column + " AS value, count(*) AS count").
+				Where(column + " != ''").
+				Group(column).
+				Scan(&values).Error
+			if err != nil {
+				return err
+			}
+
+			var rows []completion
+			for _, v := range values {
+				for _, key := range booksing.CompletionKeys(v.Value) {
+					rows = append(rows, completion{
+						Kind:  kind,
+						Key:   key,
+						Value: v.Value,
+						Books: v.Count,
+					})
+				}
+			}
+			if len(rows) == 0 {
+				continue
+			}
+			if err := tx.CreateInBatches(rows, 500).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// minCompletionPrefix is the shortest prefix that is completed, a single letter matches too much to be useful or fast
+const minCompletionPrefix = 2
+
+// Complete returns up to limit authors, series and titles that have a word starting with prefix.
+// Authors and series are ordered by their number of books, titles alphabetically.
+func (db *pgDB) Complete(prefix string, limit int) (*booksing.Completions, error) {
+	from := strings.ToLower(booksing.NormalizeSearch(strings.TrimSpace(prefix)))
+	// every key that starts with from sorts before this
+	to := from + "\U0010FFFF"
+
+	var c booksing.Completions
+	for _, k := range []struct {
+		kind  string
+		order string
+		dest  *[]booksing.FacetCount
+	}{
+		{kind: completeAuthor, order: `books DESC, key COLLATE "C"`, dest: &c.Authors},
+		{kind: completeSeries, order: `books DESC, key COLLATE "C"`, dest: &c.Series},
+		// walking the index in key order keeps short prefixes fast for the many titles
+		{kind: completeTitle, order: `key COLLATE "C"`, dest: &c.Titles},
+	} {
+		*k.dest = []booksing.FacetCount{}
+		if utf8.RuneCountInString(from) < minCompletionPrefix {
+			continue
+		}
+		// a value can match on several of its words, but should only be returned once
+		tx := db.db.Raw(`SELECT value, max(books) AS count FROM (
+	SELECT value, books, key FROM completions WHERE kind = ? AND key COLLATE "C" >= ? AND key COLLATE "C" < ? ORDER BY `+k.order+` LIMIT ?
+) AS matches GROUP BY value ORDER BY `+grouped.Replace(k.order)+` LIMIT ?`, k.kind, from, to, limit*3, limit).Scan(k.dest)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+	}
+	return &c, nil
+}
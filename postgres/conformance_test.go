@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/dbtest"
+)
+
+// TestConformance runs against the database in BOOKSING_TEST_DATABASEURL, all booksing tables in it are emptied
+func TestConformance(t *testing.T) {
+	url := os.Getenv("BOOKSING_TEST_DATABASEURL")
+	if url == "" {
+		t.Skip("BOOKSING_TEST_DATABASEURL is not set")
+	}
+
+	dbtest.Run(t, func(t *testing.T) booksing.Database {
+		db, err := New(url)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(db.Close)
+		err = db.db.Exec("TRUNCATE books, downloads, users, progresses, reading_states, completions, spelling, hash_aliases, works, proposals, authors, author_aliases, tags, book_tags, uploads, import_jobs, import_files RESTART IDENTITY").Error
+		if err != nil {
+			t.Fatalf("emptying the database failed: %v", err)
+		}
+		return db
+	})
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"embed"
+
+	"github.com/gnur/booksing/gormdb"
+	"github.com/gnur/booksing/migrate"
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrations are the sql files in migrations/ together with the steps that need Go. completions, rehash, group_works
+// and normalize_languages are backfills with the current code of booksing, see the migrate package. The rehash runs
+// after book_ids, once editions of a work may share a hash.
+func migrations() ([]migrate.Migration, error) {
+	return migrate.Load(migrationFiles, "migrations",
+		migrate.Migration{Version: 2, Name: "search_index", Up: createSearchIndex(firstSearchWeights)},
+		migrate.Migration{Version: 3, Name: "completions", Up: func(tx *gorm.DB) error {
+			return (&pgDB{db: tx}).UpdateCompletionIndex()
+		}},
+		migrate.Migration{Version: 6, Name: "rehash", Up: gormdb.RehashBooks},
+		migrate.Migration{Version: 8, Name: "group_works", Up: gormdb.GroupWorks},
+		migrate.Migration{Version: 11, Name: "normalize_languages", Up: gormdb.NormalizeLanguages},
+		migrate.Migration{Version: 14, Name: "search_tags", Up: createSearchIndex(searchWeights)},
+	)
+}
+
+// Migrations returns every migration of the schema and when it was applied
+func (db *pgDB) Migrations() ([]migrate.Status, error) {
+	ms, err := migrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Statuses(db.db, ms)
+}
+
+// Migrate applies the pending migrations, unlike with sqlite no copy is made first, use pg_dump for that
+func (db *pgDB) Migrate() error {
+	ms, err := migrations()
+	if err != nil {
+		return err
+	}
+	return migrate.Apply(db.db, ms)
+}
@@ -0,0 +1,33 @@
+-- the schema as gorm created it before migrations existed
+CREATE TABLE IF NOT EXISTS "books" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"hash" text,"title" text,"author" text,"language" text,"description" text,"added" timestamptz,"path" text,"size" bigint,"has_cover" boolean,"cover_path" text,"publisher" text,"isbn" text,"series" text,"publish_date" timestamptz,"series_index" decimal,"checksum" text,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_books_hash" ON "books" ("hash");
+CREATE INDEX IF NOT EXISTS "idx_books_deleted_at" ON "books" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_books_checksum" ON "books" ("checksum");
+CREATE INDEX IF NOT EXISTS "idx_books_series" ON "books" ("series");
+CREATE INDEX IF NOT EXISTS "idx_books_size" ON "books" ("size");
+CREATE INDEX IF NOT EXISTS "idx_books_added" ON "books" ("added");
+CREATE INDEX IF NOT EXISTS "idx_books_language" ON "books" ("language");
+CREATE INDEX IF NOT EXISTS "idx_books_author" ON "books" ("author");
+
+CREATE TABLE IF NOT EXISTS "downloads" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"book" text,"user" text,"ip" text,"timestamp" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_downloads_user" ON "downloads" ("user");
+CREATE INDEX IF NOT EXISTS "idx_downloads_deleted_at" ON "downloads" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,"is_admin" boolean,"is_allowed" boolean,"downloads" bigint,"created" timestamptz,"last_seen" timestamptz,"sync_key" text,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_name" ON "users" ("name");
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "progresses" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user" text,"document" text,"book" text,"progress" text,"percentage" decimal,"device" text,"device_id" text,"timestamp" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_progresses_book" ON "progresses" ("book");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_progress_user_document" ON "progresses" ("user","document");
+CREATE INDEX IF NOT EXISTS "idx_progresses_deleted_at" ON "progresses" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "reading_states" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user" text,"book" text,"status" text,"started" timestamptz,"finished" timestamptz,"rating" bigint,"note" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_reading_states_finished" ON "reading_states" ("finished");
+CREATE INDEX IF NOT EXISTS "idx_reading_states_status" ON "reading_states" ("status");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_reading_user_book" ON "reading_states" ("user","book");
+CREATE INDEX IF NOT EXISTS "idx_reading_states_deleted_at" ON "reading_states" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "completions" ("kind" text,"key" text,"value" text,"books" bigint);
+-- the prefix index is searched with byte wise comparisons, which only a "C" collated index supports
+CREATE INDEX IF NOT EXISTS "idx_completion_lookup" ON "completions" ("kind", "key" COLLATE "C");
@@ -0,0 +1,4 @@
+-- books are identified by their id, the hash is shared by the editions and files of a work and a file is only stored once
+DROP INDEX IF EXISTS "idx_books_hash";
+CREATE INDEX IF NOT EXISTS "idx_books_hash" ON "books" ("hash");
+CREATE UNIQUE INDEX "idx_books_path" ON "books" ("path") WHERE "path" != '';
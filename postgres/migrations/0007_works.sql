@@ -0,0 +1,4 @@
+-- a work groups the editions of a book in every language and format, group_works groups the existing books
+CREATE TABLE "works" ("id" bigserial,"title" text,"author" text,PRIMARY KEY ("id"));
+ALTER TABLE "books" ADD COLUMN "work_id" bigint NOT NULL DEFAULT 0;
+CREATE INDEX "idx_books_work_id" ON "books" ("work_id");
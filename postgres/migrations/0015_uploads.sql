@@ -0,0 +1,5 @@
+-- files uploaded through the web ui and what the import made of them, books remember who uploaded them
+CREATE TABLE "uploads" ("id" bigserial,"created" timestamptz,"uploader" text,"filename" text,"path" text,"size" bigint,"status" text,"message" text,"book_id" bigint,PRIMARY KEY ("id"));
+CREATE INDEX "idx_uploads_uploader" ON "uploads" ("uploader");
+CREATE INDEX "idx_uploads_path" ON "uploads" ("path");
+ALTER TABLE "books" ADD COLUMN "uploaded_by" text NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- every run of the import with its counters, and the outcome of every file it found
+CREATE TABLE "import_jobs" ("id" bigserial,"started" timestamptz,"finished" timestamptz,"found" bigint,"parsed" bigint,"added" bigint,"duplicate" bigint,"rejected" bigint,"failed" bigint,PRIMARY KEY ("id"));
+CREATE TABLE "import_files" ("id" bigserial,"import_job_id" bigint,"path" text,"outcome" text,"message" text,"took" bigint,PRIMARY KEY ("id"));
+CREATE INDEX "idx_import_files_import_job_id" ON "import_files" ("import_job_id");
+CREATE INDEX "idx_import_files_path" ON "import_files" ("path");
@@ -0,0 +1,2 @@
+-- import jobs can be stopped before they are done
+ALTER TABLE "import_jobs" ADD COLUMN "stopped" boolean NOT NULL DEFAULT false;
@@ -0,0 +1,31 @@
+-- downloads, progress and reading states refer to the book they are about by its id instead of the hash the editions
+-- of a work share. They go to the first edition with their hash, or with the hash a rehash gave the work, and a
+-- reading state that ends up next to another one for the same book only survives when it changed last.
+ALTER TABLE "downloads" ADD COLUMN "book_id" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "progresses" ADD COLUMN "book_id" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "reading_states" ADD COLUMN "book_id" bigint NOT NULL DEFAULT 0;
+
+CREATE TEMPORARY TABLE "hash_books" AS
+SELECT "hash", (SELECT "id" FROM "books" b WHERE b."hash" = h."hash" ORDER BY b."deleted_at" IS NOT NULL, b."id" LIMIT 1) AS "book_id"
+FROM (SELECT DISTINCT "hash" FROM "books") h;
+INSERT INTO "hash_books" SELECT a."hash", h."book_id" FROM "hash_aliases" a JOIN "hash_books" h ON h."hash" = a."book"
+WHERE a."hash" NOT IN (SELECT "hash" FROM "hash_books");
+
+UPDATE "downloads" SET "book_id" = COALESCE((SELECT "book_id" FROM "hash_books" WHERE "hash" = "downloads"."book"), 0);
+UPDATE "progresses" SET "book_id" = COALESCE((SELECT "book_id" FROM "hash_books" WHERE "hash" = "progresses"."book"), 0);
+UPDATE "reading_states" SET "book_id" = COALESCE((SELECT "book_id" FROM "hash_books" WHERE "hash" = "reading_states"."book"), 0);
+DROP TABLE "hash_books";
+
+DELETE FROM "reading_states" WHERE "book_id" = 0 OR EXISTS (
+SELECT 1 FROM "reading_states" other
+WHERE other."user" = "reading_states"."user" AND other."book_id" = "reading_states"."book_id" AND other."id" != "reading_states"."id"
+AND (other."deleted_at" IS NULL AND "reading_states"."deleted_at" IS NOT NULL
+OR (other."deleted_at" IS NULL) = ("reading_states"."deleted_at" IS NULL)
+AND (other."updated_at" > "reading_states"."updated_at" OR other."updated_at" = "reading_states"."updated_at" AND other."id" > "reading_states"."id")));
+
+ALTER TABLE "downloads" DROP COLUMN "book";
+ALTER TABLE "progresses" DROP COLUMN "book";
+ALTER TABLE "reading_states" DROP COLUMN "book";
+CREATE UNIQUE INDEX "idx_reading_user_book" ON "reading_states" ("user","book_id");
+CREATE INDEX "idx_progresses_book_id" ON "progresses" ("book_id");
+CREATE INDEX "idx_downloads_book_id" ON "downloads" ("book_id");
@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/query"
+	"gorm.io/gorm"
+)
+
+// fieldWeights are the labels in the search column of the fields that are searched through it
+var fieldWeights = map[string]string{
+	"":            "",
+	"author":      "B",
+	"title":       "A",
+	"description": "D",
+	"series":      "C",
+	"publisher":   "D",
+}
+
+// rechecked fields share their weight with other columns, so a match on the search column is confirmed on the column itself
+var rechecked = map[string]bool{
+	"description": true,
+	"publisher":   true,
+}
+
+// taggedBooks selects the ids of books by the name of their tags
+const taggedBooks = "SELECT book_tags.book_id FROM book_tags JOIN tags ON tags.id = book_tags.tag_id"
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type condition struct {
+	sql  string
+	args []interface{}
+}
+
+// compiled is a parsed search query translated into sql conditions on the search column and the books table
+type compiled struct {
+	where []condition
+	// rank is a tsquery of all terms that are not negated, it orders the results by relevance
+	rank string
+}
+
+func (c *compiled) scope(tx *gorm.DB) *gorm.DB {
+	for _, w := range c.where {
+		tx = tx.Where(w.sql, w.args...)
+	}
+	return tx
+}
+
+func compile(q string, n query.Node) (*compiled, error) {
+	n = query.Prune(n)
+	if n == nil {
+		return nil, &query.Error{Query: q, Msg: "nothing to search for"}
+	}
+
+	nodes := []query.Node{n}
+	if and, ok := n.(*query.And); ok {
+		nodes = and.Nodes
+	}
+
+	var c compiled
+	for _, n := range nodes {
+		sql, args, err := sqlExpr(q, n)
+		if err != nil {
+			return nil, err
+		}
+		c.where = append(c.where, condition{sql: sql, args: args})
+	}
+
+	var rank []string
+	for _, t := range positiveTerms(n) {
+		if tsq := tsquery(t, fieldWeights[t.Field]); tsq != "" {
+			rank = append(rank, "("+tsq+")")
+		}
+	}
+	c.rank = strings.Join(rank, " | ")
+
+	return &c, nil
+}
+
+// positiveTerms returns the terms of n that are searched through the search column and not negated
+func positiveTerms(n query.Node) []*query.Term {
+	switch v := n.(type) {
+	case *query.Term:
+		if _, ok := fieldWeights[v.Field]; ok {
+			return []*query.Term{v}
+		}
+	case *query.And:
+		var terms []*query.Term
+		for _, n := range v.Nodes {
+			terms = append(terms, positiveTerms(n)...)
+		}
+		return terms
+	case *query.Or:
+		var terms []*query.Term
+		for _, n := range v.Nodes {
+			terms = append(terms, positiveTerms(n)...)
+		}
+		return terms
+	}
+	return nil
+}
+
+// tsquery returns the words of t as a phrase, limited to the given weight.
+// The words are split the same way the search column is, on everything that is not a letter or digit.
+func tsquery(t *query.Term, weight string) string {
+	words := strings.FieldsFunc(strings.ToLower(booksing.NormalizeSearch(t.Value)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i := range words {
+		label := weight
+		if t.Prefix && i == len(words)-1 {
+			label = "*" + label
+		}
+		if label != "" {
+			words[i] += ":" + label
+		}
+	}
+	return strings.Join(words, " <-> ")
+}
+
+func sqlExpr(q string, n query.Node) (string, []interface{}, error) {
+	switch v := n.(type) {
+	case *query.Term:
+		return termExpr(q, v)
+	case *query.Range:
+		return rangeExpr(v)
+	case *query.Not:
+		sql, args, err := sqlExpr(q, v.Node)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + sql + ")", args, nil
+	case *query.And:
+		return joinSQL(q, v.Nodes, " AND ")
+	case *query.Or:
+		return joinSQL(q, v.Nodes, " OR ")
+	}
+	return "", nil, &query.Error{Query: q, Msg: "unsupported search"}
+}
+
+func joinSQL(q string, nodes []query.Node, sep string) (string, []interface{}, error) {
+	var parts []string
+	var args []interface{}
+	for _, n := range nodes {
+		sql, a, err := sqlExpr(q, n)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		args = append(args, a...)
+	}
+	return "(" + strings.Join(parts, sep) + ")", args, nil
+}
+
+func termExpr(q string, t *query.Term) (string, []interface{}, error) {
+	if weight, ok := fieldWeights[t.Field]; ok {
+		tsq := tsquery(t, weight)
+		if tsq == "" {
+			return "FALSE", nil, nil
+		}
+		if rechecked[t.Field] {
+			return "(books.search @@ to_tsquery('simple', ?) AND to_tsvector('simple', " + wordsFunc + "(books." + t.Field + ")) @@ to_tsquery('simple', ?))",
+				[]interface{}{tsq, tsquery(t, "")}, nil
+		}
+		return "books.search @@ to_tsquery('simple', ?)", []interface{}{tsq}, nil
+	}
+
+	value := t.Value
+	switch t.Field {
+	case "language":
+		// a language booksing does not know is searched for as it is
+		if lang := booksing.FixLang(value); !t.Prefix && lang != "" {
+			value = lang
+		}
+	case "isbn":
+		value = strings.NewReplacer("-", "", " ", "").Replace(value)
+	case "tag":
+		// tags are stored by their TagName, which is lower case already
+		value = booksing.TagName(value)
+		if t.Prefix {
+			return "books.id IN (" + taggedBooks + ` WHERE tags.name LIKE ? ESCAPE '\')`, []interface{}{likeEscaper.Replace(value) + "%"}, nil
+		}
+		return "books.id IN (" + taggedBooks + " WHERE tags.name = ?)", []interface{}{value}, nil
+	default:
+		return "", nil, &query.Error{Query: q, Pos: t.Pos, Msg: "searching by " + t.Field + " is not supported yet"}
+	}
+
+	if t.Prefix {
+		return "books." + t.Field + ` ILIKE ? ESCAPE '\'`, []interface{}{likeEscaper.Replace(value) + "%"}, nil
+	}
+	return "lower(books." + t.Field + ") = lower(?)", []interface{}{value}, nil
+}
+
+func rangeExpr(r *query.Range) (string, []interface{}, error) {
+	column := map[string]string{
+		"added": "books.added",
+		"year":  "books.publish_date",
+		"size":  "books.size",
+	}[r.Field]
+
+	var parts []string
+	var args []interface{}
+	if r.Min != nil {
+		parts = append(parts, column+" >= ?")
+		args = append(args, r.Min)
+	} else if r.Field == "year" {
+		// books without a known publish date should not match an open ended range
+		parts = append(parts, column+" > ?")
+		args = append(args, time.Time{})
+	}
+	if r.Max != nil {
+		parts = append(parts, column+" < ?")
+		args = append(args, r.Max)
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", args, nil
+}
+
+// sortOrder returns the order by clause for the requested sort, every order ends with the id
+// so books that compare equal always come back in the same order and paging never skips or repeats them
+func sortOrder(sort string, c *compiled) string {
+	if sort == "" || sort == "relevance" {
+		if c.rank != "" {
+			// the default weights of ts_rank already favour titles and authors over the other columns
+			return "ts_rank(books.search, to_tsquery('simple', " + quote(c.rank) + ")) DESC, books.id DESC"
+		}
+		sort = "added"
+	}
+
+	// the "C" collation compares like sqlite does, other collations skip the punctuation in names like C.S. Lewis
+	switch sort {
+	case "title":
+		return `lower(books.title) COLLATE "C", lower(books.author) COLLATE "C", books.id`
+	case "author":
+		return `lower(books.author) COLLATE "C", lower(books.title) COLLATE "C", books.id`
+	case "published":
+		return "books.publish_date DESC, books.id DESC"
+	case "size":
+		return "books.size DESC, books.id DESC"
+	case "series":
+		return `books.series = '', lower(books.series) COLLATE "C", books.series_index, books.id`
+	}
+	return newestFirst
+}
+
+// newestFirst is the order that supports keyset cursors
+const newestFirst = "books.added DESC, books.id DESC"
+
+// afterCursor limits newest first results to the books that come after the cursor
+func afterCursor(added time.Time, id uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("books.added < ? OR (books.added = ? AND books.id < ?)", added, added, id)
+	}
+}
+
+// facetFilter limits a book query to the facets selected in the search
+func facetFilter(sq booksing.SearchQuery) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if sq.Language != "" {
+			tx = tx.Where("books.language = ?", sq.Language)
+		}
+		if sq.Series != "" {
+			tx = tx.Where("books.series = ?", sq.Series)
+		}
+		if sq.Publisher != "" {
+			tx = tx.Where("books.publisher = ?", sq.Publisher)
+		}
+		if sq.HasCover {
+			tx = tx.Where("books.has_cover = ?", true)
+		}
+		if !sq.AddedSince.IsZero() {
+			tx = tx.Where("books.added >= ?", sq.AddedSince)
+		}
+		return tx
+	}
+}
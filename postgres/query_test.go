@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gnur/booksing/query"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     string
+		where []condition
+		rank  string
+	}{
+		{
+			name: "free text",
+			q:    "lord rings",
+			where: []condition{
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"lord"}},
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"rings"}},
+			},
+			rank: "(lord) | (rings)",
+		},
+		{
+			name: "accents are folded like the index",
+			q:    "author:Bjørk zafón",
+			where: []condition{
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"bjork:B"}},
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"zafon"}},
+			},
+			rank: "(bjork:B) | (zafon)",
+		},
+		{
+			name: "fields, phrases and prefixes",
+			q:    `author:j.r.r.tolk* title:"the hobbit"`,
+			where: []condition{
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"j:B <-> r:B <-> r:B <-> tolk:*B"}},
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"the:A <-> hobbit:A"}},
+			},
+			rank: "(j:B <-> r:B <-> r:B <-> tolk:*B) | (the:A <-> hobbit:A)",
+		},
+		{
+			name: "apostrophes split words like the index",
+			q:    "title:it's",
+			where: []condition{
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"it:A <-> s:A"}},
+			},
+			rank: "(it:A <-> s:A)",
+		},
+		{
+			name: "publisher is rechecked",
+			q:    "publisher:penguin",
+			where: []condition{
+				{sql: "(books.search @@ to_tsquery('simple', ?) AND to_tsvector('simple', booksing_words(books.publisher)) @@ to_tsquery('simple', ?))", args: []interface{}{"penguin:D", "penguin"}},
+			},
+			rank: "(penguin:D)",
+		},
+		{
+			name: "negation is not ranked",
+			q:    "tolkien -hobbit",
+			where: []condition{
+				{sql: "books.search @@ to_tsquery('simple', ?)", args: []interface{}{"tolkien"}},
+				{sql: "NOT (books.search @@ to_tsquery('simple', ?))", args: []interface{}{"hobbit"}},
+			},
+			rank: "(tolkien)",
+		},
+		{
+			name: "language and isbn",
+			q:    "lang:dutch isbn:978-0-261-10235-4",
+			where: []condition{
+				{sql: "lower(books.language) = lower(?)", args: []interface{}{"nl"}},
+				{sql: "lower(books.isbn) = lower(?)", args: []interface{}{"9780261102354"}},
+			},
+		},
+		{
+			name: "language prefix is escaped",
+			q:    "lang:e_*",
+			where: []condition{
+				{sql: `books.language ILIKE ? ESCAPE '\'`, args: []interface{}{`e\_%`}},
+			},
+		},
+		{
+			name: "tags by name and by prefix",
+			q:    `tag:"Science  Fiction" tag:fant*`,
+			where: []condition{
+				{sql: "books.id IN (" + taggedBooks + " WHERE tags.name = ?)", args: []interface{}{"science fiction"}},
+				{sql: "books.id IN (" + taggedBooks + ` WHERE tags.name LIKE ? ESCAPE '\')`, args: []interface{}{"fant%"}},
+			},
+		},
+		{
+			name: "mixed or",
+			q:    "author:tolkien OR isbn:9780261102354",
+			where: []condition{
+				{sql: "(books.search @@ to_tsquery('simple', ?) OR lower(books.isbn) = lower(?))", args: []interface{}{"tolkien:B", "9780261102354"}},
+			},
+			rank: "(tolkien:B)",
+		},
+		{
+			name: "ranges",
+			q:    "size:<5MB year:1990..2000",
+			where: []condition{
+				{sql: "(books.size < ?)", args: []interface{}{int64(5 << 20)}},
+				{sql: "(books.publish_date >= ? AND books.publish_date < ?)", args: []interface{}{
+					time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+					time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := query.Parse(tt.q)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.q, err)
+			}
+			c, err := compile(tt.q, n)
+			if err != nil {
+				t.Fatalf("compile(%q) error = %v", tt.q, err)
+			}
+			if !reflect.DeepEqual(c.where, tt.where) {
+				t.Errorf("compile(%q) where = %#v, want %#v", tt.q, c.where, tt.where)
+			}
+			if c.rank != tt.rank {
+				t.Errorf("compile(%q) rank = %q, want %q", tt.q, c.rank, tt.rank)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		q   string
+		pos int
+		msg string
+	}{
+		{q: "- ,", pos: 0, msg: "nothing to search for"},
+	}
+	for _, tt := range tests {
+		n, err := query.Parse(tt.q)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.q, err)
+		}
+		_, err = compile(tt.q, n)
+		qe, ok := err.(*query.Error)
+		if !ok {
+			t.Fatalf("compile(%q) error = %v, want a *query.Error", tt.q, err)
+		}
+		if qe.Pos != tt.pos || qe.Msg != tt.msg {
+			t.Errorf("compile(%q) error = %q at %d, want %q at %d", tt.q, qe.Msg, qe.Pos, tt.msg, tt.pos)
+		}
+	}
+}
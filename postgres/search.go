@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gnur/booksing"
+	"gorm.io/gorm"
+)
+
+// searchWeight is a column of the books table that is part of the search vector with its weight
+type searchWeight struct {
+	column string
+	weight string
+}
+
+// searchWeights are the columns of the search vector, the weights let a search on a single field use the same index
+// as a search on all of them.
+var searchWeights = append(firstSearchWeights, searchWeight{column: "tags", weight: "D"})
+
+// firstSearchWeights are the columns the first version of the search vector had, before books had tags
+var firstSearchWeights = []searchWeight{
+	{column: "title", weight: "A"},
+	{column: "author", weight: "B"},
+	{column: "series", weight: "C"},
+	{column: "description", weight: "D"},
+	{column: "publisher", weight: "D"},
+	{column: "isbn", weight: "D"},
+	{column: "language", weight: "D"},
+	{column: "hash", weight: "D"},
+}
+
+const (
+	// normalizeFunc is booksing.NormalizeSearch as a sql function
+	normalizeFunc = "booksing_normalize"
+	// wordsFunc normalizes a column and splits it on punctuation, so the parser never sees hosts, emails or paths
+	wordsFunc = "booksing_words"
+)
+
+// normalizeBlocks are the unicode blocks that normalizeFunc folds, which covers the latin, greek and cyrillic scripts
+var normalizeBlocks = [][2]rune{
+	{0x00C0, 0x024F},
+	{0x0370, 0x03FF},
+	{0x0400, 0x04FF},
+	{0x1E00, 0x1EFF},
+	{0x1F00, 0x1FFF},
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// normalizeExpr returns a sql expression that folds s like booksing.NormalizeSearch does,
+// it is generated from that function so both backends always agree on what matches.
+func normalizeExpr(s string) string {
+	var from, to []rune
+	var replace [][2]string
+	for _, block := range normalizeBlocks {
+		for r := block[0]; r <= block[1]; r++ {
+			n := []rune(booksing.NormalizeSearch(string(r)))
+			switch {
+			case len(n) == 1 && n[0] == r:
+			case len(n) == 1:
+				from = append(from, r)
+				to = append(to, n[0])
+			default:
+				replace = append(replace, [2]string{string(r), string(n)})
+			}
+		}
+	}
+	// translate drops every rune in from that has no counterpart in to, which removes the combining accents
+	for r := rune(0x0300); r <= 0x036F; r++ {
+		from = append(from, r)
+	}
+
+	expr := fmt.Sprintf("translate(%s, %s, %s)", s, quote(string(from)), quote(string(to)))
+	for _, r := range replace {
+		expr = fmt.Sprintf("replace(%s, %s, %s)", expr, quote(r[0]), quote(r[1]))
+	}
+	return expr
+}
+
+// searchVector returns the expression of the generated search column
+func searchVector(weights []searchWeight) string {
+	var parts []string
+	for _, c := range weights {
+		parts = append(parts, fmt.Sprintf("setweight(to_tsvector('simple', %s(%s)), '%s')", wordsFunc, c.column, c.weight))
+	}
+	return strings.Join(parts, " || ")
+}
+
+func searchIndexStatements(weights []searchWeight) []string {
+	return []string{
+		"DROP INDEX IF EXISTS idx_books_search",
+		"ALTER TABLE books DROP COLUMN IF EXISTS search",
+		fmt.Sprintf("CREATE OR REPLACE FUNCTION %s(s text) RETURNS text LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$ SELECT %s $$", normalizeFunc, normalizeExpr("s")),
+		fmt.Sprintf("CREATE OR REPLACE FUNCTION %s(s text) RETURNS text LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$ SELECT regexp_replace(%s(coalesce(s, '')), '[[:punct:]]+', ' ', 'g') $$", wordsFunc, normalizeFunc),
+		fmt.Sprintf("ALTER TABLE books ADD COLUMN search tsvector GENERATED ALWAYS AS (%s) STORED", searchVector(weights)),
+		"CREATE INDEX idx_books_search ON books USING gin (search)",
+		"CREATE TABLE IF NOT EXISTS spelling (word text PRIMARY KEY, docs bigint NOT NULL)",
+		"DELETE FROM spelling",
+		fillSpelling,
+		// the index was versioned on its own before migrations existed
+		"DROP TABLE IF EXISTS search_index_version",
+	}
+}
+
+// createSearchIndex returns a migration that (re)creates the search column of weights and its functions,
+// later changes to the index are new migrations that keep the columns of earlier ones as they were.
+func createSearchIndex(weights []searchWeight) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, stmt := range searchIndexStatements(weights) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("creating search index failed on %q: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// RebuildSearchIndex recomputes the search column of every book, and the spelling and prefix indexes derived from the books
+func (db *pgDB) RebuildSearchIndex() error {
+	// any update recomputes the generated column
+	tx := db.db.Exec("UPDATE books SET id = id")
+	if tx.Error != nil {
+		return tx.Error
+	}
+	tx = db.db.Exec("REINDEX INDEX idx_books_search")
+	if tx.Error != nil {
+		return tx.Error
+	}
+	err := db.UpdateSpellingIndex()
+	if err != nil {
+		return err
+	}
+	return db.UpdateCompletionIndex()
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"strings"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/query"
+	"gorm.io/gorm"
+)
+
+// fillSpelling copies the words of all authors and titles into the table used for suggestions,
+// those are the words with weight A and B in the search column.
+const fillSpelling = `INSERT INTO spelling (word, docs)
+SELECT word, ndoc FROM ts_stat('SELECT ts_filter(search, ''{a,b}'') FROM books WHERE deleted_at IS NULL') WHERE length(word) >= 3`
+
+// UpdateSpellingIndex refreshes the words that are used for "did you mean" suggestions
+func (db *pgDB) UpdateSpellingIndex() error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM spelling").Error; err != nil {
+			return err
+		}
+		return tx.Exec(fillSpelling).Error
+	})
+}
+
+// suggest returns a corrected version of a search without results, but only when the correction does find books
+func (db *pgDB) suggest(sq booksing.SearchQuery, n query.Node, scopes ...func(*gorm.DB) *gorm.DB) ([]booksing.Suggestion, error) {
+	var edits []query.Edit
+	for _, t := range query.Correctable(n) {
+		word := strings.ToLower(booksing.NormalizeSearch(t.Value))
+
+		var known bool
+		tx := db.db.Raw("SELECT EXISTS (SELECT 1 FROM books WHERE search @@ to_tsquery('simple', ?))", word).Scan(&known)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		if known {
+			continue
+		}
+
+		closest, err := db.closestWord(word)
+		if err != nil {
+			return nil, err
+		}
+		if closest != "" {
+			edits = append(edits, t.Replace(closest))
+		}
+	}
+	if len(edits) == 0 {
+		return nil, nil
+	}
+
+	corrected := query.Rewrite(sq.Query, edits)
+	n, err := query.Parse(corrected)
+	if err != nil {
+		return nil, nil
+	}
+	c, err := compile(corrected, n)
+	if err != nil {
+		return nil, nil
+	}
+
+	var total int64
+	tx := db.db.Model(&booksing.Book{}).Scopes(c.scope).Scopes(scopes...).Count(&total)
+	if tx.Error != nil || total == 0 {
+		return nil, tx.Error
+	}
+	return []booksing.Suggestion{{Query: corrected, Total: total}}, nil
+}
+
+// closestWord returns the known word that is the fewest edits away from word, or an empty string when nothing is close enough
+func (db *pgDB) closestWord(word string) (string, error) {
+	var patterns []string
+	for _, t := range query.Trigrams(word) {
+		patterns = append(patterns, "%"+likeEscaper.Replace(t)+"%")
+	}
+	if len(patterns) == 0 {
+		return "", nil
+	}
+
+	// the words sharing the most trigrams are the most likely candidates
+	var rows []struct {
+		Word string
+		Docs int64
+	}
+	tx := db.db.Raw(`SELECT word, docs FROM spelling WHERE word LIKE ANY (ARRAY[?])
+ORDER BY (SELECT count(*) FROM unnest(ARRAY[?]) AS p WHERE word LIKE p) DESC LIMIT 200`, patterns, patterns).Scan(&rows)
+	if tx.Error != nil {
+		return "", tx.Error
+	}
+
+	candidates := make(map[string]int64)
+	for _, r := range rows {
+		candidates[r.Word] = r.Docs
+	}
+	return query.Closest(word, candidates), nil
+}
@@ -0,0 +1,20 @@
+package booksing
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Progress is the last known reading position of a user in a document, as reported by KOReader
+type Progress struct {
+	gorm.Model
+	User       string `gorm:"uniqueIndex:idx_progress_user_document"`
+	Document   string `gorm:"uniqueIndex:idx_progress_user_document"`
+	BookID     uint   `gorm:"index"`
+	Progress   string
+	Percentage float64
+	Device     string
+	DeviceID   string
+	Timestamp  time.Time
+}
@@ -0,0 +1,102 @@
+package booksing
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MetadataFields are the fields of a book that external catalogs can fill in, by column name
+var MetadataFields = []string{"title", "author", "description", "isbn", "publisher", "series", "series_index", "publish_date", "language"}
+
+// Proposal is a change to a single field of a book that an external catalog suggests, it is applied when an admin approves it
+type Proposal struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Book      uint `gorm:"index"`
+	// Field is one of MetadataFields, Current and Proposed are its values as returned by Book.Field
+	Field    string
+	Current  string
+	Proposed string
+	// Source is the catalog that proposed the change
+	Source string
+}
+
+// Field returns the value of a field in MetadataFields as text, empty when it has no value
+func (b Book) Field(field string) string {
+	switch field {
+	case "title":
+		return b.Title
+	case "author":
+		return b.Author
+	case "description":
+		return b.Description
+	case "isbn":
+		return b.ISBN
+	case "publisher":
+		return b.Publisher
+	case "series":
+		return b.Series
+	case "series_index":
+		if b.SeriesIndex == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(b.SeriesIndex, 'f', -1, 64)
+	case "publish_date":
+		if b.PublishDate.IsZero() {
+			return ""
+		}
+		return b.PublishDate.Format("2006-01-02")
+	case "language":
+		return b.Language
+	}
+	return ""
+}
+
+// Missing reports whether a field in MetadataFields has no known value, the title and author Fix gives unknown books count as missing
+func (b Book) Missing(field string) bool {
+	v := b.Field(field)
+	if field == "title" || field == "author" {
+		return v == "" || v == "Unknown"
+	}
+	return v == ""
+}
+
+// SetField sets a field in MetadataFields to a value as returned by Field. A new title or author gives the book a new hash as well.
+func (b *Book) SetField(field, value string) error {
+	switch field {
+	case "title":
+		b.Title = value
+	case "author":
+		b.Author = value
+	case "description":
+		b.Description = value
+	case "isbn":
+		b.ISBN = value
+	case "publisher":
+		b.Publisher = value
+	case "series":
+		b.Series = value
+	case "series_index":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid series index %q: %w", value, err)
+		}
+		b.SeriesIndex = f
+	case "publish_date":
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return fmt.Errorf("invalid publish date %q: %w", value, err)
+		}
+		b.PublishDate = t
+	case "language":
+		b.Language = value
+	default:
+		return fmt.Errorf("%q can not be changed", field)
+	}
+	if field == "title" || field == "author" {
+		b.Hash = HashBook(b.Author, b.Title)
+		b.HashVersion = HashVersion
+	}
+	return nil
+}
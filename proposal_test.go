@@ -0,0 +1,48 @@
+package booksing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetField(t *testing.T) {
+	var b Book
+	for _, f := range []struct {
+		field string
+		value string
+	}{
+		{field: "title", value: "The Hobbit"},
+		{field: "author", value: "J R R Tolkien"},
+		{field: "series_index", value: "1.5"},
+		{field: "publish_date", value: "1937-09-21"},
+		{field: "isbn", value: "9780261102217"},
+	} {
+		if err := b.SetField(f.field, f.value); err != nil {
+			t.Fatalf("SetField(%s, %s) error = %v", f.field, f.value, err)
+		}
+		if got := b.Field(f.field); got != f.value {
+			t.Errorf("Field(%s) = %q after setting it, want %q", f.field, got, f.value)
+		}
+	}
+	if b.Hash != HashBook("J R R Tolkien", "The Hobbit") || b.HashVersion != HashVersion {
+		t.Errorf("SetField() left hash %q version %d, want the hash of the new title and author", b.Hash, b.HashVersion)
+	}
+	if !b.PublishDate.Equal(time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("SetField(publish_date) = %v", b.PublishDate)
+	}
+
+	for _, f := range []string{"series_index", "publish_date", "hash"} {
+		if err := b.SetField(f, "nonsense"); err == nil {
+			t.Errorf("SetField(%s, nonsense) succeeded, want an error", f)
+		}
+	}
+}
+
+func TestMissing(t *testing.T) {
+	b := Book{Title: "Vervloekt", Author: "Unknown"}
+	for field, want := range map[string]bool{"title": false, "author": true, "description": true, "series_index": true} {
+		if got := b.Missing(field); got != want {
+			t.Errorf("Missing(%s) = %v, want %v", field, got, want)
+		}
+	}
+}
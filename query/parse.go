@@ -0,0 +1,323 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokField
+	tokLParen
+	tokRParen
+	tokOr
+	tokAnd
+	tokNot
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	prefix bool
+	pos    int
+	// end is the offset directly after the token
+	end int
+}
+
+// Parse turns q into a tree of nodes, syntax problems are returned as an *Error
+func Parse(q string) (Node, error) {
+	tokens, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{
+		q:      q,
+		tokens: tokens,
+	}
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(0, "empty query")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, p.errorf(t.pos, "unexpected )")
+		}
+		return nil, p.errorf(t.pos, "unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || r == ',' || r == '(' || r == ')' || r == '"'
+}
+
+func lex(q string) ([]token, error) {
+	var tokens []token
+	// termStart is true when a new term can start here, only then a - means NOT
+	termStart := true
+
+	for i := 0; i < len(q); {
+		r, size := utf8.DecodeRuneInString(q[i:])
+		switch {
+		case unicode.IsSpace(r) || r == ',':
+			i += size
+			termStart = true
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i += size
+			termStart = true
+			continue
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i += size
+			termStart = true
+			continue
+		case r == '"':
+			end := strings.IndexRune(q[i+1:], '"')
+			if end < 0 {
+				return nil, &Error{Query: q, Pos: i, Msg: "missing closing quote"}
+			}
+			t := token{kind: tokPhrase, text: q[i+1 : i+1+end], pos: i}
+			i += end + 2
+			if i < len(q) && q[i] == '*' {
+				t.prefix = true
+				i++
+			}
+			tokens = append(tokens, t)
+			termStart = false
+			continue
+		case r == '-' && termStart && i+1 < len(q) && !isSeparator(rune(q[i+1])) && q[i+1] != '-':
+			tokens = append(tokens, token{kind: tokNot, text: "-", pos: i})
+			i += size
+			continue
+		}
+
+		start := i
+		for i < len(q) {
+			r, size := utf8.DecodeRuneInString(q[i:])
+			if isSeparator(r) {
+				break
+			}
+			if r == ':' {
+				if field, ok := fieldName(q[start:i]); ok {
+					i += size
+					tokens = append(tokens, token{kind: tokField, text: field, pos: start, end: i})
+					start = i
+					break
+				}
+			}
+			i += size
+		}
+		if start == i {
+			// a field without anything directly after it
+			termStart = false
+			continue
+		}
+
+		word := q[start:i]
+		t := token{kind: tokWord, text: word, pos: start}
+		afterField := len(tokens) > 0 && tokens[len(tokens)-1].kind == tokField && tokens[len(tokens)-1].end == start
+		switch {
+		case afterField:
+			t.prefix = strings.HasSuffix(word, "*")
+			t.text = strings.TrimRight(word, "*")
+		case word == "OR":
+			t.kind = tokOr
+		case word == "AND":
+			t.kind = tokAnd
+		case word == "NOT":
+			t.kind = tokNot
+		default:
+			if strings.HasSuffix(word, "*") {
+				t.text = strings.TrimRight(word, "*")
+				t.prefix = true
+				if t.text == "" {
+					return nil, &Error{Query: q, Pos: start, Msg: "a wildcard needs at least one letter before it"}
+				}
+			}
+		}
+		tokens = append(tokens, t)
+		termStart = t.kind != tokWord
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(q)})
+	return tokens, nil
+}
+
+type parser struct {
+	q      string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) *Error {
+	return &Error{
+		Query: p.q,
+		Pos:   pos,
+		Msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *parser) parseOr() (Node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for p.peek().kind == tokOr {
+		or := p.next()
+		if !startsTerm(p.peek().kind) {
+			return nil, p.errorf(or.pos, "OR needs a search term on both sides")
+		}
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return &Or{Nodes: nodes}, nil
+}
+
+func startsTerm(k tokenKind) bool {
+	switch k {
+	case tokWord, tokPhrase, tokField, tokLParen, tokNot:
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes []Node
+	for {
+		t := p.peek()
+		if t.kind == tokAnd {
+			p.next()
+			if len(nodes) == 0 || !startsTerm(p.peek().kind) {
+				return nil, p.errorf(t.pos, "AND needs a search term on both sides")
+			}
+			continue
+		}
+		if !startsTerm(t.kind) {
+			break
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	switch len(nodes) {
+	case 0:
+		t := p.peek()
+		if t.kind == tokOr {
+			return nil, p.errorf(t.pos, "OR needs a search term on both sides")
+		}
+		if t.kind == tokRParen {
+			return nil, p.errorf(t.pos, "unexpected )")
+		}
+		return nil, p.errorf(t.pos, "expected a search term")
+	case 1:
+		return nodes[0], nil
+	}
+	return &And{Nodes: nodes}, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	t := p.peek()
+	if t.kind == tokNot {
+		p.next()
+		if !startsTerm(p.peek().kind) {
+			return nil, p.errorf(t.pos, "%s needs a search term after it", t.text)
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Node: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+// valuePos returns the offset of the text of a word or phrase token
+func valuePos(t token) int {
+	if t.kind == tokPhrase {
+		return t.pos + 1
+	}
+	return t.pos
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			return nil, p.errorf(t.pos, "empty parentheses")
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.errorf(t.pos, "missing closing parenthesis")
+		}
+		p.next()
+		return n, nil
+	case tokWord:
+		return &Term{Value: t.text, Prefix: t.prefix, Pos: t.pos, ValuePos: t.pos}, nil
+	case tokPhrase:
+		return &Term{Value: t.text, Phrase: true, Prefix: t.prefix, Pos: t.pos, ValuePos: valuePos(t)}, nil
+	case tokField:
+		v := p.peek()
+		if v.kind != tokWord && v.kind != tokPhrase || v.pos != t.end {
+			return nil, p.errorf(t.pos, "%s: needs a value directly after the colon", t.text)
+		}
+		p.next()
+		if isRangeField(t.text) {
+			if v.kind != tokWord || v.prefix {
+				return nil, p.errorf(v.pos, "%s: %s", t.text, rangeHelp[t.text])
+			}
+			r, err := parseRange(t.text, v.text)
+			if err != nil {
+				return nil, p.errorf(v.pos, "%s: %s", t.text, err.Error())
+			}
+			r.Pos = t.pos
+			return r, nil
+		}
+		return &Term{
+			Field:    t.text,
+			Value:    v.text,
+			Phrase:   v.kind == tokPhrase,
+			Prefix:   v.prefix,
+			Pos:      t.pos,
+			ValuePos: valuePos(v),
+		}, nil
+	}
+	return nil, p.errorf(t.pos, "expected a search term")
+}
@@ -0,0 +1,162 @@
+// Package query parses the booksing search syntax into a tree that database backends compile into their own query language.
+//
+// The syntax supports free text, field terms (author:tolkien), quoted phrases ("the hobbit"),
+// prefix wildcards (tolk*), grouping with parentheses, OR, NOT (or a leading -) and
+// ranges on the added, size and year fields (added:>2023-01-01, size:<5MB, year:1990..2000).
+// Terms without an operator between them must all match.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Fields that hold text and can be searched with words, phrases and prefixes
+var TextFields = []string{"author", "title", "series", "language", "publisher", "isbn", "tag", "description"}
+
+// Fields that can be searched with ranges
+var RangeFields = []string{"added", "size", "year"}
+
+var fieldAliases = map[string]string{
+	"lang": "language",
+	"desc": "description",
+	"tags": "tag",
+}
+
+// Node is a single element of a parsed query
+type Node interface {
+	String() string
+}
+
+// And matches when all of its nodes match
+type And struct {
+	Nodes []Node
+}
+
+// Or matches when any of its nodes match
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches when its node does not match
+type Not struct {
+	Node Node
+}
+
+// Term matches a word or phrase, either anywhere (empty Field) or in a single field
+type Term struct {
+	Field  string
+	Value  string
+	Phrase bool
+	Prefix bool
+	// Pos is the byte offset of the term in the query, ValuePos that of its value
+	Pos      int
+	ValuePos int
+}
+
+// Range matches values of Field between Min (inclusive) and Max (exclusive).
+// Min and Max are time.Time for the added and year fields and int64 for size, nil means unbounded.
+type Range struct {
+	Field string
+	Min   interface{}
+	Max   interface{}
+	// Pos is the byte offset of the range in the query
+	Pos int
+}
+
+// Error is a problem with the syntax of a query, Pos is the byte offset in Query where it was found
+type Error struct {
+	Query string
+	Pos   int
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos+1)
+}
+
+// Before returns the part of the query before the error
+func (e *Error) Before() string {
+	return e.Query[:e.Pos]
+}
+
+// After returns the part of the query from the error onwards
+func (e *Error) After() string {
+	return e.Query[e.Pos:]
+}
+
+func (n *And) String() string {
+	return "AND(" + joinNodes(n.Nodes) + ")"
+}
+
+func (n *Or) String() string {
+	return "OR(" + joinNodes(n.Nodes) + ")"
+}
+
+func (n *Not) String() string {
+	return "NOT(" + n.Node.String() + ")"
+}
+
+func (t *Term) String() string {
+	s := t.Value
+	if t.Phrase {
+		s = `"` + s + `"`
+	}
+	if t.Prefix {
+		s += "*"
+	}
+	if t.Field != "" {
+		s = t.Field + ":" + s
+	}
+	return s
+}
+
+func (r *Range) String() string {
+	return fmt.Sprintf("%s:[%s,%s)", r.Field, formatBound(r.Min), formatBound(r.Max))
+}
+
+func joinNodes(nodes []Node) string {
+	var parts []string
+	for _, n := range nodes {
+		parts = append(parts, n.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatBound(b interface{}) string {
+	switch v := b.(type) {
+	case time.Time:
+		return v.Format("2006-01-02")
+	case int64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func fieldName(s string) (string, bool) {
+	s = strings.ToLower(s)
+	if alias, ok := fieldAliases[s]; ok {
+		s = alias
+	}
+	for _, f := range TextFields {
+		if s == f {
+			return s, true
+		}
+	}
+	for _, f := range RangeFields {
+		if s == f {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+func isRangeField(s string) bool {
+	for _, f := range RangeFields {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package query
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want string
+	}{
+		{
+			name: "single word",
+			q:    "dune",
+			want: "dune",
+		},
+		{
+			name: "implicit and",
+			q:    "frank herbert dune",
+			want: "AND(frank, herbert, dune)",
+		},
+		{
+			name: "explicit and",
+			q:    "frank AND herbert",
+			want: "AND(frank, herbert)",
+		},
+		{
+			name: "field term",
+			q:    "author:tolkien",
+			want: "author:tolkien",
+		},
+		{
+			name: "field names are case insensitive and have aliases",
+			q:    "Author:tolkien lang:nl",
+			want: "AND(author:tolkien, language:nl)",
+		},
+		{
+			name: "quoted phrase in field",
+			q:    `author:"Mark Twain" title:"tom sawyer"`,
+			want: `AND(author:"Mark Twain", title:"tom sawyer")`,
+		},
+		{
+			name: "title with a colon",
+			q:    `title:"Dune: Messiah"`,
+			want: `title:"Dune: Messiah"`,
+		},
+		{
+			name: "colon in free text",
+			q:    "Star Wars: A New Hope",
+			want: "AND(Star, Wars:, A, New, Hope)",
+		},
+		{
+			name: "legacy comma separated query",
+			q:    "author:twain, title:sawyer",
+			want: "AND(author:twain, title:sawyer)",
+		},
+		{
+			name: "or",
+			q:    "tolkien OR lewis",
+			want: "OR(tolkien, lewis)",
+		},
+		{
+			name: "and binds stronger than or",
+			q:    "a b OR c",
+			want: "OR(AND(a, b), c)",
+		},
+		{
+			name: "parentheses",
+			q:    "a (b OR c)",
+			want: "AND(a, OR(b, c))",
+		},
+		{
+			name: "not",
+			q:    "tolkien NOT hobbit",
+			want: "AND(tolkien, NOT(hobbit))",
+		},
+		{
+			name: "minus",
+			q:    "tolkien -author:christopher",
+			want: "AND(tolkien, NOT(author:christopher))",
+		},
+		{
+			name: "hyphen in a word",
+			q:    "jean-paul sartre",
+			want: "AND(jean-paul, sartre)",
+		},
+		{
+			name: "lowercase keywords are words",
+			q:    "not or and",
+			want: "AND(not, or, and)",
+		},
+		{
+			name: "keywords as field value",
+			q:    "title:OR",
+			want: "title:OR",
+		},
+		{
+			name: "prefix wildcard",
+			q:    "tolk* series:disc*",
+			want: "AND(tolk*, series:disc*)",
+		},
+		{
+			name: "prefix phrase",
+			q:    `"lord of the*"*`,
+			want: `"lord of the*"*`,
+		},
+		{
+			name: "added after",
+			q:    "added:>2023-01-01",
+			want: "added:[2023-01-02,)",
+		},
+		{
+			name: "added from",
+			q:    "added:>=2023-01-01",
+			want: "added:[2023-01-01,)",
+		},
+		{
+			name: "added in month",
+			q:    "added:2023-02",
+			want: "added:[2023-02-01,2023-03-01)",
+		},
+		{
+			name: "added up to and including year",
+			q:    "added:<=2022",
+			want: "added:[,2023-01-01)",
+		},
+		{
+			name: "size smaller than",
+			q:    "size:<5MB",
+			want: "size:[,5242880)",
+		},
+		{
+			name: "size range",
+			q:    "size:500kb..1.5MiB",
+			want: "size:[512000,1572865)",
+		},
+		{
+			name: "year range",
+			q:    "year:1990..2000",
+			want: "year:[1990-01-01,2001-01-01)",
+		},
+		{
+			name: "open year range",
+			q:    "year:1990..",
+			want: "year:[1990-01-01,)",
+		},
+		{
+			name: "everything",
+			q:    `(author:tolkien OR author:lewis) -title:"the hobbit" year:<1960 lang:en`,
+			want: `AND(OR(author:tolkien, author:lewis), NOT(title:"the hobbit"), year:[,1960-01-01), language:en)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.q)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.q, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		pos  int
+		msg  string
+	}{
+		{
+			name: "empty",
+			q:    "  ",
+			pos:  0,
+			msg:  "empty query",
+		},
+		{
+			name: "unterminated quote",
+			q:    `title:"the hobbit`,
+			pos:  6,
+			msg:  "missing closing quote",
+		},
+		{
+			name: "missing closing parenthesis",
+			q:    "a (b OR c",
+			pos:  2,
+			msg:  "missing closing parenthesis",
+		},
+		{
+			name: "unexpected closing parenthesis",
+			q:    "a b)",
+			pos:  3,
+			msg:  "unexpected )",
+		},
+		{
+			name: "dangling or",
+			q:    "a OR",
+			pos:  2,
+			msg:  "OR needs a search term on both sides",
+		},
+		{
+			name: "leading or",
+			q:    "OR a",
+			pos:  0,
+			msg:  "OR needs a search term on both sides",
+		},
+		{
+			name: "dangling not",
+			q:    "a NOT",
+			pos:  2,
+			msg:  "NOT needs a search term after it",
+		},
+		{
+			name: "field without value",
+			q:    "author: tolkien",
+			pos:  0,
+			msg:  "author: needs a value directly after the colon",
+		},
+		{
+			name: "lone wildcard",
+			q:    "a *",
+			pos:  2,
+			msg:  "a wildcard needs at least one letter before it",
+		},
+		{
+			name: "invalid date",
+			q:    "added:>yesterday",
+			pos:  6,
+			msg:  "added: " + rangeHelp["added"],
+		},
+		{
+			name: "unknown size unit",
+			q:    "size:5TB",
+			pos:  5,
+			msg:  "size: " + rangeHelp["size"],
+		},
+		{
+			name: "reversed range",
+			q:    "year:2000..1990",
+			pos:  5,
+			msg:  "year: the start of the range should be before the end",
+		},
+		{
+			name: "empty parentheses",
+			q:    "a ()",
+			pos:  2,
+			msg:  "empty parentheses",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.q)
+			qe, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("Parse(%q) error = %v, want a *Error", tt.q, err)
+			}
+			if qe.Pos != tt.pos || qe.Msg != tt.msg {
+				t.Errorf("Parse(%q) error = %q at %d, want %q at %d", tt.q, qe.Msg, qe.Pos, tt.msg, tt.pos)
+			}
+			if qe.Before()+qe.After() != tt.q {
+				t.Errorf("Before() + After() = %q, want %q", qe.Before()+qe.After(), tt.q)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package query
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rangeHelp = map[string]string{
+	"added": "expected a date like 2023-01-31, 2023-01 or 2023, optionally with <, <=, >, >= or a range like 2022..2023",
+	"year":  "expected a year like 1990, optionally with <, <=, >, >= or a range like 1990..2000",
+	"size":  "expected a size like 500KB or 5MB, optionally with <, <=, >, >= or a range like 1MB..5MB",
+}
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+}
+
+// parseRange turns the value of a range field into the half open interval it describes
+func parseRange(field, s string) (*Range, error) {
+	r := Range{Field: field}
+	fail := errors.New(rangeHelp[field])
+
+	if from, to, ok := strings.Cut(s, ".."); ok {
+		if from == "" && to == "" {
+			return nil, fail
+		}
+		if from != "" {
+			start, _, err := interval(field, from)
+			if err != nil {
+				return nil, fail
+			}
+			r.Min = start
+		}
+		if to != "" {
+			_, end, err := interval(field, to)
+			if err != nil {
+				return nil, fail
+			}
+			r.Max = end
+		}
+		if r.Min != nil && r.Max != nil && !less(r.Min, r.Max) {
+			return nil, errors.New("the start of the range should be before the end")
+		}
+		return &r, nil
+	}
+
+	op := ""
+	for _, o := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			s = s[len(o):]
+			break
+		}
+	}
+	start, end, err := interval(field, s)
+	if err != nil {
+		return nil, fail
+	}
+
+	switch op {
+	case ">":
+		r.Min = end
+	case ">=":
+		r.Min = start
+	case "<":
+		r.Max = start
+	case "<=":
+		r.Max = end
+	default:
+		r.Min, r.Max = start, end
+	}
+	return &r, nil
+}
+
+// interval returns the first value described by s and the first value after it
+func interval(field, s string) (interface{}, interface{}, error) {
+	switch field {
+	case "added":
+		for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+			t, err := time.Parse(layout, s)
+			if err != nil {
+				continue
+			}
+			switch layout {
+			case "2006":
+				return t, t.AddDate(1, 0, 0), nil
+			case "2006-01":
+				return t, t.AddDate(0, 1, 0), nil
+			}
+			return t, t.AddDate(0, 0, 1), nil
+		}
+		return nil, nil, errors.New("invalid date")
+
+	case "year":
+		y, err := strconv.Atoi(s)
+		if err != nil || y < 0 || y > 9999 {
+			return nil, nil, errors.New("invalid year")
+		}
+		t := time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+		return t, t.AddDate(1, 0, 0), nil
+
+	case "size":
+		i := strings.IndexFunc(s, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		})
+		if i < 0 {
+			i = len(s)
+		}
+		n, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		unit, ok := sizeUnits[strings.ToLower(s[i:])]
+		if !ok {
+			return nil, nil, errors.New("unknown unit")
+		}
+		size := int64(math.Round(n * unit))
+		return size, size + 1, nil
+	}
+	return nil, nil, errors.New("not a range field")
+}
+
+func less(a, b interface{}) bool {
+	switch av := a.(type) {
+	case time.Time:
+		return av.Before(b.(time.Time))
+	case int64:
+		return av < b.(int64)
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// spellingFields are the fields whose terms can get spelling suggestions, empty is free text
+var spellingFields = map[string]bool{
+	"":       true,
+	"author": true,
+	"title":  true,
+	"series": true,
+}
+
+// Prune removes terms that can never match anything because they hold no letters or digits, it returns nil when nothing is left
+func Prune(n Node) Node {
+	switch v := n.(type) {
+	case *Term:
+		if strings.IndexFunc(v.Value, isWordRune) < 0 {
+			return nil
+		}
+	case *And:
+		nodes := pruneAll(v.Nodes)
+		if len(nodes) == 0 {
+			return nil
+		}
+		if len(nodes) == 1 {
+			return nodes[0]
+		}
+		return &And{Nodes: nodes}
+	case *Or:
+		nodes := pruneAll(v.Nodes)
+		if len(nodes) == 0 {
+			return nil
+		}
+		if len(nodes) == 1 {
+			return nodes[0]
+		}
+		return &Or{Nodes: nodes}
+	case *Not:
+		inner := Prune(v.Node)
+		if inner == nil {
+			return nil
+		}
+		return &Not{Node: inner}
+	}
+	return n
+}
+
+func pruneAll(nodes []Node) []Node {
+	var out []Node
+	for _, n := range nodes {
+		if p := Prune(n); p != nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Correctable returns the single word terms of n that may get a spelling suggestion,
+// terms that should not match and phrases or prefixes are left alone
+func Correctable(n Node) []*Term {
+	switch v := n.(type) {
+	case *Term:
+		if spellingFields[v.Field] && !v.Phrase && !v.Prefix && utf8.RuneCountInString(v.Value) >= 3 &&
+			strings.IndexFunc(v.Value, func(r rune) bool { return !isWordRune(r) }) < 0 {
+			return []*Term{v}
+		}
+	case *And:
+		var terms []*Term
+		for _, n := range v.Nodes {
+			terms = append(terms, Correctable(n)...)
+		}
+		return terms
+	case *Or:
+		var terms []*Term
+		for _, n := range v.Nodes {
+			terms = append(terms, Correctable(n)...)
+		}
+		return terms
+	}
+	return nil
+}
+
+// Edit replaces the bytes Start up to End of a query with Text
+type Edit struct {
+	Start, End int
+	Text       string
+}
+
+// Replace returns the value of t in q replaced with text
+func (t *Term) Replace(text string) Edit {
+	return Edit{Start: t.ValuePos, End: t.ValuePos + len(t.Value), Text: text}
+}
+
+// Rewrite applies edits to q, the edits have to be in the order they appear in q
+func Rewrite(q string, edits []Edit) string {
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		b.WriteString(q[last:e.Start])
+		b.WriteString(e.Text)
+		last = e.End
+	}
+	b.WriteString(q[last:])
+	return b.String()
+}
+
+// Closest returns the candidate that is the fewest edits away from word, candidates map a word to the number
+// of books it is found in which breaks ties. It returns an empty string when no candidate is close enough.
+func Closest(word string, candidates map[string]int64) string {
+	maxDistance := 2
+	if utf8.RuneCountInString(word) <= 4 {
+		maxDistance = 1
+	}
+	var best string
+	var bestDocs int64
+	bestDistance := maxDistance + 1
+	for c, docs := range candidates {
+		d := Distance(word, c)
+		if d > maxDistance {
+			continue
+		}
+		if d < bestDistance || d == bestDistance && (docs > bestDocs || docs == bestDocs && c < best) {
+			best, bestDocs, bestDistance = c, docs, d
+		}
+	}
+	return best
+}
+
+// Distance returns the number of single letter insertions, deletions and substitutions needed to turn a into b
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// Trigrams returns every run of three letters in word, the candidates for a correction share at least one of them
+func Trigrams(word string) []string {
+	runes := []rune(word)
+	var trigrams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		trigrams = append(trigrams, string(runes[i:i+3]))
+	}
+	return trigrams
+}
@@ -0,0 +1,87 @@
+package query
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "dickens", b: "dickens", want: 0},
+		{a: "dikens", b: "dickens", want: 1},
+		{a: "tolkein", b: "tolkien", want: 2},
+		{a: "bjork", b: "bjørk", want: 1},
+		{a: "", b: "abc", want: 3},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	candidates := map[string]int64{
+		"dickens": 10,
+		"dickins": 1,
+		"tolkien": 5,
+		"lewis":   5,
+	}
+	tests := []struct {
+		word string
+		want string
+	}{
+		{word: "dikens", want: "dickens"},
+		{word: "dickans", want: "dickens"},
+		{word: "tolkein", want: "tolkien"},
+		{word: "lwis", want: "lewis"},
+		{word: "lws", want: ""},
+		{word: "pratchett", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Closest(tt.word, candidates); got != tt.want {
+			t.Errorf("Closest(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestCorrectableRewrite(t *testing.T) {
+	tests := []struct {
+		q    string
+		fix  map[string]string
+		want string
+	}{
+		{
+			q:    "dikens",
+			fix:  map[string]string{"dikens": "dickens"},
+			want: "dickens",
+		},
+		{
+			q:    `author:stokr title:"dracula" -title:drakula`,
+			fix:  map[string]string{"stokr": "stoker", "dracula": "x", "drakula": "x"},
+			want: `author:stoker title:"dracula" -title:drakula`,
+		},
+		{
+			q:    "(tolkein OR lewis) lang:en tolk*",
+			fix:  map[string]string{"tolkein": "tolkien", "en": "x", "tolk": "x"},
+			want: "(tolkien OR lewis) lang:en tolk*",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			n, err := Parse(tt.q)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.q, err)
+			}
+			var edits []Edit
+			for _, term := range Correctable(n) {
+				if fix, ok := tt.fix[term.Value]; ok {
+					edits = append(edits, term.Replace(fix))
+				}
+			}
+			if got := Rewrite(tt.q, edits); got != tt.want {
+				t.Errorf("Rewrite() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package booksing
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReadingStatus is where a user is with a book
+type ReadingStatus string
+
+const (
+	StatusWantToRead ReadingStatus = "want-to-read"
+	StatusReading    ReadingStatus = "reading"
+	StatusFinished   ReadingStatus = "finished"
+	StatusAbandoned  ReadingStatus = "abandoned"
+
+	// StatusUnread is only used for filtering, it matches books that have no reading state or are only on the want-to-read list
+	StatusUnread ReadingStatus = "unread"
+)
+
+// ReadingStatuses lists all statuses that can be stored, in the order they are shown
+var ReadingStatuses = []ReadingStatus{
+	StatusWantToRead,
+	StatusReading,
+	StatusFinished,
+	StatusAbandoned,
+}
+
+// Valid reports whether s can be stored as a reading state
+func (s ReadingStatus) Valid() bool {
+	for _, v := range ReadingStatuses {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadingState is the private reading history of a single user for a single book
+type ReadingState struct {
+	gorm.Model
+	User     string        `gorm:"uniqueIndex:idx_reading_user_book"`
+	BookID   uint          `gorm:"uniqueIndex:idx_reading_user_book"`
+	Status   ReadingStatus `gorm:"index"`
+	Started  time.Time
+	Finished time.Time `gorm:"index"`
+	Rating   int
+	Note     string
+}
@@ -0,0 +1,69 @@
+package booksing
+
+// HashAlias leads a hash a work had before a rehash to the hash it has now
+type HashAlias struct {
+	Hash string `gorm:"primaryKey"`
+	Book string `gorm:"index"`
+}
+
+// RehashGroup are the books that get the same new hash in a rehash
+type RehashGroup struct {
+	Hash string
+	// Books are the ids of the books whose hash changes to Hash
+	Books []uint
+	// Aliases are the old hashes that lead to Hash now, everything that referred to them moves to Hash
+	Aliases []string
+	// Existing is set when a book already had Hash, so the aliases join an existing work
+	Existing bool
+}
+
+// Merged returns the number of works that became part of another work
+func (g RehashGroup) Merged() int {
+	if g.Existing {
+		return len(g.Aliases)
+	}
+	return len(g.Aliases) - 1
+}
+
+// RehashResult counts what a rehash changed
+type RehashResult struct {
+	// Rehashed is the number of books that got a new hash
+	Rehashed int
+	// Merged is the number of works that turned out to be the same as another work and now share its hash
+	Merged int
+}
+
+// PlanRehash hashes books with the current HashVersion and groups the books that get a new hash on that hash.
+// An old hash that no book keeps becomes an alias of the new hash of the first book that had it.
+func PlanRehash(books []Book) []RehashGroup {
+	newHash := make([]string, len(books))
+	kept := make(map[string]bool)
+	for i, b := range books {
+		newHash[i] = HashBook(b.Author, b.Title)
+		if newHash[i] == b.Hash {
+			kept[b.Hash] = true
+		}
+	}
+
+	var plan []RehashGroup
+	groups := make(map[string]int)
+	aliased := make(map[string]bool)
+	for i, b := range books {
+		h := newHash[i]
+		if h == b.Hash {
+			continue
+		}
+		g, ok := groups[h]
+		if !ok {
+			g = len(plan)
+			groups[h] = g
+			plan = append(plan, RehashGroup{Hash: h, Existing: kept[h]})
+		}
+		plan[g].Books = append(plan[g].Books, b.ID)
+		if !kept[b.Hash] && !aliased[b.Hash] {
+			aliased[b.Hash] = true
+			plan[g].Aliases = append(plan[g].Aliases, b.Hash)
+		}
+	}
+	return plan
+}
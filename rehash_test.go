@@ -0,0 +1,36 @@
+package booksing
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestPlanRehash(t *testing.T) {
+	books := []Book{
+		{Model: gorm.Model{ID: 1}, Hash: "bjrkdejongenindesneeuw", Author: "Samuel Bjørk", Title: "De Jongen In De Sneeuw"},
+		{Model: gorm.Model{ID: 2}, Hash: "bjorkdejongenindesneeuweenthriller", Author: "Samuel Bjork", Title: "De jongen in de sneeuw: een thriller"},
+		{Model: gorm.Model{ID: 3}, Hash: "bjrkdejongenindesneeuw", Author: "Samuel Bjørk", Title: "De Jongen In De Sneeuw"},
+		{Model: gorm.Model{ID: 4}, Hash: "herbertdune", Author: "Frank Herbert", Title: "Dune"},
+		{Model: gorm.Model{ID: 5}, Hash: "herbertdunenovel", Author: "Frank Herbert", Title: "Dune - a novel"},
+	}
+
+	want := []RehashGroup{
+		{Hash: "bjorkdejongenindesneeuw", Books: []uint{1, 2, 3}, Aliases: []string{"bjrkdejongenindesneeuw", "bjorkdejongenindesneeuweenthriller"}},
+		{Hash: "herbertdune", Books: []uint{5}, Aliases: []string{"herbertdunenovel"}, Existing: true},
+	}
+	got := PlanRehash(books)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PlanRehash() = %+v, want %+v", got, want)
+	}
+	for i, merged := range []int{1, 1} {
+		if got[i].Merged() != merged {
+			t.Errorf("PlanRehash()[%d].Merged() = %d, want %d", i, got[i].Merged(), merged)
+		}
+	}
+
+	if plan := PlanRehash(books[3:4]); plan != nil {
+		t.Errorf("PlanRehash() of a book with a current hash = %+v, want nothing", plan)
+	}
+}
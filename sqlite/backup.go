@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gnur/booksing/migrate"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Backup writes a consistent copy of the database to path, which must not exist yet.
+// It is safe to run while booksing is importing books.
+func (db *liteDB) Backup(path string) error {
+	return db.db.Exec("VACUUM INTO ?", path).Error
+}
+
+// Restore replaces booksing.db in dir with the backup at src and returns where the replaced database is kept, as
+// booksing.db.pre-restore-<time>.bak so a second restore does not replace it. It is empty when there was no database.
+// The backup has to be an intact booksing database with a schema this version knows, older schemas are migrated on the next start.
+// Booksing must not be running while the database is restored.
+func Restore(dir, src string) (string, error) {
+	err := checkBackup(src)
+	if err != nil {
+		return "", fmt.Errorf("%s can not be restored: %w", src, err)
+	}
+
+	current := filepath.Join(dir, "booksing.db")
+	for _, suffix := range []string{"-journal", "-wal"} {
+		if _, err := os.Stat(current + suffix); err == nil {
+			return "", fmt.Errorf("%s%s exists, booksing is still running or was not stopped cleanly", current, suffix)
+		}
+	}
+	kept := current + ".pre-restore-" + time.Now().Format("20060102-150405.000") + ".bak"
+	if _, err := os.Lstat(kept); err == nil {
+		return "", fmt.Errorf("%s exists already", kept)
+	}
+
+	// copy next to the database first, so the swap itself is a rename within a single directory. A copy that is
+	// there already is left by a restore that did not finish.
+	tmp := current + ".restore"
+	err = os.Remove(tmp)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	err = copyFile(src, tmp)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(current, kept)
+	if os.IsNotExist(err) {
+		kept, err = "", nil
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return kept, os.Rename(tmp, current)
+}
+
+// checkBackup opens the backup at path read only and verifies it is a booksing database that can be migrated
+func checkBackup(path string) error {
+	db, err := gorm.Open(sqlite.Dialector{DriverName: driverName, DSN: fileDSN(path, "mode=ro")}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	var integrity string
+	err = db.Raw("PRAGMA integrity_check").Scan(&integrity).Error
+	if err != nil {
+		return err
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("integrity check failed: %s", integrity)
+	}
+
+	if !db.Migrator().HasTable("books") {
+		return errors.New("it is not a booksing database")
+	}
+	ms, err := migrations()
+	if err != nil {
+		return err
+	}
+	version, err := migrate.Version(db)
+	if err != nil {
+		return err
+	}
+	if version > len(ms) {
+		return fmt.Errorf("it has schema version %d, this booksing only knows up to version %d", version, len(ms))
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
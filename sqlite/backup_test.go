@@ -0,0 +1,112 @@
+//go:build fts5
+
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gnur/booksing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	// a ? or # in a path is part of the name
+	dir := filepath.Join(t.TempDir(), "db?#1")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(dir)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := db.AddBook(booksing.Book{Hash: "tolkienhobbit", Title: "The Hobbit", Author: "J.R.R. Tolkien"}); err != nil {
+		t.Fatalf("AddBook() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "booksing.db")); err != nil {
+		t.Fatalf("New() did not create the database in %s: %v", dir, err)
+	}
+
+	backup := filepath.Join(dir, "booksing-backup?.db")
+	if err := db.Backup(backup); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if err := db.Backup(backup); err == nil {
+		t.Errorf("Backup() over an existing file succeeded, want an error")
+	}
+
+	if err := db.AddBook(booksing.Book{Hash: "lewislion", Title: "The Lion, the Witch and the Wardrobe", Author: "C.S. Lewis"}); err != nil {
+		t.Fatalf("AddBook() error = %v", err)
+	}
+	db.Close()
+
+	// a restore that did not finish left its copy behind
+	if err := os.WriteFile(filepath.Join(dir, "booksing.db.restore"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := Restore(dir, backup)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil || filepath.Dir(kept) != dir {
+		t.Errorf("the replaced database was not kept in %s: %v", kept, err)
+	}
+	// a second restore keeps the database the first one replaced
+	again, err := Restore(dir, backup)
+	if err != nil {
+		t.Fatalf("Restore() a second time error = %v", err)
+	}
+	if again == kept {
+		t.Errorf("Restore() a second time kept the replaced database as %s as well, want another name", kept)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("a second restore removed the database the first one replaced: %v", err)
+	}
+
+	restored, err := New(dir)
+	if err != nil {
+		t.Fatalf("New() of the restored database error = %v", err)
+	}
+	if n := restored.GetBookCount(); n != 1 {
+		t.Errorf("GetBookCount() of the restored database = %d, want 1", n)
+	}
+	res, err := restored.GetBooks(booksing.SearchQuery{Query: "hobbit", Limit: 10})
+	if err != nil || res.Total != 1 {
+		t.Errorf("GetBooks() on the restored database = %v, %v, want the hobbit", res, err)
+	}
+}
+
+func TestRestoreValidates(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := New(dir); err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	notADatabase := filepath.Join(t.TempDir(), "notes.db")
+	if err := os.WriteFile(notADatabase, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(dir, notADatabase); err == nil {
+		t.Errorf("Restore() of a text file succeeded, want an error")
+	}
+
+	newer, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := newer.db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', '2030-01-01 00:00:00')").Error; err != nil {
+		t.Fatal(err)
+	}
+	newerBackup := filepath.Join(t.TempDir(), "newer.db")
+	if err := newer.Backup(newerBackup); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if _, err := Restore(dir, newerBackup); err == nil {
+		t.Errorf("Restore() of a database with a newer schema succeeded, want an error")
+	}
+
+	if kept, _ := filepath.Glob(filepath.Join(dir, "booksing.db.pre-restore-*")); len(kept) > 0 {
+		t.Errorf("a rejected restore replaced the database, it is kept as %v", kept)
+	}
+}
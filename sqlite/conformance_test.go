@@ -0,0 +1,20 @@
+//go:build fts5
+
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) booksing.Database {
+		db, err := New(t.TempDir())
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return db
+	})
+}
@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gnur/booksing/gormdb"
+	"github.com/gnur/booksing/migrate"
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrations are the sql files in migrations/ together with the steps that need Go. completions, rehash, group_works
+// and normalize_languages are backfills with the current code of booksing, see the migrate package. The rehash runs
+// after book_ids, once editions of a work may share a hash.
+func migrations() ([]migrate.Migration, error) {
+	return migrate.Load(migrationFiles, "migrations",
+		migrate.Migration{Version: 2, Name: "missing_columns", Up: addMissingColumns},
+		migrate.Migration{Version: 3, Name: "search_index", Up: createSearchIndex(firstSearchColumns)},
+		migrate.Migration{Version: 4, Name: "completions", Up: func(tx *gorm.DB) error {
+			return (&liteDB{db: tx}).UpdateCompletionIndex()
+		}},
+		migrate.Migration{Version: 7, Name: "rehash", Up: gormdb.RehashBooks},
+		migrate.Migration{Version: 9, Name: "group_works", Up: gormdb.GroupWorks},
+		migrate.Migration{Version: 12, Name: "normalize_languages", Up: gormdb.NormalizeLanguages},
+		migrate.Migration{Version: 15, Name: "search_tags", Up: createSearchIndex(searchColumns)},
+		migrate.Migration{Version: 21, Name: "search_fold", Up: createSearchIndex(searchColumns)},
+	)
+}
+
+// addMissingColumns adds the columns that are missing from databases created by the first versions of booksing
+func addMissingColumns(tx *gorm.DB) error {
+	for _, c := range []struct {
+		table  string
+		column string
+	}{
+		{table: "books", column: "checksum"},
+		{table: "users", column: "sync_key"},
+	} {
+		if tx.Migrator().HasColumn(c.table, c.column) {
+			continue
+		}
+		err := tx.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` text", c.table, c.column)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Exec("CREATE INDEX IF NOT EXISTS `idx_books_checksum` ON `books`(`checksum`)").Error
+}
+
+// Migrations returns every migration of the schema and when it was applied
+func (db *liteDB) Migrations() ([]migrate.Status, error) {
+	ms, err := migrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Statuses(db.db, ms)
+}
+
+// Migrate applies the pending migrations, an existing database is copied to booksing.db.vNNNN.bak first
+// where NNNN is the version it had.
+func (db *liteDB) Migrate() error {
+	ms, err := migrations()
+	if err != nil {
+		return err
+	}
+	pending, err := migrate.Pending(db.db, ms)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	if db.db.Migrator().HasTable("books") {
+		version, err := migrate.Version(db.db)
+		if err != nil {
+			return err
+		}
+		path := db.backupPath(version)
+		// a copy of an earlier attempt at the same version is replaced
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		err = db.Backup(path)
+		if err != nil {
+			return fmt.Errorf("could not copy the database before migrating it: %w", err)
+		}
+	}
+
+	return migrate.Apply(db.db, ms)
+}
+
+// backupPath returns where Migrate copies the database to before migrating it from version
+func (db *liteDB) backupPath(version int) string {
+	return filepath.Join(db.dir, fmt.Sprintf("booksing.db.v%04d.bak", version))
+}
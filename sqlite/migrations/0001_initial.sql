@@ -0,0 +1,31 @@
+-- the schema as gorm created it before migrations existed, the tables of older databases are completed by 0002
+CREATE TABLE IF NOT EXISTS `books` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`hash` text,`title` text,`author` text,`language` text,`description` text,`added` datetime,`path` text,`size` integer,`has_cover` numeric,`cover_path` text,`publisher` text,`isbn` text,`series` text,`publish_date` datetime,`series_index` real,`checksum` text,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_books_hash` ON `books`(`hash`);
+CREATE INDEX IF NOT EXISTS `idx_books_deleted_at` ON `books`(`deleted_at`);
+CREATE INDEX IF NOT EXISTS `idx_books_series` ON `books`(`series`);
+CREATE INDEX IF NOT EXISTS `idx_books_size` ON `books`(`size`);
+CREATE INDEX IF NOT EXISTS `idx_books_added` ON `books`(`added`);
+CREATE INDEX IF NOT EXISTS `idx_books_language` ON `books`(`language`);
+CREATE INDEX IF NOT EXISTS `idx_books_author` ON `books`(`author`);
+
+CREATE TABLE IF NOT EXISTS `downloads` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`book` text,`user` text,`ip` text,`timestamp` datetime,PRIMARY KEY (`id`));
+CREATE INDEX IF NOT EXISTS `idx_downloads_user` ON `downloads`(`user`);
+CREATE INDEX IF NOT EXISTS `idx_downloads_deleted_at` ON `downloads`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `users` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text,`is_admin` numeric,`is_allowed` numeric,`downloads` integer,`created` datetime,`last_seen` datetime,`sync_key` text,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_name` ON `users`(`name`);
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `progresses` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`user` text,`document` text,`book` text,`progress` text,`percentage` real,`device` text,`device_id` text,`timestamp` datetime,PRIMARY KEY (`id`));
+CREATE INDEX IF NOT EXISTS `idx_progresses_book` ON `progresses`(`book`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_progress_user_document` ON `progresses`(`user`,`document`);
+CREATE INDEX IF NOT EXISTS `idx_progresses_deleted_at` ON `progresses`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `reading_states` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`user` text,`book` text,`status` text,`started` datetime,`finished` datetime,`rating` integer,`note` text,PRIMARY KEY (`id`));
+CREATE INDEX IF NOT EXISTS `idx_reading_states_finished` ON `reading_states`(`finished`);
+CREATE INDEX IF NOT EXISTS `idx_reading_states_status` ON `reading_states`(`status`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_reading_user_book` ON `reading_states`(`user`,`book`);
+CREATE INDEX IF NOT EXISTS `idx_reading_states_deleted_at` ON `reading_states`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `completions` (`kind` text,`key` text,`value` text,`books` integer);
+CREATE INDEX IF NOT EXISTS `idx_completion_lookup` ON `completions`(`kind`,`key`);
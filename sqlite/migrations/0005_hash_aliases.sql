@@ -0,0 +1,4 @@
+-- existing books were hashed with the first version of HashBook, a rehash keeps their old hashes as aliases
+ALTER TABLE `books` ADD COLUMN `hash_version` integer NOT NULL DEFAULT 1;
+CREATE TABLE `hash_aliases` (`hash` text,`book` text,PRIMARY KEY (`hash`));
+CREATE INDEX `idx_hash_aliases_book` ON `hash_aliases`(`book`);
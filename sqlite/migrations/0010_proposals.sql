@@ -0,0 +1,3 @@
+-- changes to books that external catalogs propose, until an admin approves or rejects them
+CREATE TABLE `proposals` (`id` integer,`created_at` datetime,`book` integer,`field` text,`current` text,`proposed` text,`source` text,PRIMARY KEY (`id`));
+CREATE INDEX `idx_proposals_book` ON `proposals`(`book`);
@@ -0,0 +1,3 @@
+-- whether the language of a book was declared by the book or detected from its text, books before this declared theirs
+ALTER TABLE `books` ADD COLUMN `language_source` text NOT NULL DEFAULT '';
+UPDATE `books` SET `language_source` = 'declared' WHERE `language` != '';
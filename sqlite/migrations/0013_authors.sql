@@ -0,0 +1,6 @@
+-- the names booksing uses for authors whose books come with several spellings, and those other spellings
+CREATE TABLE `authors` (`id` integer,`created_at` datetime,`name` text,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX `idx_authors_name` ON `authors`(`name`);
+CREATE TABLE `author_aliases` (`id` integer,`author_id` integer,`alias` text,`key` text,PRIMARY KEY (`id`));
+CREATE INDEX `idx_author_aliases_author_id` ON `author_aliases`(`author_id`);
+CREATE UNIQUE INDEX `idx_author_aliases_key` ON `author_aliases`(`key`);
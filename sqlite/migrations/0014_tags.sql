@@ -0,0 +1,6 @@
+-- tags are the subjects of books, book_tags links them to books and the tags column of books is what search indexes
+CREATE TABLE `tags` (`id` integer,`name` text,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX `idx_tags_name` ON `tags`(`name`);
+CREATE TABLE `book_tags` (`book_id` integer,`tag_id` integer,PRIMARY KEY (`book_id`,`tag_id`));
+CREATE INDEX `idx_book_tags_tag_id` ON `book_tags`(`tag_id`);
+ALTER TABLE `books` ADD COLUMN `tags` text NOT NULL DEFAULT '';
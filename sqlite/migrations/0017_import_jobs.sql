@@ -0,0 +1,5 @@
+-- every run of the import with its counters, and the outcome of every file it found
+CREATE TABLE `import_jobs` (`id` integer,`started` datetime,`finished` datetime,`found` integer,`parsed` integer,`added` integer,`duplicate` integer,`rejected` integer,`failed` integer,PRIMARY KEY (`id`));
+CREATE TABLE `import_files` (`id` integer,`import_job_id` integer,`path` text,`outcome` text,`message` text,`took` integer,PRIMARY KEY (`id`));
+CREATE INDEX `idx_import_files_import_job_id` ON `import_files`(`import_job_id`);
+CREATE INDEX `idx_import_files_path` ON `import_files`(`path`);
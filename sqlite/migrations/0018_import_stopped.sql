@@ -0,0 +1,2 @@
+-- import jobs can be stopped before they are done
+ALTER TABLE `import_jobs` ADD COLUMN `stopped` numeric NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- files that a stopped import did not read are counted as skipped
+ALTER TABLE `import_jobs` ADD COLUMN `skipped` integer NOT NULL DEFAULT 0;
@@ -0,0 +1,161 @@
+//go:build fts5
+
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/gormdb"
+	"gorm.io/gorm"
+)
+
+// legacySchema is a database as the first versions of booksing created it with AutoMigrate
+const legacySchema = "CREATE TABLE `books` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`hash` text,`title` text,`author` text,`language` text,`description` text,`added` datetime,`path` text,`size` integer,`has_cover` numeric,`cover_path` text,`publisher` text,`isbn` text,`series` text,`publish_date` datetime,`series_index` real,PRIMARY KEY (`id`));" +
+	"CREATE UNIQUE INDEX `idx_books_hash` ON `books`(`hash`);" +
+	"CREATE TABLE `downloads` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`book` text,`user` text,`ip` text,`timestamp` datetime,PRIMARY KEY (`id`));" +
+	"CREATE TABLE `users` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text,`is_admin` numeric,`is_allowed` numeric,`downloads` integer,`created` datetime,`last_seen` datetime,PRIMARY KEY (`id`));" +
+	"CREATE UNIQUE INDEX `idx_users_name` ON `users`(`name`);" +
+	"CREATE VIRTUAL TABLE search USING fts5(content=books, author, title, description, hash);" +
+	"CREATE TRIGGER books_ai AFTER INSERT ON books BEGIN INSERT INTO search(rowid, author, title, description) VALUES(new.rowid, new.author, new.title, new.description); END;" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('tolkienhobbit', 'The Hobbit', 'J.R.R. Tolkien', 'en', '2022-01-01 00:00:00+00:00');" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('bjrkdejongenindesneeuw', 'De Jongen In De Sneeuw', 'Samuel Bjørk', 'nl', '2022-02-01 00:00:00+00:00');" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('bjorkdejongenindesneeuweenthriller', 'De jongen in de sneeuw: een thriller', 'Samuel Bjork', 'nl', '2022-03-01 00:00:00+00:00');" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('vernevingtmillelieuessouslesmers', 'Vingt mille lieues sous les mers', 'Jules Verne', 'fre', '2022-04-01 00:00:00+00:00');" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('tolkienthelordoftherings', 'The Lord of the Rings', 'J.R.R. Tolkien', 'en-en', '2022-05-01 00:00:00+00:00');" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('pratchettguardsguards', 'Guards! Guards!', 'Terry Pratchett', 'us', '2022-06-01 00:00:00+00:00');" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('okrandtheklingondictionary', 'The Klingon Dictionary', 'Marc Okrand', 'klingonese', '2022-07-01 00:00:00+00:00');" +
+	"INSERT INTO books (hash, title, author, language, added) VALUES ('zhadanvoroshylovhrad', 'Voroshylovhrad', 'Serhiy Zhadan', 'uk', '2022-08-01 00:00:00+00:00');" +
+	"INSERT INTO users (name, is_allowed) VALUES ('alice', 1);" +
+	"INSERT INTO downloads (book, user, timestamp) VALUES ('tolkienhobbit', 'alice', '2022-09-01 00:00:00+00:00');" +
+	"INSERT INTO downloads (book, user, timestamp) VALUES ('bjorkdejongenindesneeuweenthriller', 'alice', '2022-09-02 00:00:00+00:00');"
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	legacy, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := legacy.db.Exec(legacySchema).Error; err != nil {
+		t.Fatalf("creating the legacy schema failed: %v", err)
+	}
+
+	statuses, err := legacy.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied.IsZero() {
+			t.Errorf("migration %d of a legacy database is applied, want it pending", s.Version)
+		}
+	}
+
+	db, err := New(dir)
+	if err != nil {
+		t.Fatalf("New() of a legacy database error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "booksing.db.v0000.bak")); err != nil {
+		t.Errorf("no copy of the database was made before migrating: %v", err)
+	}
+
+	statuses, err = db.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	for _, s := range statuses {
+		if s.Applied.IsZero() {
+			t.Errorf("migration %d (%s) is not applied", s.Version, s.Name)
+		}
+	}
+
+	if err := db.SetChecksum(1, "abc123"); err != nil {
+		t.Errorf("SetChecksum() on a migrated database error = %v", err)
+	}
+	// both editions of the same work survive the rehash with the hash of the work, their old hashes lead to it
+	work := booksing.HashBook("Samuel Bjork", "De jongen in de sneeuw")
+	for _, id := range []uint{2, 3} {
+		if b, err := db.GetBook(id); err != nil || b.Hash != work {
+			t.Errorf("GetBook(%d) of a migrated database = %v, %v, want hash %s", id, b.Hash, err, work)
+		}
+	}
+	if hash, err := db.ResolveHash("bjorkdejongenindesneeuweenthriller"); err != nil || hash != work {
+		t.Errorf("ResolveHash() of a merged book = %q, %v, want %s", hash, err, work)
+	}
+	if b, err := db.GetBook(4); err != nil || b.Language != "fr" {
+		t.Errorf("GetBook(4) of a migrated database = %q, %v, want the language normalized to fr", b.Language, err)
+	}
+	// legacy spellings of English stay English, uk stays Ukrainian and a language FixLang does not know is left as it is
+	for id, want := range map[uint]string{5: "en", 6: "en", 7: "klingonese", 8: "uk"} {
+		if b, err := db.GetBook(id); err != nil || b.Language != want {
+			t.Errorf("GetBook(%d) of a migrated database = %q, %v, want language %s", id, b.Language, err, want)
+		}
+	}
+	if hash, err := db.ResolveHash("tolkienhobbit"); err != nil || hash != booksing.HashBook("J.R.R. Tolkien", "The Hobbit") {
+		t.Errorf("ResolveHash() of a legacy hash = %q, %v", hash, err)
+	}
+	// downloads refer to the first edition with the hash they had, or with the hash it was rehashed to
+	if dls, err := db.GetDownloads(10); err != nil || len(dls) != 2 || dls[0].BookID != 2 || dls[1].BookID != 1 {
+		t.Errorf("GetDownloads() of a migrated database = %+v, %v, want downloads of book 2 and 1", dls, err)
+	}
+	u, err := db.GetUser("alice")
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if err := u.SetSyncKey("secret"); err != nil {
+		t.Fatalf("SetSyncKey() error = %v", err)
+	}
+	if err := db.SaveUser(&u); err != nil {
+		t.Errorf("SaveUser() with a sync key on a migrated database error = %v", err)
+	}
+
+	res, err := db.GetBooks(booksing.SearchQuery{Query: "author:tolkien", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetBooks() error = %v", err)
+	}
+	if res.Total != 2 {
+		t.Errorf("GetBooks() found %d books, want the existing books in the new search index", res.Total)
+	}
+	c, err := db.Complete("tolk", 5)
+	if err != nil || len(c.Authors) != 1 {
+		t.Errorf("Complete() = %+v, %v, want the existing author", c, err)
+	}
+
+	// the backfills use the current code of booksing, running them again changes nothing
+	type row struct {
+		ID       uint
+		Hash     string
+		Language string
+		WorkID   uint
+	}
+	var before, after []row
+	if err := db.db.Unscoped().Model(&booksing.Book{}).Order("id").Find(&before).Error; err != nil || len(before) != 8 || before[0].WorkID == 0 {
+		t.Fatalf("reading the books of a migrated database = %v, %v", before, err)
+	}
+	for _, backfill := range []func(*gorm.DB) error{gormdb.RehashBooks, gormdb.GroupWorks, gormdb.NormalizeLanguages, func(tx *gorm.DB) error {
+		return (&liteDB{db: tx}).UpdateCompletionIndex()
+	}} {
+		if err := backfill(db.db); err != nil {
+			t.Fatalf("running a backfill again error = %v", err)
+		}
+	}
+	db.db.Unscoped().Model(&booksing.Book{}).Order("id").Find(&after)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("running the backfills again changed the books from %v to %v", before, after)
+	}
+
+	// an up to date database is neither migrated nor copied again
+	if err := os.Remove(filepath.Join(dir, "booksing.db.v0000.bak")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() of an up to date database error = %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.bak"))
+	if len(matches) != 0 {
+		t.Errorf("Migrate() of an up to date database made copies %v", matches)
+	}
+}
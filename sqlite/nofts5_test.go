@@ -0,0 +1,11 @@
+//go:build !fts5
+
+package sqlite
+
+import "testing"
+
+// TestConformance only reports that the sqlite tests did not run, the search index of booksing needs the fts5
+// extension of sqlite
+func TestConformance(t *testing.T) {
+	t.Skip("the sqlite tests need fts5, run them with go test -tags fts5 ./...")
+}
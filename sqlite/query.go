@@ -0,0 +1,272 @@
+package sqlite
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/query"
+	"gorm.io/gorm"
+)
+
+// ftsColumns are the fields that are part of the full text index
+var ftsColumns = map[string]bool{
+	"":            true,
+	"author":      true,
+	"title":       true,
+	"description": true,
+	"series":      true,
+	"publisher":   true,
+}
+
+// taggedBooks selects the ids of books by the name of their tags
+const taggedBooks = "SELECT book_tags.book_id FROM book_tags JOIN tags ON tags.id = book_tags.tag_id"
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type condition struct {
+	sql  string
+	args []interface{}
+}
+
+// compiled is a parsed search query translated into an FTS5 MATCH expression and plain sql conditions
+type compiled struct {
+	match string
+	where []condition
+}
+
+func (c *compiled) scope(tx *gorm.DB) *gorm.DB {
+	if c.match != "" {
+		tx = tx.Joins("JOIN search ON search.rowid = books.id").Where("search MATCH ?", c.match)
+	}
+	for _, w := range c.where {
+		tx = tx.Where(w.sql, w.args...)
+	}
+	return tx
+}
+
+func compile(q string, n query.Node) (*compiled, error) {
+	n = query.Prune(n)
+	if n == nil {
+		return nil, &query.Error{Query: q, Msg: "nothing to search for"}
+	}
+
+	nodes := []query.Node{n}
+	if and, ok := n.(*query.And); ok {
+		nodes = and.Nodes
+	}
+
+	var c compiled
+	var match []string
+	for _, n := range nodes {
+		if ftsable(n) {
+			match = append(match, ftsExpr(n))
+			continue
+		}
+		sql, args, err := sqlExpr(q, n)
+		if err != nil {
+			return nil, err
+		}
+		c.where = append(c.where, condition{sql: sql, args: args})
+	}
+	c.match = strings.Join(match, " AND ")
+
+	return &c, nil
+}
+
+// ftsable reports whether n can be expressed in a single MATCH expression,
+// FTS5 only has a binary NOT so negations are always handled in sql.
+func ftsable(n query.Node) bool {
+	switch v := n.(type) {
+	case *query.Term:
+		return ftsColumns[v.Field]
+	case *query.And:
+		return allFtsable(v.Nodes)
+	case *query.Or:
+		return allFtsable(v.Nodes)
+	}
+	return false
+}
+
+func allFtsable(nodes []query.Node) bool {
+	for _, n := range nodes {
+		if !ftsable(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func ftsExpr(n query.Node) string {
+	switch v := n.(type) {
+	case *query.Term:
+		s := `"` + strings.ReplaceAll(foldSearch.Replace(v.Value), `"`, `""`) + `"`
+		if v.Prefix {
+			s += " *"
+		}
+		if v.Field != "" {
+			s = v.Field + " : " + s
+		}
+		return s
+	case *query.And:
+		return "(" + joinFts(v.Nodes, " AND ") + ")"
+	case *query.Or:
+		return "(" + joinFts(v.Nodes, " OR ") + ")"
+	}
+	return ""
+}
+
+func joinFts(nodes []query.Node, sep string) string {
+	var parts []string
+	for _, n := range nodes {
+		parts = append(parts, ftsExpr(n))
+	}
+	return strings.Join(parts, sep)
+}
+
+func sqlExpr(q string, n query.Node) (string, []interface{}, error) {
+	switch v := n.(type) {
+	case *query.Term:
+		return termExpr(q, v)
+	case *query.Range:
+		return rangeExpr(v)
+	case *query.Not:
+		sql, args, err := sqlExpr(q, v.Node)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + sql + ")", args, nil
+	case *query.And:
+		return joinSQL(q, v.Nodes, " AND ")
+	case *query.Or:
+		return joinSQL(q, v.Nodes, " OR ")
+	}
+	return "", nil, &query.Error{Query: q, Msg: "unsupported search"}
+}
+
+func joinSQL(q string, nodes []query.Node, sep string) (string, []interface{}, error) {
+	var parts []string
+	var args []interface{}
+	for _, n := range nodes {
+		sql, a, err := sqlExpr(q, n)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		args = append(args, a...)
+	}
+	return "(" + strings.Join(parts, sep) + ")", args, nil
+}
+
+func termExpr(q string, t *query.Term) (string, []interface{}, error) {
+	if ftsColumns[t.Field] {
+		return "books.id IN (SELECT rowid FROM search WHERE search MATCH ?)", []interface{}{ftsExpr(t)}, nil
+	}
+
+	value := t.Value
+	switch t.Field {
+	case "language":
+		// a language booksing does not know is searched for as it is
+		if lang := booksing.FixLang(value); !t.Prefix && lang != "" {
+			value = lang
+		}
+	case "isbn":
+		value = strings.NewReplacer("-", "", " ", "").Replace(value)
+	case "tag":
+		// tags are stored by their TagName, which is lower case already
+		value = booksing.TagName(value)
+		if t.Prefix {
+			return "books.id IN (" + taggedBooks + ` WHERE tags.name LIKE ? ESCAPE '\')`, []interface{}{likeEscaper.Replace(value) + "%"}, nil
+		}
+		return "books.id IN (" + taggedBooks + " WHERE tags.name = ?)", []interface{}{value}, nil
+	default:
+		return "", nil, &query.Error{Query: q, Pos: t.Pos, Msg: "searching by " + t.Field + " is not supported yet"}
+	}
+
+	if t.Prefix {
+		return "books." + t.Field + ` LIKE ? ESCAPE '\'`, []interface{}{likeEscaper.Replace(value) + "%"}, nil
+	}
+	return "books." + t.Field + " = ? COLLATE NOCASE", []interface{}{value}, nil
+}
+
+func rangeExpr(r *query.Range) (string, []interface{}, error) {
+	column := map[string]string{
+		"added": "books.added",
+		"year":  "books.publish_date",
+		"size":  "books.size",
+	}[r.Field]
+
+	var parts []string
+	var args []interface{}
+	if r.Min != nil {
+		parts = append(parts, column+" >= ?")
+		args = append(args, r.Min)
+	} else if r.Field == "year" {
+		// books without a known publish date should not match an open ended range
+		parts = append(parts, column+" > ?")
+		args = append(args, time.Time{})
+	}
+	if r.Max != nil {
+		parts = append(parts, column+" < ?")
+		args = append(args, r.Max)
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", args, nil
+}
+
+// sortOrder returns the order by clause for the requested sort, every order ends with the id
+// so books that compare equal always come back in the same order and paging never skips or repeats them
+func sortOrder(sort string, c *compiled) string {
+	if sort == "" || sort == "relevance" {
+		if c.match != "" {
+			// weigh matches in the author and title far heavier than in the description, weights follow searchColumns
+			return "bm25(search, 5.0, 10.0, 1.0, 3.0, 1.0, 0.0, 0.0, 0.0, 2.0), books.id DESC"
+		}
+		sort = "added"
+	}
+
+	switch sort {
+	case "title":
+		return "books.title COLLATE NOCASE, books.author COLLATE NOCASE, books.id"
+	case "author":
+		return "books.author COLLATE NOCASE, books.title COLLATE NOCASE, books.id"
+	case "published":
+		return "books.publish_date DESC, books.id DESC"
+	case "size":
+		return "books.size DESC, books.id DESC"
+	case "series":
+		return "books.series = '', books.series COLLATE NOCASE, books.series_index, books.id"
+	}
+	return newestFirst
+}
+
+// newestFirst is the order that supports keyset cursors
+const newestFirst = "books.added DESC, books.id DESC"
+
+// afterCursor limits newest first results to the books that come after the cursor
+func afterCursor(added time.Time, id uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("books.added < ? OR (books.added = ? AND books.id < ?)", added, added, id)
+	}
+}
+
+// facetFilter limits a book query to the facets selected in the search
+func facetFilter(sq booksing.SearchQuery) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if sq.Language != "" {
+			tx = tx.Where("books.language = ?", sq.Language)
+		}
+		if sq.Series != "" {
+			tx = tx.Where("books.series = ?", sq.Series)
+		}
+		if sq.Publisher != "" {
+			tx = tx.Where("books.publisher = ?", sq.Publisher)
+		}
+		if sq.HasCover {
+			tx = tx.Where("books.has_cover = ?", true)
+		}
+		if !sq.AddedSince.IsZero() {
+			tx = tx.Where("books.added >= ?", sq.AddedSince)
+		}
+		return tx
+	}
+}
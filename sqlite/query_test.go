@@ -0,0 +1,165 @@
+package sqlite
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gnur/booksing/query"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     string
+		match string
+		where []condition
+	}{
+		{
+			name:  "free text",
+			q:     "lord rings",
+			match: `"lord" AND "rings"`,
+		},
+		{
+			name:  "letters without an accent to remove are folded like the index",
+			q:     "author:Bjørk zafón",
+			match: `author : "Bjork" AND "zafón"`,
+		},
+		{
+			name:  "fts fields, phrases and prefixes",
+			q:     `author:tolk* title:"the hobbit"`,
+			match: `author : "tolk" * AND title : "the hobbit"`,
+		},
+		{
+			name:  "or inside the index",
+			q:     "tolkien OR lewis",
+			match: `("tolkien" OR "lewis")`,
+		},
+		{
+			name:  "apostrophes need no escaping",
+			q:     "title:it's",
+			match: `title : "it's"`,
+		},
+		{
+			name:  "negation",
+			q:     "tolkien -hobbit",
+			match: `"tolkien"`,
+			where: []condition{
+				{sql: "NOT (books.id IN (SELECT rowid FROM search WHERE search MATCH ?))", args: []interface{}{`"hobbit"`}},
+			},
+		},
+		{
+			name:  "series and language",
+			q:     `series:"Song of Ice and Fire" lang:dutch`,
+			match: `series : "Song of Ice and Fire"`,
+			where: []condition{
+				{sql: "books.language = ? COLLATE NOCASE", args: []interface{}{"nl"}},
+			},
+		},
+		{
+			name:  "language prefix is escaped",
+			q:     "lang:e_*",
+			match: "",
+			where: []condition{
+				{sql: `books.language LIKE ? ESCAPE '\'`, args: []interface{}{`e\_%`}},
+			},
+		},
+		{
+			name:  "isbn is normalized",
+			q:     "isbn:978-0-261-10235-4",
+			match: "",
+			where: []condition{
+				{sql: "books.isbn = ? COLLATE NOCASE", args: []interface{}{"9780261102354"}},
+			},
+		},
+		{
+			name:  "tags by name and by prefix",
+			q:     `tag:"Science  Fiction" tag:fant*`,
+			match: "",
+			where: []condition{
+				{sql: "books.id IN (" + taggedBooks + " WHERE tags.name = ?)", args: []interface{}{"science fiction"}},
+				{sql: "books.id IN (" + taggedBooks + ` WHERE tags.name LIKE ? ESCAPE '\')`, args: []interface{}{"fant%"}},
+			},
+		},
+		{
+			name:  "series in the index",
+			q:     "author:tolkien OR series:discworld",
+			match: `(author : "tolkien" OR series : "discworld")`,
+		},
+		{
+			name:  "mixed or",
+			q:     "author:tolkien OR isbn:9780261102354",
+			match: "",
+			where: []condition{
+				{sql: "(books.id IN (SELECT rowid FROM search WHERE search MATCH ?) OR books.isbn = ? COLLATE NOCASE)", args: []interface{}{`author : "tolkien"`, "9780261102354"}},
+			},
+		},
+		{
+			name:  "ranges",
+			q:     "size:<5MB year:1990..2000",
+			match: "",
+			where: []condition{
+				{sql: "(books.size < ?)", args: []interface{}{int64(5 << 20)}},
+				{sql: "(books.publish_date >= ? AND books.publish_date < ?)", args: []interface{}{
+					time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+					time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+				}},
+			},
+		},
+		{
+			name:  "open ended year excludes unknown dates",
+			q:     "year:<1900",
+			match: "",
+			where: []condition{
+				{sql: "(books.publish_date > ? AND books.publish_date < ?)", args: []interface{}{time.Time{}, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			},
+		},
+		{
+			name:  "punctuation only terms are ignored",
+			q:     "jean - paul",
+			match: `"jean" AND "paul"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := query.Parse(tt.q)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.q, err)
+			}
+			c, err := compile(tt.q, n)
+			if err != nil {
+				t.Fatalf("compile(%q) error = %v", tt.q, err)
+			}
+			if c.match != tt.match {
+				t.Errorf("compile(%q) match = %v, want %v", tt.q, c.match, tt.match)
+			}
+			if !reflect.DeepEqual(c.where, tt.where) {
+				t.Errorf("compile(%q) where = %#v, want %#v", tt.q, c.where, tt.where)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		q   string
+		pos int
+		msg string
+	}{
+		{q: "- ,", pos: 0, msg: "nothing to search for"},
+	}
+	for _, tt := range tests {
+		n, err := query.Parse(tt.q)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.q, err)
+		}
+		_, err = compile(tt.q, n)
+		qe, ok := err.(*query.Error)
+		if !ok {
+			t.Fatalf("compile(%q) error = %v, want a *query.Error", tt.q, err)
+		}
+		if qe.Pos != tt.pos || qe.Msg != tt.msg {
+			t.Errorf("compile(%q) error = %q at %d, want %q at %d", tt.q, qe.Msg, qe.Pos, tt.msg, tt.pos)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gnur/booksing"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// searchColumns are the columns of the books table that are part of the full text index, in index order
+var searchColumns = append(firstSearchColumns, "tags")
+
+// firstSearchColumns are the columns the first version of the index had, before books had tags
+var firstSearchColumns = []string{"author", "title", "description", "series", "publisher", "isbn", "language", "hash"}
+
+// foldedColumns are indexed with the letters of foldLetters folded, the tokenizer removes the other accents,
+// so accents never have to match
+var foldedColumns = map[string]bool{
+	"author":      true,
+	"title":       true,
+	"description": true,
+	"series":      true,
+	"publisher":   true,
+	"tags":        true,
+}
+
+// foldLetters are the latin letters booksing.NormalizeSearch folds that have no accent the tokenizer could remove,
+// like ø and ß. They are folded with plain sql, so the index works in every client of the database.
+var foldLetters = latinFolds()
+
+// foldSearch folds the letters of foldLetters in a search, like the index does
+var foldSearch = strings.NewReplacer(flatten(foldLetters)...)
+
+func latinFolds() [][2]string {
+	var folds [][2]string
+	for _, block := range [][2]rune{{0x00C0, 0x024F}, {0x1E00, 0x1EFF}} {
+		for r := block[0]; r <= block[1]; r++ {
+			s := string(r)
+			if n := booksing.NormalizeSearch(s); n != s && norm.NFD.String(s) == s {
+				folds = append(folds, [2]string{s, n})
+			}
+		}
+	}
+	return folds
+}
+
+func flatten(pairs [][2]string) []string {
+	var l []string
+	for _, p := range pairs {
+		l = append(l, p[0], p[1])
+	}
+	return l
+}
+
+// indexed returns the expression that is indexed for column c of row
+func indexed(row, c string) string {
+	expr := row + c
+	if foldedColumns[c] {
+		for _, f := range foldLetters {
+			expr = fmt.Sprintf("replace(%s, '%s', '%s')", expr, f[0], f[1])
+		}
+	}
+	return expr
+}
+
+func searchIndexStatements(columns []string) []string {
+	cols := strings.Join(columns, ", ")
+	var oldCols, newCols, contentCols []string
+	for _, c := range columns {
+		oldCols = append(oldCols, indexed("old.", c))
+		newCols = append(newCols, indexed("new.", c))
+		contentCols = append(contentCols, indexed("", c)+" AS "+c)
+	}
+	deleteOld := fmt.Sprintf("INSERT INTO search(search, rowid, %s) VALUES('delete', old.id, %s);", cols, strings.Join(oldCols, ", "))
+	insertNew := fmt.Sprintf("INSERT INTO search(rowid, %s) VALUES(new.id, %s);", cols, strings.Join(newCols, ", "))
+
+	return []string{
+		// triggers of all earlier versions
+		"DROP TRIGGER IF EXISTS books_bu",
+		"DROP TRIGGER IF EXISTS books_bd",
+		"DROP TRIGGER IF EXISTS books_au",
+		"DROP TRIGGER IF EXISTS books_ai",
+		"DROP TRIGGER IF EXISTS books_ad",
+		"DROP TABLE IF EXISTS spelling",
+		"DROP TABLE IF EXISTS search_vocab",
+		"DROP TABLE IF EXISTS search",
+		"DROP VIEW IF EXISTS search_content",
+
+		// the index reads the folded text through a view, so a rebuild indexes exactly what the triggers do
+		fmt.Sprintf("CREATE VIEW search_content AS SELECT id, %s FROM books", strings.Join(contentCols, ", ")),
+		fmt.Sprintf("CREATE VIRTUAL TABLE search USING fts5(%s, content=search_content, content_rowid=id, tokenize='unicode61 remove_diacritics 2')", cols),
+		"CREATE TRIGGER books_ai AFTER INSERT ON books BEGIN " + insertNew + " END",
+		"CREATE TRIGGER books_ad AFTER DELETE ON books BEGIN " + deleteOld + " END",
+		"CREATE TRIGGER books_au AFTER UPDATE ON books BEGIN " + deleteOld + " " + insertNew + " END",
+		"INSERT INTO search(search) VALUES('rebuild')",
+		"CREATE VIRTUAL TABLE search_vocab USING fts5vocab(search, col)",
+		"CREATE VIRTUAL TABLE spelling USING fts5(word, docs UNINDEXED, tokenize='trigram')",
+		fillSpelling,
+	}
+}
+
+// createSearchIndex returns a migration that (re)creates the full text index of columns and its triggers,
+// later changes to the index are new migrations that keep the columns of earlier ones as they were.
+func createSearchIndex(columns []string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, stmt := range searchIndexStatements(columns) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("creating search index failed on %q: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// RebuildSearchIndex repopulates the full text index from the books table, which repairs an index that drifted out of sync
+func (db *liteDB) RebuildSearchIndex() error {
+	tx := db.db.Exec("INSERT INTO search(search) VALUES('rebuild')")
+	if tx.Error != nil {
+		return tx.Error
+	}
+	tx = db.db.Exec("INSERT INTO search(search) VALUES('optimize')")
+	if tx.Error != nil {
+		return tx.Error
+	}
+	err := db.UpdateSpellingIndex()
+	if err != nil {
+		return err
+	}
+	return db.UpdateCompletionIndex()
+}
@@ -0,0 +1,55 @@
+//go:build fts5
+
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gnur/booksing"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSearchIndexWithoutBooksing(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// the plain driver has none of the functions of booksing, like the sqlite3 cli
+	cli, err := gorm.Open(sqlite.Open(fileDSN(filepath.Join(dir, "booksing.db"), "cache=shared")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("opening the database without booksing error = %v", err)
+	}
+	for _, stmt := range []string{
+		"INSERT INTO books (hash, title, author, language, path) VALUES ('bjorkjongen', 'De jongen in de sneeuw', 'Samuel Bjørk', 'nl', '/books/a.epub')",
+		"INSERT INTO books (hash, title, author, language, path) VALUES ('zafonsombra', 'La Sombra del Viento', 'Carlos Ruiz Zafón', 'es', '/books/b.epub')",
+		"INSERT INTO books (hash, title, author, language, path) VALUES ('tolkienhobbit', 'The Hobbit', 'J.R.R. Tolkien', 'en', '/books/c.epub')",
+		"UPDATE books SET title = 'El Juego del Ángel' WHERE hash = 'zafonsombra'",
+		"DELETE FROM books WHERE hash = 'tolkienhobbit'",
+	} {
+		if err := cli.Exec(stmt).Error; err != nil {
+			t.Fatalf("%q without booksing error = %v", stmt, err)
+		}
+	}
+	var n int64
+	if err := cli.Raw("SELECT count(*) FROM search WHERE search MATCH 'bjork'").Scan(&n).Error; err != nil || n != 1 {
+		t.Errorf("searching without booksing = %d, %v, want the book of Bjørk", n, err)
+	}
+
+	for q, want := range map[string]int64{
+		"author:bjork":       1,
+		"author:Bjørk":       1,
+		"zafon angel":        1,
+		"title:sombra":       0,
+		"author:tolkien":     0,
+		"lang:nl OR lang:es": 2,
+	} {
+		res, err := db.GetBooks(booksing.SearchQuery{Query: q, Limit: 10})
+		if err != nil || res.Total != want {
+			t.Errorf("GetBooks(%s) after changes without booksing = %v, %v, want %d books", q, res, err, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"strings"
+
+	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/query"
+	"gorm.io/gorm"
+)
+
+// fillSpelling copies the words of all authors and titles into the trigram index used for suggestions
+const fillSpelling = `INSERT INTO spelling(word, docs)
+SELECT term, sum(doc) FROM search_vocab WHERE col IN ('author', 'title') AND length(term) >= 3 GROUP BY term`
+
+// UpdateSpellingIndex refreshes the words that are used for "did you mean" suggestions
+func (db *liteDB) UpdateSpellingIndex() error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM spelling").Error; err != nil {
+			return err
+		}
+		return tx.Exec(fillSpelling).Error
+	})
+}
+
+// suggest returns a corrected version of a search without results, but only when the correction does find books
+func (db *liteDB) suggest(sq booksing.SearchQuery, n query.Node, scopes ...func(*gorm.DB) *gorm.DB) ([]booksing.Suggestion, error) {
+	var edits []query.Edit
+	for _, t := range query.Correctable(n) {
+		word := strings.ToLower(booksing.NormalizeSearch(t.Value))
+
+		var known int64
+		tx := db.db.Raw("SELECT count(*) FROM search_vocab WHERE term = ?", word).Scan(&known)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		if known > 0 {
+			continue
+		}
+
+		closest, err := db.closestWord(word)
+		if err != nil {
+			return nil, err
+		}
+		if closest != "" {
+			edits = append(edits, t.Replace(closest))
+		}
+	}
+	if len(edits) == 0 {
+		return nil, nil
+	}
+
+	corrected := query.Rewrite(sq.Query, edits)
+	n, err := query.Parse(corrected)
+	if err != nil {
+		return nil, nil
+	}
+	c, err := compile(corrected, n)
+	if err != nil {
+		return nil, nil
+	}
+
+	var total int64
+	tx := db.db.Model(&booksing.Book{}).Scopes(c.scope).Scopes(scopes...).Count(&total)
+	if tx.Error != nil || total == 0 {
+		return nil, tx.Error
+	}
+	return []booksing.Suggestion{{Query: corrected, Total: total}}, nil
+}
+
+// closestWord returns the known word that is the fewest edits away from word, or an empty string when nothing is close enough
+func (db *liteDB) closestWord(word string) (string, error) {
+	var trigrams []string
+	for _, t := range query.Trigrams(word) {
+		trigrams = append(trigrams, `"`+t+`"`)
+	}
+	if len(trigrams) == 0 {
+		return "", nil
+	}
+
+	var rows []struct {
+		Word string
+		Docs int64
+	}
+	tx := db.db.Raw("SELECT word, docs FROM spelling WHERE spelling MATCH ? ORDER BY rank LIMIT 200", strings.Join(trigrams, " OR ")).Scan(&rows)
+	if tx.Error != nil {
+		return "", tx.Error
+	}
+
+	candidates := make(map[string]int64)
+	for _, r := range rows {
+		candidates[r.Word] = r.Docs
+	}
+	return query.Closest(word, candidates), nil
+}
@@ -1,77 +1,83 @@
 package sqlite
 
 import (
-	"fmt"
+	"database/sql"
+	"net/url"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gnur/booksing"
+	"github.com/gnur/booksing/gormdb"
+	"github.com/gnur/booksing/query"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// driverName is the sqlite driver with the booksing functions registered on every connection
+	driverName = "sqlite3_booksing"
+	// normalizeFunc is booksing.NormalizeSearch as a sql function, the search index of databases from before
+	// search_fold depends on it until they are migrated
+	normalizeFunc = "booksing_normalize"
 )
 
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc(normalizeFunc, booksing.NormalizeSearch, true)
+		},
+	})
+}
+
 type liteDB struct {
+	*gormdb.DB
 	db *gorm.DB
+	// dir holds booksing.db and the copies made before migrating it
+	dir string
 }
 
 type download = booksing.Download
 
-func New(path string) (*liteDB, error) {
-
-	path = fmt.Sprintf("file:%s/booksing.db?cache=shared", path)
-	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
-		SkipDefaultTransaction: true,
-		Logger:                 logger.Default.LogMode(logger.Silent),
-	})
+// New opens the database in dir and applies all pending migrations
+func New(dir string) (*liteDB, error) {
+	l, err := Open(dir)
 	if err != nil {
 		return nil, err
 	}
-
-	// Migrate the schema
-	err = db.AutoMigrate(
-		&booksing.Book{},
-		&download{},
-		&booksing.User{},
-	)
+	err = l.Migrate()
 	if err != nil {
 		return nil, err
 	}
+	return l, nil
+}
 
-	tx := db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS search USING fts5(content=books, author, title, description, hash);")
-	if tx.Error != nil {
-		return nil, tx.Error
-	}
+// fileDSN returns the uri of the database file at path with params, the path is escaped so a ? or # in it is part of
+// the name
+func fileDSN(path, params string) string {
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + "?" + params
+}
 
-	db.Exec(`
-CREATE TRIGGER books_bu BEFORE UPDATE ON books BEGIN
-  DELETE FROM search WHERE rowid=old.rowid;
-END;
-CREATE TRIGGER books_bd BEFORE DELETE ON books BEGIN
-  DELETE FROM search WHERE rowid=old.rowid;
-END;
-
-CREATE TRIGGER books_au AFTER UPDATE ON books BEGIN
-  INSERT INTO search(rowid, author, title, description) VALUES(new.rowid, new.author, new.title, new.description);
-END;
-CREATE TRIGGER books_ai AFTER INSERT ON books BEGIN
-  INSERT INTO search(rowid, author, title, description) VALUES(new.rowid, new.author, new.title, new.description);
-END;`)
+// Open opens the database in dir as it is, without migrating it
+func Open(dir string) (*liteDB, error) {
+	db, err := gorm.Open(sqlite.Dialector{DriverName: driverName, DSN: fileDSN(filepath.Join(dir, "booksing.db"), "cache=shared")}, &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &liteDB{
-		db: db,
+		DB:  gormdb.New(db),
+		db:  db,
+		dir: dir,
 	}, nil
 }
 
-func (db *liteDB) Close() {
-	//noop, gorm removed it
-}
-
-func (db *liteDB) AddDownload(dl download) error {
-	tx := db.db.Create(&dl)
-	return tx.Error
-}
-
 func (db *liteDB) GetDownloads(limit int) ([]download, error) {
 	var dls []download
 	tx := db.db.Order("Timestamp desc").Limit(limit).Find(&dls)
@@ -113,15 +119,6 @@ func (db *liteDB) GetUsers() ([]booksing.User, error) {
 	return users, tx.Error
 }
 
-func (db *liteDB) GetUser(username string) (booksing.User, error) {
-	var u booksing.User
-	tx := db.db.Where("name = ?", username).First(&u)
-	if tx.Error == gorm.ErrRecordNotFound {
-		return u, booksing.ErrNotFound
-	}
-	return u, tx.Error
-}
-
 func (db *liteDB) SaveUser(u *booksing.User) error {
 	if _, err := db.GetUser(u.Name); err != booksing.ErrNotFound {
 		tx := db.db.Save(&u)
@@ -131,136 +128,222 @@ func (db *liteDB) SaveUser(u *booksing.User) error {
 	return tx.Error
 }
 
-func (db *liteDB) GetBookCount() int {
-	var count int64
-	tx := db.db.Model(&booksing.Book{}).Count(&count)
-	if tx.Error != nil {
-		return -1
-	}
-	return int(count)
-}
-
-func (db *liteDB) HasHash(h string) (bool, error) {
-	var b bool
-	var count int64
-	tx := db.db.Model(&booksing.Book{}).Where("hash = ?", h).Count(&count)
-	if tx.Error == gorm.ErrRecordNotFound || count == 0 {
-		return false, nil
-	}
-	return b, tx.Error
-}
-
-func (db *liteDB) AddBook(b booksing.Book) error {
-	tx := db.db.Create(&b)
-	return tx.Error
-}
-
-func (db *liteDB) GetBook(hash string) (*booksing.Book, error) {
-	var b booksing.Book
-	tx := db.db.Where("hash = ?", hash).First(&b)
-	if tx.Error == gorm.ErrRecordNotFound {
-		return &b, booksing.ErrNotFound
-	}
-	return &b, tx.Error
-}
-
-func (db *liteDB) AddBooks(books []booksing.Book) error {
-	tx := db.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&books)
-
-	return tx.Error
-}
-
-func (db *liteDB) DeleteBook(hash string) error {
-	var b booksing.Book
-	tx := db.db.Where("hash = ?", hash).Delete(&b)
-	return tx.Error
-}
-
-func (db *liteDB) GetBooks(q string, limit, offset int64) (*booksing.SearchResult, error) {
-
+// GetBooks returns a single page of the books matching sq, without a query, sort or filters that is the newest books first.
+// Pages are selected with an offset, or with the After cursor when results are ordered newest first.
+func (db *liteDB) GetBooks(sq booksing.SearchQuery) (*booksing.SearchResult, error) {
 	var books []booksing.Book
 	var total int64
 
-	if q == "" {
-		return db.recentBooks()
-	}
-
-	//check if it is bql
-	if strings.Contains(q, ":") {
-		queryMap := make(map[string]string)
-		terms := strings.Split(q, ",")
-		for _, term := range terms {
-			parts := strings.Split(term, ":")
-			if len(parts) != 2 {
-				continue
-			}
-			field := strings.ToLower(strings.TrimSpace(parts[0]))
-			value := strings.TrimSpace(parts[1])
-			if field == "author" {
-				value = booksing.Fix(value, true, true)
-			} else if field == "title" {
-				value = booksing.Fix(value, true, false)
-			}
-
-			queryMap[field] = value
+	var n query.Node
+	c := &compiled{}
+	if sq.Query != "" {
+		var err error
+		n, err = query.Parse(sq.Query)
+		if err != nil {
+			return nil, err
 		}
-
-		tx := db.db.Where(queryMap).Order("author").Order("title").Offset(int(offset)).Limit(int(limit)).Find(&books)
-		if tx.Error != nil {
-			return nil, tx.Error
+		c, err = compile(sq.Query, n)
+		if err != nil {
+			return nil, err
 		}
-		var count int64
-		tx = db.db.Model(&booksing.Book{}).Where(queryMap).Count(&count)
-		if tx.Error != nil {
-			return nil, tx.Error
+	}
+	filters := []func(*gorm.DB) *gorm.DB{readingFilter(sq), facetFilter(sq)}
+	scopes := append([]func(*gorm.DB) *gorm.DB{c.scope}, filters...)
+	// the facets count every edition, the results only the first edition of a work
+	results := scopes
+	if sq.CollapseEditions {
+		results = append(results[:len(results):len(results)], gormdb.FirstEditions(db.db, scopes...))
+	}
+
+	tx := db.db.Model(&booksing.Book{}).Scopes(results...).Count(&total)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if total == 0 && n != nil {
+		suggestions, err := db.suggest(sq, n, filters...)
+		if err != nil {
+			return nil, err
 		}
 		return &booksing.SearchResult{
-			Items: books,
-			Total: count,
+			Suggestions: suggestions,
+			Facets:      &booksing.Facets{},
 		}, nil
-
 	}
 
-	tx := db.db.Raw("SELECT hash FROM search WHERE search MATCH ? LIMIT ?,?", q, offset, limit).Scan(&books)
+	order := sortOrder(sq.Sort, c)
+	page := db.db.Model(&booksing.Book{}).Select("books.*").Scopes(results...).Order(order)
+	if sq.After != "" {
+		if order != newestFirst {
+			return nil, booksing.ErrInvalidCursor
+		}
+		added, id, err := booksing.DecodeCursor(sq.After)
+		if err != nil {
+			return nil, err
+		}
+		page = page.Scopes(afterCursor(added, id))
+	} else {
+		page = page.Offset(int(sq.Offset))
+	}
+	// fetch a single extra book to find out whether there is a next page
+	tx = page.Limit(int(sq.Limit) + 1).Find(&books)
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
 
-	if len(books) > 0 {
-		hashes := []string{}
-		for _, b := range books {
-			hashes = append(hashes, b.Hash)
+	var next string
+	if int64(len(books)) > sq.Limit {
+		books = books[:sq.Limit]
+		if order == newestFirst && len(books) > 0 {
+			next = booksing.EncodeCursor(books[len(books)-1])
 		}
-		tx := db.db.Where("hash IN ?", hashes).Find(&books)
-		if tx.Error != nil {
-			return nil, tx.Error
-		}
-		var count struct {
-			Count int64
+	}
+
+	facets, err := db.facets(scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	var editions map[uint][]booksing.Book
+	if sq.CollapseEditions {
+		editions, err = db.EditionsOf(books)
+		if err != nil {
+			return nil, err
 		}
-		tx = db.db.Raw("SELECT count(*) as count FROM search WHERE search MATCH ?", q).Scan(&count)
+	}
+
+	return &booksing.SearchResult{
+		Items:    books,
+		Total:    total,
+		Facets:   facets,
+		Next:     next,
+		Editions: editions,
+	}, nil
+}
+
+// facets counts the values of all books matching the scopes
+func (db *liteDB) facets(scopes ...func(*gorm.DB) *gorm.DB) (*booksing.Facets, error) {
+	var f booksing.Facets
+
+	for _, facet := range []struct {
+		column string
+		dest   *[]booksing.FacetCount
+	}{
+		{column: "books.language", dest: &f.Languages},
+		{column: "books.series", dest: &f.Series},
+		{column: "books.publisher", dest: &f.Publishers},
+	} {
+		tx := db.db.Model(&booksing.Book{}).Scopes(scopes...).
+			Select(facet.column + " AS value, count(*) AS count").
+			Where(facet.column + " != ''").
+			Group(facet.column).Order("count DESC").Limit(10).
+			Scan(facet.dest)
 		if tx.Error != nil {
 			return nil, tx.Error
-		} else {
-			total = count.Count
 		}
+	}
 
+	now := time.Now()
+	sums := []string{"coalesce(sum(books.has_cover), 0)"}
+	args := []interface{}{}
+	for _, w := range booksing.AddedWindows {
+		sums = append(sums, "coalesce(sum(books.added >= ?), 0)")
+		args = append(args, now.Add(-w.Duration))
+	}
+	row := db.db.Model(&booksing.Book{}).Scopes(scopes...).Select(strings.Join(sums, ", "), args...).Row()
+	counts := make([]int64, len(sums))
+	dest := make([]interface{}, len(sums))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	f.WithCover = counts[0]
+	for i, w := range booksing.AddedWindows {
+		f.Added = append(f.Added, booksing.FacetCount{
+			Value: w.Name,
+			Count: counts[i+1],
+		})
 	}
 
-	return &booksing.SearchResult{
-		Items: books,
-		Total: total,
-	}, nil
+	return &f, nil
+}
+
+// readingFilter limits a book query to the reading state requested in the search
+func readingFilter(sq booksing.SearchQuery) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		switch {
+		case sq.Status == "" || sq.User == "":
+			return tx
+		case sq.Status == booksing.StatusUnread:
+			return tx.Where("books.id NOT IN (SELECT book_id FROM reading_states WHERE user = ? AND status != ?)", sq.User, booksing.StatusWantToRead)
+		case !sq.FinishedSince.IsZero():
+			return tx.Where("books.id IN (SELECT book_id FROM reading_states WHERE user = ? AND status = ? AND finished >= ?)", sq.User, sq.Status, sq.FinishedSince)
+		default:
+			return tx.Where("books.id IN (SELECT book_id FROM reading_states WHERE user = ? AND status = ?)", sq.User, sq.Status)
+		}
+	}
 }
 
-func (db *liteDB) recentBooks() (*booksing.SearchResult, error) {
+func (db *liteDB) GetProgress(user, document string) (*booksing.Progress, error) {
+	var p booksing.Progress
+	tx := db.db.Where("user = ? AND document = ?", user, document).First(&p)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return &p, booksing.ErrNotFound
+	}
+	return &p, tx.Error
+}
 
-	var books []booksing.Book
+func (db *liteDB) GetBookProgress(user string, id uint) (*booksing.Progress, error) {
+	var p booksing.Progress
+	tx := db.db.Where("user = ? AND book_id = ?", user, id).Order("timestamp desc").First(&p)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return &p, booksing.ErrNotFound
+	}
+	return &p, tx.Error
+}
 
-	tx := db.db.Order("Added desc").Limit(20).Find(&books)
+// GetRecentProgress returns the latest progress of user per book, several documents in KOReader can be the same book
+func (db *liteDB) GetRecentProgress(user string, limit int) ([]booksing.Progress, error) {
+	var ps []booksing.Progress
+	tx := db.db.Where(`user = ? AND book_id != 0 AND NOT EXISTS (
+SELECT 1 FROM progresses newer
+WHERE newer.user = progresses.user AND newer.book_id = progresses.book_id AND newer.deleted_at IS NULL
+AND (newer.timestamp > progresses.timestamp OR newer.timestamp = progresses.timestamp AND newer.id > progresses.id))`, user).Order("timestamp desc").Limit(limit).Find(&ps)
+	return ps, tx.Error
+}
 
-	return &booksing.SearchResult{
-		Items: books,
-		Total: int64(len(books)),
-	}, tx.Error
+func (db *liteDB) GetReadingState(user string, id uint) (*booksing.ReadingState, error) {
+	var r booksing.ReadingState
+	tx := db.db.Where("user = ? AND book_id = ?", user, id).First(&r)
+	if tx.Error == gorm.ErrRecordNotFound {
+		return &r, booksing.ErrNotFound
+	}
+	return &r, tx.Error
+}
+
+func (db *liteDB) DeleteReadingState(user string, id uint) error {
+	tx := db.db.Unscoped().Where("user = ? AND book_id = ?", user, id).Delete(&booksing.ReadingState{})
+	return tx.Error
+}
+
+func (db *liteDB) GetFinished(user string, from, to time.Time) ([]booksing.ReadingState, error) {
+	var rs []booksing.ReadingState
+	tx := db.db.Where("user = ? AND status = ? AND finished >= ? AND finished < ?", user, booksing.StatusFinished, from, to).Order("finished").Find(&rs)
+	return rs, tx.Error
+}
+
+// ImportDownloads marks every downloaded book that has no reading state yet as being read
+func (db *liteDB) ImportDownloads(user string) (int64, error) {
+	now := time.Now()
+	tx := db.db.Exec(`
+INSERT INTO reading_states (created_at, updated_at, user, book_id, status, started, finished, rating, note)
+SELECT ?, ?, user, book_id, ?, min(timestamp), ?, 0, ''
+FROM downloads
+WHERE user = ?
+  AND deleted_at IS NULL
+  AND book_id IN (SELECT id FROM books WHERE deleted_at IS NULL)
+  AND book_id NOT IN (SELECT book_id FROM reading_states WHERE user = ?)
+GROUP BY user, book_id`, now, now, booksing.StatusReading, time.Time{}, user, user)
+	return tx.RowsAffected, tx.Error
 }
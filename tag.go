@@ -0,0 +1,78 @@
+package booksing
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tag is a subject of books, like fantasy or thriller
+type Tag struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"uniqueIndex"`
+}
+
+// BookTag links a book to one of its tags
+type BookTag struct {
+	BookID uint `gorm:"primaryKey"`
+	TagID  uint `gorm:"primaryKey;index"`
+}
+
+// maxTagLength is the longest name of a tag, longer subjects are sentences rather than tags
+const maxTagLength = 50
+
+// qualifier is the explanation libraries put after a subject, like "Gothic fiction (Literary genre)"
+var qualifier = regexp.MustCompile(`\s*\([^)]*\)`)
+
+// TagName returns how a tag with name s is stored: in lower case with single spaces
+func TagName(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// ParseSubjects returns the tags of the subjects of an epub. Library subjects like "Vampires -- Fiction" become
+// vampires, and BISAC subjects like "FICTION / Fantasy / Epic" become a tag for every level except general.
+func ParseSubjects(subjects []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		name := TagName(qualifier.ReplaceAllString(s, ""))
+		if name == "" || name == "general" || len(name) > maxTagLength || seen[name] {
+			return
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+
+	for _, s := range subjects {
+		// the heading of a library subject comes first, its subdivisions only narrow it down
+		s = strings.Split(s, " -- ")[0]
+		for _, level := range strings.Split(s, " / ") {
+			add(level)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// TagNames returns the names of the tags of b
+func (b Book) TagNames() []string {
+	if b.Tags == "" {
+		return nil
+	}
+	return strings.Split(b.Tags, "\n")
+}
+
+// SetTags gives b the tags with names, sorted and without doubles
+func (b *Book) SetTags(names []string) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, n := range names {
+		n = TagName(n)
+		if n != "" && !seen[n] {
+			seen[n] = true
+			tags = append(tags, n)
+		}
+	}
+	sort.Strings(tags)
+	b.Tags = strings.Join(tags, "\n")
+}
@@ -0,0 +1,41 @@
+package booksing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSubjects(t *testing.T) {
+	tests := []struct {
+		subjects []string
+		want     []string
+	}{
+		{subjects: nil, want: nil},
+		{subjects: []string{"Fantasy", "fantasy ", "FANTASY"}, want: []string{"fantasy"}},
+		{subjects: []string{"Vampires -- Fiction", "London (England) -- History -- 19th century -- Fiction"}, want: []string{"london", "vampires"}},
+		{subjects: []string{"Gothic fiction (Literary genre)"}, want: []string{"gothic fiction"}},
+		{subjects: []string{"FICTION / Fantasy / Epic", "Fiction / General"}, want: []string{"epic", "fantasy", "fiction"}},
+		{subjects: []string{"Roman", "Thriller", "  Science   Fiction  "}, want: []string{"roman", "science fiction", "thriller"}},
+		{subjects: []string{"", "General", "A subject that is far too long to be a tag because it reads like a sentence"}, want: nil},
+	}
+	for _, tt := range tests {
+		if got := ParseSubjects(tt.subjects); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSubjects(%q) = %q, want %q", tt.subjects, got, tt.want)
+		}
+	}
+}
+
+func TestSetTags(t *testing.T) {
+	var b Book
+	b.SetTags([]string{"Thriller", " roman", "thriller", ""})
+	if b.Tags != "roman\nthriller" {
+		t.Errorf("SetTags() = %q, want the sorted names once", b.Tags)
+	}
+	if got := b.TagNames(); !reflect.DeepEqual(got, []string{"roman", "thriller"}) {
+		t.Errorf("TagNames() = %q, want roman and thriller", got)
+	}
+	b.SetTags(nil)
+	if b.Tags != "" || b.TagNames() != nil {
+		t.Errorf("SetTags(nil) = %q, want no tags", b.Tags)
+	}
+}
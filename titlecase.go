@@ -0,0 +1,143 @@
+package booksing
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// CapitalizeFields are the fields that can be title cased on import
+var CapitalizeFields = []string{"title", "author", "series", "publisher"}
+
+// smallWords stay lower case inside a title, by language. Languages without a list have every word capitalized.
+var smallWords = map[string]map[string]bool{
+	"en": wordSet("a an and as at but by for from if in into nor of off on or per the to up via vs with"),
+	"nl": wordSet("aan als bij de der des door een en het in met na naar of om op over te ten ter tot uit van voor"),
+	"de": wordSet("am an auf aus bei das dem den der des die ein eine einem einen einer eines für im in mit oder und vom von zu zum zur über"),
+}
+
+// sentenceCase are the languages that write titles like a sentence, only the first word, the first word after a colon
+// and names start with a capital
+var sentenceCase = map[string]bool{"nl": true}
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// namePrefix matches the start of names like McCarthy and O'Brien, the letter after it is capitalized as well
+var namePrefix = regexp.MustCompile(`^(mc|o')(\pL.*)$`)
+
+// TitleCase capitalizes s the way titles are written in lang. Text that is all lower case, or shouted in upper case,
+// has every word capitalized except the small words of lang, and McCarthy and O'Brien get their second capital. Dutch
+// writes titles like a sentence, so there only the first word and the first word after a colon are capitalized.
+// Text that already has capitals is trusted: acronyms and names like iPhone are left alone, only English
+// capitalizes the words that are not small and every language capitalizes the first letter.
+func TitleCase(s, lang string) string {
+	return titleCase(s, lang, sentenceCase[lang])
+}
+
+// NameCase capitalizes the name of a person or a publisher like TitleCase, except that every word that is not small
+// is capitalized in every language, a Dutch name is no sentence
+func NameCase(s, lang string) string {
+	return titleCase(s, lang, false)
+}
+
+func titleCase(s, lang string, sentence bool) string {
+	tag := language.Make(lang)
+	words := strings.Fields(s)
+	recase := !hasUpper(s) || shouted(words)
+	if recase {
+		words = strings.Fields(cases.Lower(tag).String(s))
+	}
+	title := cases.Title(tag, cases.NoLower)
+	small := smallWords[lang]
+
+	for i, w := range words {
+		first := i == 0 || strings.HasSuffix(words[i-1], ":") || strings.HasSuffix(words[i-1], ";")
+		last := i == len(words)-1 && lang == "en"
+		switch {
+		case !first && !last && small[strings.ToLower(w)] && (recase || lang == "en" && !hasUpper(afterFirst(w))):
+			words[i] = strings.ToLower(w)
+		case recase && (first || !sentence) || (first || lang == "en") && !hasUpper(w):
+			words[i] = capitalize(w, title)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalize gives every part of a word between dots a capital, so j.r.r. becomes J.R.R., and puts the capitals in
+// names with a prefix. Capitals that are already there stay.
+func capitalize(w string, title cases.Caser) string {
+	parts := strings.Split(w, ".")
+	for i, p := range parts {
+		if m := namePrefix.FindStringSubmatch(p); m != nil {
+			p = title.String(m[1]) + title.String(m[2])
+		}
+		parts[i] = title.String(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// shouted reports whether words are written in capitals, a single word in capitals is more likely an acronym like IT
+func shouted(words []string) bool {
+	long := 0
+	for _, w := range words {
+		if hasLower(w) {
+			return false
+		}
+		if letters(w) > 1 {
+			long++
+		}
+	}
+	return long > 1
+}
+
+func hasLower(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLower) >= 0
+}
+
+func hasUpper(s string) bool {
+	return strings.IndexFunc(s, unicode.IsUpper) >= 0
+}
+
+// afterFirst returns s without its first letter
+func afterFirst(s string) string {
+	_, size := utf8.DecodeRuneInString(s)
+	return s[size:]
+}
+
+func letters(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// Capitalize title cases fields of b in the rules of its language, fields are from CapitalizeFields. The author and
+// publisher are names and are cased with NameCase.
+func (b *Book) Capitalize(fields ...string) {
+	for _, f := range fields {
+		v := b.Field(f)
+		if v == "" {
+			continue
+		}
+		if f == "author" || f == "publisher" {
+			v = NameCase(v, b.Language)
+		} else {
+			v = TitleCase(v, b.Language)
+		}
+		// every field in CapitalizeFields can be set from text
+		_ = b.SetField(f, v)
+	}
+}
@@ -0,0 +1,117 @@
+package booksing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gnur/booksing/epub"
+)
+
+func TestTitleCase(t *testing.T) {
+	tests := []struct {
+		s    string
+		lang string
+		want string
+	}{
+		{s: "IT", lang: "en", want: "IT"},
+		{s: "it", lang: "en", want: "It"},
+		{s: "THE HOBBIT", lang: "en", want: "The Hobbit"},
+		{s: "the lord of the rings", lang: "en", want: "The Lord of the Rings"},
+		{s: "The lord of the rings", lang: "en", want: "The Lord of the Rings"},
+		{s: "what dreams are made of", lang: "en", want: "What Dreams Are Made Of"},
+		{s: "the pioppi diet: a 21-day lifestyle plan", lang: "en", want: "The Pioppi Diet: A 21-Day Lifestyle Plan"},
+		{s: "the road by cormac mccarthy", lang: "en", want: "The Road by Cormac McCarthy"},
+		{s: "Cormac McCarthy", lang: "en", want: "Cormac McCarthy"},
+		{s: "o'brien's war", lang: "en", want: "O'Brien's War"},
+		{s: "iPhone for dummies", lang: "en", want: "iPhone for Dummies"},
+		{s: "A History of the NHS", lang: "en", want: "A History of the NHS"},
+		{s: "de tijd van de jeneverbes", lang: "nl", want: "De tijd van de jeneverbes"},
+		{s: "De tijd van de jeneverbes", lang: "nl", want: "De tijd van de jeneverbes"},
+		{s: "DE WOLWINKEL", lang: "nl", want: "De wolwinkel"},
+		{s: "de aanslag: een roman", lang: "nl", want: "De aanslag: Een roman"},
+		{s: "Reis naar Amsterdam", lang: "nl", want: "Reis naar Amsterdam"},
+		{s: "ijsland in de winter", lang: "nl", want: "IJsland in de winter"},
+		{s: "die verwandlung", lang: "de", want: "Die Verwandlung"},
+		{s: "Der Kelch von Anavrin: Das magische Siegel", lang: "de", want: "Der Kelch von Anavrin: Das magische Siegel"},
+		{s: "j.r.r. tolkien", lang: "", want: "J.R.R. Tolkien"},
+		{s: "war and peace", lang: "", want: "War And Peace"},
+		{s: "", lang: "en", want: ""},
+	}
+	for _, tt := range tests {
+		if got := TitleCase(tt.s, tt.lang); got != tt.want {
+			t.Errorf("TitleCase(%q, %q) = %q, want %q", tt.s, tt.lang, got, tt.want)
+		}
+	}
+}
+
+// TestTitleCaseTestdata checks that the titles and authors of the books in testdata, which are mostly cased well, are
+// left alone apart from a few English small words
+func TestNameCase(t *testing.T) {
+	tests := []struct {
+		s    string
+		lang string
+		want string
+	}{
+		{s: "jan van der berg", lang: "nl", want: "Jan van der Berg"},
+		{s: "HARRY MULISCH", lang: "nl", want: "Harry Mulisch"},
+		{s: "cormac mccarthy", lang: "en", want: "Cormac McCarthy"},
+		{s: "Arthur C. Clarke", lang: "nl", want: "Arthur C. Clarke"},
+	}
+	for _, tt := range tests {
+		if got := NameCase(tt.s, tt.lang); got != tt.want {
+			t.Errorf("NameCase(%q, %q) = %q, want %q", tt.s, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestTitleCaseTestdata(t *testing.T) {
+	changed := map[string]string{
+		"On the Origin of Species By Means of Natural Selection / Or, the Preservation of Favoured Races in the Struggle for Life": "On the Origin of Species by Means of Natural Selection / Or, the Preservation of Favoured Races in the Struggle for Life",
+		"Moby Dick; Or, The Whale":                "Moby Dick; Or, the Whale",
+		"Frankenstein; Or, The Modern Prometheus": "Frankenstein; Or, the Modern Prometheus",
+		"graf Leo Tolstoy":                        "Graf Leo Tolstoy",
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "import", "*", "*.epub"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no testdata books found: %v", err)
+	}
+	for _, f := range files {
+		e, _, err := epub.ParseFile(f)
+		if err != nil {
+			continue
+		}
+		lang := FixLang(e.Language)
+		for _, c := range []struct {
+			s    string
+			name string
+			fn   func(string, string) string
+		}{
+			{s: Fix(e.Title, false, false), name: "TitleCase", fn: TitleCase},
+			{s: Fix(e.Author, false, true), name: "NameCase", fn: NameCase},
+		} {
+			want, ok := changed[c.s]
+			if !ok {
+				want = c.s
+			}
+			got := c.fn(c.s, lang)
+			if got != want {
+				t.Errorf("%s(%q, %q) of %s = %q, want %q", c.name, c.s, lang, filepath.Base(f), got, want)
+			}
+			if again := c.fn(got, lang); again != got {
+				t.Errorf("%s(%q, %q) = %q, want it to stay the same", c.name, got, lang, again)
+			}
+		}
+	}
+}
+
+func TestCapitalize(t *testing.T) {
+	b := Book{Title: "de tijd van de jeneverbes", Author: "kate wilhelm", Series: "de bibliotheek", Language: "nl"}
+	b.Capitalize("title", "author")
+	if b.Title != "De tijd van de jeneverbes" || b.Author != "Kate Wilhelm" || b.Series != "de bibliotheek" {
+		t.Errorf("Capitalize(title, author) = %q, %q, %q, want only the title and author capitalized", b.Title, b.Author, b.Series)
+	}
+	if b.Hash != HashBook(b.Author, b.Title) {
+		t.Errorf("Capitalize() left hash %q, want the hash of the new title and author", b.Hash)
+	}
+}
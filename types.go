@@ -11,15 +11,101 @@ var ErrNonUniqueResult = errors.New("query gave more then 1 result")
 var ErrNotFound = errors.New("query no results")
 var ErrDuplicate = errors.New("duplicate key")
 
+// ErrInvalidCursor is returned when a SearchQuery holds a cursor that can not be used
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
 type Download struct {
 	gorm.Model
-	Book      string    `json:"hash"`
+	BookID    uint      `json:"book_id"`
 	User      string    `json:"user" gorm:"index"`
 	IP        string    `json:"ip"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// SearchQuery holds everything needed to run a single search
+type SearchQuery struct {
+	Query  string
+	Limit  int64
+	Offset int64
+	// After is a cursor from SearchResult.Next, when set the results continue directly after
+	// the book it points to and Offset is ignored. Cursors only work for newest first results.
+	After string
+
+	// User, Status and FinishedSince limit the results based on the reading state of User
+	User          string
+	Status        ReadingStatus
+	FinishedSince time.Time
+
+	// Sort is one of SortOptions, empty means relevance for text searches and newest first otherwise
+	Sort string
+
+	// facet filters, empty values are ignored
+	Language   string
+	Series     string
+	Publisher  string
+	HasCover   bool
+	AddedSince time.Time
+
+	// CollapseEditions returns a single result per work, the first matching edition, instead of every edition
+	CollapseEditions bool
+}
+
+// SortOptions are the supported orders for search results
+var SortOptions = []string{"relevance", "title", "author", "added", "published", "size", "series"}
+
+// AddedWindows are the periods the added facet is split into
+var AddedWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{Name: "week", Duration: 7 * 24 * time.Hour},
+	{Name: "month", Duration: 30 * 24 * time.Hour},
+	{Name: "year", Duration: 365 * 24 * time.Hour},
+}
+
+// Filtered reports whether anything besides the query itself limits the results
+func (sq SearchQuery) Filtered() bool {
+	return sq.Status != "" || sq.Language != "" || sq.Series != "" || sq.Publisher != "" || sq.HasCover || !sq.AddedSince.IsZero()
+}
+
+// FacetCount is the number of results that share a single value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facets summarize the values found in all results of a search
+type Facets struct {
+	Languages  []FacetCount
+	Series     []FacetCount
+	Publishers []FacetCount
+	WithCover  int64
+	// Added holds the number of results per AddedWindows name
+	Added []FacetCount
+}
+
 type SearchResult struct {
 	Items []Book
+	// Total is the number of books matching the search, regardless of Limit, Offset and After
+	Total  int64
+	Facets *Facets
+	// Next is the cursor for the page after Items, it is only set for newest first results that have more pages
+	Next string
+	// Suggestions are corrected searches that do find books, they are only given when nothing was found
+	Suggestions []Suggestion
+	// Editions holds all editions of the works in Items by work, it is only set with CollapseEditions
+	Editions map[uint][]Book
+}
+
+// Completions are the authors, series and titles that match a partially typed search
+type Completions struct {
+	Authors []FacetCount `json:"authors"`
+	Series  []FacetCount `json:"series"`
+	Titles  []FacetCount `json:"titles"`
+}
+
+// Suggestion is a search with its spelling corrected
+type Suggestion struct {
+	Query string
 	Total int64
 }
@@ -0,0 +1,31 @@
+package booksing
+
+import "time"
+
+// UploadStatus is what the import made of an uploaded file
+type UploadStatus string
+
+// The statuses of an upload, a file is pending until refresh imported it
+const (
+	UploadPending   UploadStatus = "pending"
+	UploadAdded     UploadStatus = "added"
+	UploadDuplicate UploadStatus = "duplicate"
+	UploadRejected  UploadStatus = "rejected"
+	UploadFailed    UploadStatus = "failed"
+)
+
+// Upload is a file that a user uploaded through the web ui
+type Upload struct {
+	ID       uint `gorm:"primaryKey"`
+	Created  time.Time
+	Uploader string `gorm:"index"`
+	// Filename is the name the file was uploaded with, Path where it is stored in the import dir
+	Filename string
+	Path     string `gorm:"index"`
+	Size     int64
+	Status   UploadStatus
+	// Message says why a file was not added
+	Message string
+	// BookID is the book the file became, or the book it is a copy of
+	BookID uint
+}
@@ -3,6 +3,7 @@ package booksing
 import (
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -15,4 +16,23 @@ type User struct {
 	Downloads int64
 	Created   time.Time
 	LastSeen  time.Time
+	SyncKey   string `json:"-" form:"-"`
+}
+
+// SetSyncKey stores the KOReader sync key (the md5 of the password) in hashed form
+func (u *User) SetSyncKey(key string) error {
+	h, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.SyncKey = string(h)
+	return nil
+}
+
+// CheckSyncKey reports whether key matches the stored KOReader sync key
+func (u *User) CheckSyncKey(key string) bool {
+	if u.SyncKey == "" || key == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.SyncKey), []byte(key)) == nil
 }
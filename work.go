@@ -0,0 +1,105 @@
+package booksing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Work groups the editions of a single work, in every language and format
+type Work struct {
+	ID uint `gorm:"primaryKey"`
+	// Title and Author are those of the first edition of the work
+	Title  string
+	Author string
+}
+
+// WorkGroup are books without a work that get the same work
+type WorkGroup struct {
+	// Work is the existing work the books join, 0 when they start a new work
+	Work  uint
+	Books []uint
+}
+
+// WorkKeys returns the keys that tie a book to the other editions of its work. Books that share a key are editions of
+// the same work: they have the same hash, the same ISBN or the same position in a series of the same author.
+func WorkKeys(b Book) []string {
+	keys := []string{"hash:" + b.Hash}
+	if isbn := normalizeISBN(b.ISBN); isbn != "" {
+		keys = append(keys, "isbn:"+isbn)
+	}
+	if b.Series != "" && b.SeriesIndex > 0 && b.Author != "" {
+		keys = append(keys, fmt.Sprintf("series:%s|%s|%g", strings.ToLower(NormalizeSearch(b.Author)), strings.ToLower(NormalizeSearch(b.Series)), b.SeriesIndex))
+	}
+	return keys
+}
+
+// normalizeISBN returns the digits of an ISBN like urn:isbn:978-90-229-9046-1, or nothing when it is not an ISBN
+func normalizeISBN(s string) string {
+	var isbn strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if r >= '0' && r <= '9' || r == 'X' {
+			isbn.WriteRune(r)
+		}
+	}
+	if isbn.Len() != 10 && isbn.Len() != 13 {
+		return ""
+	}
+	return isbn.String()
+}
+
+// PlanWorks groups the books without a work. A book joins the work of the first book with a work it shares a key
+// with, books that share a key with no such book start a new work together. Existing works are never merged,
+// a book that shares keys with several works joins the one it shares its hash with, then its ISBN, then its series.
+func PlanWorks(books []Book) []WorkGroup {
+	var plan []WorkGroup
+	groups := make(map[string]int)
+	existing := make(map[uint]int)
+	for _, b := range books {
+		if b.WorkID == 0 {
+			continue
+		}
+		g, ok := existing[b.WorkID]
+		if !ok {
+			g = len(plan)
+			existing[b.WorkID] = g
+			plan = append(plan, WorkGroup{Work: b.WorkID})
+		}
+		for _, k := range WorkKeys(b) {
+			if _, ok := groups[k]; !ok {
+				groups[k] = g
+			}
+		}
+	}
+
+	for _, b := range books {
+		if b.WorkID != 0 {
+			continue
+		}
+		keys := WorkKeys(b)
+		g := -1
+		for _, k := range keys {
+			if found, ok := groups[k]; ok {
+				g = found
+				break
+			}
+		}
+		if g < 0 {
+			g = len(plan)
+			plan = append(plan, WorkGroup{})
+		}
+		plan[g].Books = append(plan[g].Books, b.ID)
+		for _, k := range keys {
+			if _, ok := groups[k]; !ok {
+				groups[k] = g
+			}
+		}
+	}
+
+	var grouped []WorkGroup
+	for _, g := range plan {
+		if len(g.Books) > 0 {
+			grouped = append(grouped, g)
+		}
+	}
+	return grouped
+}
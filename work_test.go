@@ -0,0 +1,52 @@
+package booksing
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestWorkKeys(t *testing.T) {
+	tests := []struct {
+		book Book
+		want []string
+	}{
+		{book: Book{Hash: "herbertdune"}, want: []string{"hash:herbertdune"}},
+		{book: Book{Hash: "herbertdune", ISBN: "urn:isbn:978-0-441-17271-9"}, want: []string{"hash:herbertdune", "isbn:9780441172719"}},
+		{book: Book{Hash: "herbertdune", ISBN: "unknown"}, want: []string{"hash:herbertdune"}},
+		{book: Book{Hash: "herbertdune", ISBN: "0-441-17271-x"}, want: []string{"hash:herbertdune", "isbn:044117271X"}},
+		{book: Book{Hash: "andreeerstegezicht", Author: "Bella André", Series: "Sullivan", SeriesIndex: 1}, want: []string{"hash:andreeerstegezicht", "series:bella andre|sullivan|1"}},
+		{book: Book{Hash: "andreeerstegezicht", Author: "Bella André", Series: "Sullivan"}, want: []string{"hash:andreeerstegezicht"}},
+	}
+	for _, tt := range tests {
+		if got := WorkKeys(tt.book); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WorkKeys(%+v) = %v, want %v", tt.book, got, tt.want)
+		}
+	}
+}
+
+func TestPlanWorks(t *testing.T) {
+	books := []Book{
+		{Model: gorm.Model{ID: 1}, Hash: "herbertdune", Author: "Frank Herbert", Series: "Dune", SeriesIndex: 1, WorkID: 7},
+		{Model: gorm.Model{ID: 2}, Hash: "herbertduin", Author: "Frank Herbert", Series: "Dune", SeriesIndex: 1},
+		{Model: gorm.Model{ID: 3}, Hash: "herbertdune", Author: "Frank Herbert"},
+		{Model: gorm.Model{ID: 4}, Hash: "bjorkdejongenindesneeuw", ISBN: "9789022599467"},
+		{Model: gorm.Model{ID: 5}, Hash: "bjorkboyinthesnow", ISBN: "978-90-225-9946-7"},
+		{Model: gorm.Model{ID: 6}, Hash: "bjorkdeuil"},
+		{Model: gorm.Model{ID: 7}, Hash: "herbertdunemessiah", WorkID: 8},
+	}
+
+	want := []WorkGroup{
+		{Work: 7, Books: []uint{2, 3}},
+		{Books: []uint{4, 5}},
+		{Books: []uint{6}},
+	}
+	if got := PlanWorks(books); !reflect.DeepEqual(got, want) {
+		t.Errorf("PlanWorks() = %+v, want %+v", got, want)
+	}
+
+	if plan := PlanWorks(books[:1]); plan != nil {
+		t.Errorf("PlanWorks() of grouped books = %+v, want nothing", plan)
+	}
+}